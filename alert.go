@@ -0,0 +1,379 @@
+package md2png
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ---- Alerts ----
+
+// Alerts, or admonitions, are call-out boxes with a colored bar, an icon and
+// a title. They are written either GitHub style, as a block quote whose first
+// line is the kind:
+//
+//	> [!WARNING]
+//	> Back up your data first.
+//
+// or as a ::: container, optionally with a title after the kind:
+//
+//	::: tip Faster builds
+//	Run with -race only in CI.
+//	:::
+//
+// Containers also accept the aliases info, hint, attention, danger and
+// error; any other kind is drawn as a note titled with the kind, and
+// reported as a diagnostic.
+
+type alertKind int
+
+const (
+	alertNote alertKind = iota
+	alertTip
+	alertImportant
+	alertWarning
+	alertCaution
+)
+
+var alertTitles = [...]string{"Note", "Tip", "Important", "Warning", "Caution"}
+
+var alertKinds = map[string]alertKind{
+	"note": alertNote, "info": alertNote,
+	"tip": alertTip, "hint": alertTip,
+	"important": alertImportant,
+	"warning":   alertWarning, "attention": alertWarning,
+	"caution": alertCaution, "danger": alertCaution, "error": alertCaution,
+}
+
+// AlertTheme colors the bar, icon and title of each kind of alert. A nil
+// color falls back to the theme's quote bar color.
+type AlertTheme struct {
+	Note      color.Color
+	Tip       color.Color
+	Important color.Color
+	Warning   color.Color
+	Caution   color.Color
+}
+
+var (
+	lightAlerts = AlertTheme{
+		Note:      color.RGBA{0x09, 0x69, 0xDA, 0xFF},
+		Tip:       color.RGBA{0x1A, 0x7F, 0x37, 0xFF},
+		Important: color.RGBA{0x82, 0x50, 0xDF, 0xFF},
+		Warning:   color.RGBA{0x9A, 0x67, 0x00, 0xFF},
+		Caution:   color.RGBA{0xD1, 0x24, 0x2F, 0xFF},
+	}
+	darkAlerts = AlertTheme{
+		Note:      color.RGBA{0x44, 0x93, 0xF8, 0xFF},
+		Tip:       color.RGBA{0x3F, 0xB9, 0x50, 0xFF},
+		Important: color.RGBA{0xAB, 0x7D, 0xF8, 0xFF},
+		Warning:   color.RGBA{0xD2, 0x99, 0x22, 0xFF},
+		Caution:   color.RGBA{0xF8, 0x51, 0x49, 0xFF},
+	}
+)
+
+func (a AlertTheme) color(kind alertKind, fallback color.Color) color.Color {
+	var c color.Color
+	switch kind {
+	case alertNote:
+		c = a.Note
+	case alertTip:
+		c = a.Tip
+	case alertImportant:
+		c = a.Important
+	case alertWarning:
+		c = a.Warning
+	case alertCaution:
+		c = a.Caution
+	}
+	if c == nil {
+		return fallback
+	}
+	return c
+}
+
+var kindAlert = ast.NewNodeKind("Alert")
+
+// alertBlock is an alert holding the blocks of its body.
+type alertBlock struct {
+	ast.BaseBlock
+	kind    alertKind
+	title   string
+	unknown string // the kind as written when it is not a known kind
+	depth   int    // ::: containers opened inside this one and not yet closed
+	fence   string // marker of the fenced code block being read, if any
+}
+
+func (n *alertBlock) Kind() ast.NodeKind { return kindAlert }
+
+func (n *alertBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Title": n.title}, nil)
+}
+
+// alertExtension adds ::: containers and turns GitHub alert quotes into
+// alert blocks.
+type alertExtension struct{}
+
+func (alertExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		// Ahead of definition lists, whose descriptions also start with ':'.
+		parser.WithBlockParsers(util.Prioritized(alertContainerParser{}, 90)),
+		parser.WithASTTransformers(util.Prioritized(alertQuoteTransformer{}, 100)),
+	)
+}
+
+// alertFence splits a ::: line into its kind and title; both are empty on a
+// closing line.
+func alertFence(line []byte) (kind, title string, ok bool) {
+	line = bytes.TrimSpace(line)
+	colons := 0
+	for colons < len(line) && line[colons] == ':' {
+		colons++
+	}
+	if colons < 3 {
+		return "", "", false
+	}
+	fields := strings.Fields(string(line[colons:]))
+	if len(fields) == 0 {
+		return "", "", true
+	}
+	return fields[0], strings.Join(fields[1:], " "), true
+}
+
+// codeFence returns the run of backticks or tildes opening a fenced code
+// block on line, or "" when line does not open one.
+func codeFence(line []byte) string {
+	trimmed := bytes.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) == 0 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	i := 0
+	for i < len(trimmed) && trimmed[i] == trimmed[0] {
+		i++
+	}
+	if i < 3 {
+		return ""
+	}
+	return string(trimmed[:i])
+}
+
+type alertContainerParser struct{}
+
+func (alertContainerParser) Trigger() []byte { return []byte{':'} }
+
+func (alertContainerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	name, title, ok := alertFence(line[pos:])
+	if !ok || name == "" {
+		return nil, parser.NoChildren
+	}
+	kind, known := alertKinds[strings.ToLower(name)]
+	n := &alertBlock{kind: kind, title: title}
+	if !known {
+		n.unknown = name
+	}
+	if n.title == "" {
+		n.title = alertTitles[kind]
+		if !known {
+			n.title = strings.ToUpper(name[:1]) + name[1:]
+		}
+	}
+	reader.AdvanceToEOL()
+	return n, parser.HasChildren
+}
+
+func (alertContainerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*alertBlock)
+	line, _ := reader.PeekLine()
+	if n.fence != "" {
+		// Nothing inside fenced code closes a container.
+		if t := bytes.TrimSpace(line); len(t) >= len(n.fence) && len(bytes.Trim(t, n.fence[:1])) == 0 {
+			n.fence = ""
+		}
+		return parser.Continue | parser.HasChildren
+	}
+	if fence := codeFence(line); fence != "" {
+		n.fence = fence
+		return parser.Continue | parser.HasChildren
+	}
+	name, _, ok := alertFence(line)
+	switch {
+	case ok && name != "":
+		// A nested container opens; its closing line is not ours.
+		n.depth++
+	case ok && n.depth > 0:
+		n.depth--
+	case ok:
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (alertContainerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (alertContainerParser) CanInterruptParagraph() bool { return true }
+
+func (alertContainerParser) CanAcceptIndentedLine() bool { return false }
+
+var alertMarkerRe = regexp.MustCompile(`(?i)^\[!(note|tip|important|warning|caution)\]$`)
+
+// alertQuoteTransformer replaces block quotes opening with [!KIND] on a
+// line of its own with alert blocks.
+type alertQuoteTransformer struct{}
+
+func (alertQuoteTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	src := reader.Source()
+	var quotes []*ast.Blockquote
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if q, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, q)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, q := range quotes {
+		para, ok := q.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		first := para.Lines().At(0)
+		m := alertMarkerRe.FindSubmatch(bytes.TrimSpace(first.Value(src)))
+		if m == nil {
+			continue
+		}
+		kind := alertKinds[strings.ToLower(string(m[1]))]
+		alert := &alertBlock{kind: kind, title: alertTitles[kind]}
+
+		// Drop the marker line from the first paragraph.
+		for c := para.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			if t, ok := c.(*ast.Text); !ok || t.Segment.Start >= first.Stop {
+				break
+			}
+			para.RemoveChild(para, c)
+			c = next
+		}
+		lines := text.NewSegments()
+		for i := 1; i < para.Lines().Len(); i++ {
+			lines.Append(para.Lines().At(i))
+		}
+		para.SetLines(lines)
+		if !para.HasChildren() {
+			q.RemoveChild(q, para)
+		}
+
+		for c := q.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			alert.AppendChild(alert, c)
+			c = next
+		}
+		q.Parent().ReplaceChild(q.Parent(), q, alert)
+	}
+}
+
+// renderAlert draws an alert between left and right: a bar in the kind's
+// color, an icon and bold title, then the body.
+func (r *renderer) renderAlert(n *alertBlock, md []byte, left, right int) {
+	if n.unknown != "" {
+		r.diagnose(n, md, "unknown alert kind %q drawn as a note", n.unknown)
+	}
+	col := r.c.th.Alerts.color(n.kind, r.c.th.QuoteBar)
+	st := r.c.th.Style.Blockquote
+	textLeft := left + r.c.em(st.Indent)
+	block := r.c.beginBlock(RoleAlert, left, right)
+	r.c.addVSpace(r.c.em(st.PaddingTop))
+	top := r.c.cursorY
+
+	iconSize := r.baseSize * 0.95
+	title := []textToken{{text: n.title, font: r.c.fonts.byRole(FontBold), size: r.baseSize, color: col}}
+	metrics := r.c.drawTokens(title, textLeft+int(iconSize*1.5), right)
+	if len(metrics) > 0 {
+		bottom := float64(metrics[0].baseline) + iconSize*0.1
+		r.c.add(&Box{
+			Kind: PathBox,
+			Rect: image.Rect(textLeft, int(bottom-iconSize), textLeft+int(math.Ceil(iconSize)), int(math.Ceil(bottom))),
+			Fill: col,
+			Path: alertIcon(n.kind, PathPoint{float64(textLeft), bottom - iconSize}, iconSize),
+		})
+	}
+
+	if n.HasChildren() {
+		r.c.addVSpace(r.c.em(r.c.th.Style.Alert.TitleGap))
+		r.renderBlocks(n, md, textLeft, right)
+	}
+	r.c.cursorY = contentBottom(block, top) + r.c.em(st.PaddingBottom)
+	r.c.fillRect(image.Rect(left, top, left+max(st.BarWidth, 0), r.c.cursorY), col)
+	r.c.endBlock(block)
+	r.c.addVSpace(r.c.em(r.c.th.Style.Paragraph.SpaceAfter))
+}
+
+// alertIcon returns the icon of an alert kind in a square of the given size
+// with its top left corner at o: an "i" in a circle for notes, a light bulb
+// for tips, a speech bubble for important alerts, a warning triangle and a
+// stop sign for cautions.
+func alertIcon(kind alertKind, o PathPoint, size float64) Path {
+	at := func(x, y float64) PathPoint { return PathPoint{o.X + x*size, o.Y + y*size} }
+	w := max(size*0.11, 1)
+	closed := func(pts ...PathPoint) Path {
+		return strokePolyline(append(pts, pts[0], pts[1]), w)
+	}
+	ring := func(c PathPoint, radius float64) Path {
+		return Path{circlePolygon(c, radius), reversePolygon(circlePolygon(c, radius-w))}
+	}
+	// bang is an exclamation mark from top to bottom, centered on x.
+	bang := func(x, top, bottom float64) Path {
+		dot := w * 0.65
+		return Path{
+			strokeSegment(at(x, top), at(x, bottom-0.2), w),
+			circlePolygon(at(x, bottom), dot),
+		}
+	}
+	var path Path
+	switch kind {
+	case alertNote:
+		path = append(ring(at(0.5, 0.5), size*0.48), strokeSegment(at(0.5, 0.45), at(0.5, 0.75), w),
+			circlePolygon(at(0.5, 0.29), w*0.65))
+	case alertTip:
+		path = append(ring(at(0.5, 0.38), size*0.36),
+			strokeSegment(at(0.34, 0.84), at(0.66, 0.84), w),
+			strokeSegment(at(0.4, 0.98), at(0.6, 0.98), w))
+	case alertImportant:
+		path = closed(at(0.06, 0.06), at(0.94, 0.06), at(0.94, 0.72), at(0.42, 0.72), at(0.18, 0.96), at(0.18, 0.72), at(0.06, 0.72))
+		path = append(path, bang(0.5, 0.2, 0.56)...)
+	case alertWarning:
+		path = closed(at(0.5, 0.04), at(0.98, 0.94), at(0.02, 0.94))
+		path = append(path, bang(0.5, 0.38, 0.8)...)
+	case alertCaution:
+		var pts []PathPoint
+		for i := 0; i < 8; i++ {
+			a := math.Pi/8 + float64(i)*math.Pi/4
+			pts = append(pts, at(0.5+0.47*math.Cos(a), 0.5+0.47*math.Sin(a)))
+		}
+		path = append(closed(pts...), bang(0.5, 0.24, 0.74)...)
+	}
+	return path
+}
+
+// circlePolygon approximates a circle, wound clockwise like rectPolygon.
+func circlePolygon(c PathPoint, radius float64) []PathPoint {
+	const n = 32
+	pts := make([]PathPoint, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / n
+		pts[i] = PathPoint{c.X + radius*math.Cos(a), c.Y + radius*math.Sin(a)}
+	}
+	return pts
+}
@@ -0,0 +1,159 @@
+package md2png
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestParseAlerts(t *testing.T) {
+	src := []byte("> [!warning]\n> Mind the gap.\n\n> [!NOTE] not alone\n\n::: tip Speed\nBody\n\n::: note\nInner\n:::\n\nStill tip\n:::\n\nAfter\n")
+	doc := parseMarkdown(src)
+	var alerts []*alertBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if a, ok := n.(*alertBlock); ok && entering {
+			alerts = append(alerts, a)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(alerts) != 3 {
+		t.Fatalf("expected 3 alerts, got %d", len(alerts))
+	}
+	if a := alerts[0]; a.kind != alertWarning || a.title != "Warning" || strings.TrimSpace(getNodeText(a.FirstChild(), src)) != "Mind the gap." {
+		t.Fatalf("unexpected GitHub alert: %q %q", a.title, getNodeText(a.FirstChild(), src))
+	}
+	if a := alerts[1]; a.kind != alertTip || a.title != "Speed" || a.ChildCount() != 3 {
+		t.Fatalf("expected the tip to hold a paragraph, the nested note and a paragraph, got %d children", a.ChildCount())
+	}
+	if a := alerts[2]; a.kind != alertNote || a.Parent() != alerts[1] {
+		t.Fatalf("expected the note nested in the tip")
+	}
+	if last := doc.LastChild(); last.Kind() != ast.KindParagraph || string(last.Lines().Value(src)) != "After" {
+		t.Fatalf("expected the paragraph after the container to survive")
+	}
+
+	// The closing ::: may end the file without a newline.
+	src = []byte("::: tip\nBody\n:::")
+	doc = parseMarkdown(src)
+	if a, ok := doc.FirstChild().(*alertBlock); !ok || doc.ChildCount() != 1 || string(a.FirstChild().Lines().Value(src)) != "Body" {
+		t.Fatalf("expected a single alert holding only its body at the end of the file")
+	}
+
+	// A ::: line inside fenced code neither opens nor closes a container.
+	src = []byte("::: note\n```\n:::\n```\n~~~~\n::: tip\n~~~~\nStill note\n:::\n\nAfter\n")
+	doc = parseMarkdown(src)
+	a, ok := doc.FirstChild().(*alertBlock)
+	if !ok || a.ChildCount() != 3 || doc.ChildCount() != 2 {
+		t.Fatalf("expected the note to hold two code blocks and a paragraph")
+	}
+	if last := doc.LastChild(); string(last.Lines().Value(src)) != "After" {
+		t.Fatalf("expected the paragraph after the container to survive")
+	}
+}
+
+func TestRenderAlerts(t *testing.T) {
+	th := LightTheme
+	th.Alerts.Caution = color.RGBA{0x12, 0x34, 0x56, 0xFF}
+	l, err := LayoutDocument([]byte("> [!CAUTION]\n> Hot surface.\n\n> Plain\n"), RenderOptions{Width: 640, Theme: th})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var alert *Box
+	var quotes int
+	l.Walk(func(b *Box) bool {
+		switch b.Role {
+		case RoleAlert:
+			alert = b
+		case RoleBlockquote:
+			quotes++
+		}
+		return true
+	})
+	if alert == nil || quotes != 1 {
+		t.Fatalf("expected one alert and one plain quote")
+	}
+	var title, body, icon, bar bool
+	var walk func(b *Box)
+	walk = func(b *Box) {
+		switch {
+		case b.Kind == GlyphRunBox && b.Run.Text == "Caution":
+			title = b.Run.Color == th.Alerts.Caution
+		case b.Kind == GlyphRunBox && b.Run.Text == "Hot surface.":
+			body = b.Run.Color == th.FG
+		case b.Kind == PathBox:
+			icon = b.Fill == th.Alerts.Caution
+		case b.Kind == RuleBox:
+			bar = b.Fill == th.Alerts.Caution
+		}
+		for _, c := range b.Children {
+			walk(c)
+		}
+	}
+	walk(alert)
+	if !title || !body || !icon || !bar {
+		t.Fatalf("expected title, icon and bar in the caution color over plain body text (%v %v %v %v)", title, body, icon, bar)
+	}
+}
+
+func TestUnknownAlertKinds(t *testing.T) {
+	var reported []Diagnostic
+	l, err := LayoutDocument([]byte("::: foo\nBody\n:::\n\n::: warning\nCareful\n:::\n"), RenderOptions{Width: 640, Diagnostics: func(d Diagnostic) {
+		reported = append(reported, d)
+	}})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	if len(l.Diagnostics) != 1 || len(reported) != 1 || !strings.Contains(l.Diagnostics[0].Message, `"foo"`) {
+		t.Fatalf("expected the unknown kind reported once, got %v", l.Diagnostics)
+	}
+}
+
+func TestAlertsFollowTheStyleSheet(t *testing.T) {
+	markdown := []byte("> [!NOTE]\n> Body.\n")
+	height := func(style StyleSheet) (alert, gap int) {
+		th := LightTheme
+		th.Style = style
+		l, err := LayoutDocument(markdown, RenderOptions{Width: 640, Theme: th})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		var title int
+		l.Walk(func(b *Box) bool {
+			switch {
+			case b.Role == RoleAlert:
+				alert = b.Rect.Dy()
+			case b.Kind == GlyphRunBox && b.Run.Text == "Note":
+				title = b.Run.Baseline
+			case b.Kind == GlyphRunBox && b.Run.Text == "Body.":
+				gap = b.Run.Baseline - title
+			}
+			return true
+		})
+		return alert, gap
+	}
+
+	defAlert, defGap := height(StyleSheet{})
+	var custom StyleSheet
+	custom.Blockquote.PaddingTop = 1
+	custom.Blockquote.PaddingBottom = 1
+	custom.Alert.TitleGap = 1
+	alert, gap := height(custom)
+	if got, want := alert-defAlert, (16-2)+(16-6)+(16-4); got != want {
+		t.Fatalf("expected the alert %dpx taller, got %d", want, got)
+	}
+	if got, want := gap-defGap, 16-4; got != want {
+		t.Fatalf("expected the body %dpx further below the title, got %d", want, got)
+	}
+}
+
+func TestLoadThemeAlerts(t *testing.T) {
+	th, err := LoadTheme(strings.NewReader("base: dark\nalerts:\n  tip: \"#00ff00\"\n"))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if th.Alerts.Tip != (color.RGBA{0, 0xFF, 0, 0xFF}) || th.Alerts.Note != darkAlerts.Note {
+		t.Fatalf("unexpected alert colors: %+v", th.Alerts)
+	}
+}
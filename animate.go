@@ -0,0 +1,403 @@
+package md2png
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+	"time"
+)
+
+// ---- Animation ----
+
+// Frame is one image of an animation and how long it stays on screen.
+type Frame struct {
+	Image image.Image
+	Delay time.Duration
+}
+
+// Animation is a sequence of frames. Loops is the number of times the
+// animation plays; zero repeats forever.
+type Animation struct {
+	Frames []Frame
+	Loops  int
+}
+
+// NewAnimation builds an animation from images. delays gives the delay of
+// each frame in turn; the last delay repeats for any remaining frames.
+func NewAnimation(images []*image.RGBA, delays ...time.Duration) Animation {
+	var anim Animation
+	for i, img := range images {
+		var delay time.Duration
+		if len(delays) > 0 {
+			delay = delays[min(i, len(delays)-1)]
+		}
+		anim.Frames = append(anim.Frames, Frame{Image: img, Delay: delay})
+	}
+	return anim
+}
+
+// RevealFrames paints a layout as a progressive reveal: the first frame shows
+// everything before the first list item, and each following frame uncovers
+// one more list item (nested items included) until the whole document is
+// visible.
+func RevealFrames(l *Layout) []*image.RGBA {
+	full := PaintRaster(l)
+	spans := l.unbreakableSpans()
+	var cuts []int
+	l.Walk(func(b *Box) bool {
+		if b.Kind == BlockBox && b.Role == RoleListItem {
+			cuts = append(cuts, revealCut(spans, b.Rect.Min.Y))
+		}
+		return true
+	})
+	sort.Ints(cuts)
+	var frames []*image.RGBA
+	last := -1
+	for _, cut := range cuts {
+		if cut == last {
+			continue
+		}
+		last = cut
+		frame := newBackground(l.Width, l.Height, l.Background)
+		draw.Draw(frame, image.Rect(0, 0, l.Width, cut), full, image.Point{}, draw.Src)
+		frames = append(frames, frame)
+	}
+	return append(frames, full)
+}
+
+// revealCut moves y to the middle of the gap between the lines around it, so
+// glyphs overhanging their line boxes are neither clipped nor uncovered early.
+func revealCut(spans []pageSlice, y int) int {
+	above, below := y, y
+	for _, s := range spans {
+		switch {
+		case s.bottom <= y:
+			above = s.bottom
+		case s.top < y:
+			return s.top
+		default:
+			below = s.top
+			return (above + below) / 2
+		}
+	}
+	return y
+}
+
+// EncodeGIF writes the animation as a GIF. All frames share one palette
+// built from the colors actually used, and are mapped to it without
+// dithering so anti-aliased text stays smooth.
+func EncodeGIF(w io.Writer, anim Animation) error {
+	if len(anim.Frames) == 0 {
+		return errors.New("md2png: animation has no frames")
+	}
+	bounds := animationBounds(anim)
+	pal := newPaletteBuilder()
+	for _, f := range anim.Frames {
+		pal.add(f.Image)
+	}
+	palette := pal.palette(256)
+	out := &gif.GIF{LoopCount: gifLoopCount(anim.Loops)}
+	for _, f := range anim.Frames {
+		pimg := image.NewPaletted(bounds, palette)
+		pal.mapInto(pimg, f.Image)
+		out.Image = append(out.Image, pimg)
+		out.Delay = append(out.Delay, int(f.Delay/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, out)
+}
+
+// gifLoopCount converts a play count to the GIF convention, where 0 loops
+// forever, -1 plays once and n repeats n extra times.
+func gifLoopCount(loops int) int {
+	switch {
+	case loops <= 0:
+		return 0
+	case loops == 1:
+		return -1
+	default:
+		return loops - 1
+	}
+}
+
+func animationBounds(anim Animation) image.Rectangle {
+	var r image.Rectangle
+	for _, f := range anim.Frames {
+		b := f.Image.Bounds()
+		r = r.Union(image.Rect(0, 0, b.Dx(), b.Dy()))
+	}
+	return r
+}
+
+// paletteBuilder accumulates a color histogram with 6 bits per channel,
+// keeping the exact color sums so palette entries average true colors.
+type paletteBuilder struct {
+	count   []uint32
+	sum     [][3]uint64
+	mapping []int16 // histogram bucket to palette index, -1 when unknown
+	colors  color.Palette
+}
+
+const paletteBits = 6
+
+func newPaletteBuilder() *paletteBuilder {
+	n := 1 << (3 * paletteBits)
+	return &paletteBuilder{count: make([]uint32, n), sum: make([][3]uint64, n)}
+}
+
+func paletteKey(r, g, b uint8) int {
+	const shift = 8 - paletteBits
+	return int(r>>shift)<<(2*paletteBits) | int(g>>shift)<<paletteBits | int(b>>shift)
+}
+
+func (p *paletteBuilder) add(img image.Image) {
+	eachPixel(img, func(_, _ int, c color.RGBA) {
+		k := paletteKey(c.R, c.G, c.B)
+		p.count[k]++
+		p.sum[k][0] += uint64(c.R)
+		p.sum[k][1] += uint64(c.G)
+		p.sum[k][2] += uint64(c.B)
+	})
+}
+
+// eachPixel calls fn with the color of every pixel of img, relative to the
+// image origin.
+func eachPixel(img image.Image, fn func(x, y int, c color.RGBA)) {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+			for x := 0; x < b.Dx(); x++ {
+				fn(x, y-b.Min.Y, color.RGBA{row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]})
+			}
+		}
+		return
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			fn(x-b.Min.X, y-b.Min.Y, color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+}
+
+// palette reduces the histogram to at most size colors by median cut.
+func (p *paletteBuilder) palette(size int) color.Palette {
+	var keys []int
+	for k, n := range p.count {
+		if n > 0 {
+			keys = append(keys, k)
+		}
+	}
+	boxes := [][]int{keys}
+	for len(boxes) < size {
+		// Split the box with the most pixels spread over the widest range.
+		best, bestScore, bestChannel := -1, uint64(0), 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			channel, spread := p.widestChannel(box)
+			var pixels uint64
+			for _, k := range box {
+				pixels += uint64(p.count[k])
+			}
+			if score := pixels * uint64(spread); score > bestScore {
+				best, bestScore, bestChannel = i, score, channel
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := p.split(boxes[best], bestChannel)
+		boxes[best] = a
+		boxes = append(boxes, b)
+	}
+	p.colors = make(color.Palette, 0, len(boxes))
+	p.mapping = make([]int16, len(p.count))
+	for i := range p.mapping {
+		p.mapping[i] = -1
+	}
+	for _, box := range boxes {
+		var n, r, g, b uint64
+		for _, k := range box {
+			n += uint64(p.count[k])
+			r += p.sum[k][0]
+			g += p.sum[k][1]
+			b += p.sum[k][2]
+		}
+		if n == 0 {
+			continue
+		}
+		idx := int16(len(p.colors))
+		p.colors = append(p.colors, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xFF})
+		for _, k := range box {
+			p.mapping[k] = idx
+		}
+	}
+	if len(p.colors) == 0 {
+		p.colors = append(p.colors, color.Black)
+	}
+	return p.colors
+}
+
+func channelOf(k, channel int) int {
+	return (k >> ((2 - channel) * paletteBits)) & (1<<paletteBits - 1)
+}
+
+func (p *paletteBuilder) widestChannel(box []int) (channel, spread int) {
+	for c := 0; c < 3; c++ {
+		lo, hi := 1<<paletteBits, -1
+		for _, k := range box {
+			v := channelOf(k, c)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > spread || c == 0 {
+			channel, spread = c, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+// split divides a box at the pixel-weighted median of channel.
+func (p *paletteBuilder) split(box []int, channel int) ([]int, []int) {
+	sort.Slice(box, func(i, j int) bool { return channelOf(box[i], channel) < channelOf(box[j], channel) })
+	var total, acc uint64
+	for _, k := range box {
+		total += uint64(p.count[k])
+	}
+	cut := 1
+	for i, k := range box[:len(box)-1] {
+		acc += uint64(p.count[k])
+		if acc*2 >= total {
+			cut = i + 1
+			break
+		}
+	}
+	return append([]int(nil), box[:cut]...), append([]int(nil), box[cut:]...)
+}
+
+// mapInto converts img to palette indices. Every pixel was counted by add,
+// so each lands in the palette entry its histogram bucket was merged into.
+func (p *paletteBuilder) mapInto(dst *image.Paletted, img image.Image) {
+	eachPixel(img, func(x, y int, c color.RGBA) {
+		k := paletteKey(c.R, c.G, c.B)
+		if p.mapping[k] < 0 {
+			p.mapping[k] = int16(p.colors.Index(c))
+		}
+		dst.Pix[y*dst.Stride+x] = uint8(p.mapping[k])
+	})
+}
+
+// EncodeAPNG writes the animation as an animated PNG. Frames keep full color;
+// viewers without APNG support show the first frame.
+func EncodeAPNG(w io.Writer, anim Animation) error {
+	if len(anim.Frames) == 0 {
+		return errors.New("md2png: animation has no frames")
+	}
+	bounds := animationBounds(anim)
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(bounds.Dy()))
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+	if err := writePNGChunk(bw, "IHDR", ihdr); err != nil {
+		return err
+	}
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(anim.Frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(max(anim.Loops, 0)))
+	if err := writePNGChunk(bw, "acTL", actl); err != nil {
+		return err
+	}
+	seq := uint32(0)
+	for i, f := range anim.Frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(bounds.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(bounds.Dy()))
+		ms := f.Delay.Milliseconds()
+		if ms > 0xFFFF {
+			ms = 0xFFFF
+		}
+		binary.BigEndian.PutUint16(fctl[20:], uint16(ms))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		seq++
+		if err := writePNGChunk(bw, "fcTL", fctl); err != nil {
+			return err
+		}
+		data, err := pngImageData(f.Image, bounds)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			err = writePNGChunk(bw, "IDAT", data)
+		} else {
+			fdat := make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			seq++
+			err = writePNGChunk(bw, "fdAT", append(fdat, data...))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := writePNGChunk(bw, "IEND", nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(hdr[4:])
+	_, _ = crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	for _, b := range [][]byte{hdr[:], data, sum[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pngImageData returns the compressed RGBA scanlines of img padded to bounds,
+// using the Up filter which suits images with long vertical runs of color.
+func pngImageData(img image.Image, bounds image.Rectangle) ([]byte, error) {
+	rgba := image.NewNRGBA(bounds)
+	draw.Draw(rgba, bounds, img, img.Bounds().Min, draw.Src)
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	stride := bounds.Dx() * 4
+	prev := make([]byte, stride)
+	line := make([]byte, stride+1)
+	for y := 0; y < bounds.Dy(); y++ {
+		row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+stride]
+		line[0] = 2 // Up
+		for i := range row {
+			line[i+1] = row[i] - prev[i]
+		}
+		if _, err := zw.Write(line); err != nil {
+			return nil, err
+		}
+		copy(prev, row)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
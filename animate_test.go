@@ -0,0 +1,127 @@
+package md2png
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestRevealFramesUncoverListItems(t *testing.T) {
+	l, err := LayoutDocument([]byte("# Steps\n\n- one\n- two\n  - nested\n- three\n"), RenderOptions{Width: 320})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	frames := RevealFrames(l)
+	if len(frames) != 5 {
+		t.Fatalf("expected a frame before each of 4 items plus the final frame, got %d", len(frames))
+	}
+	ink := func(i int) int {
+		n := 0
+		eachPixel(frames[i], func(_, _ int, c color.RGBA) {
+			if c.R != 0xFF {
+				n++
+			}
+		})
+		return n
+	}
+	for i := 1; i < len(frames); i++ {
+		if ink(i) <= ink(i-1) {
+			t.Fatalf("expected frame %d to reveal more than frame %d", i, i-1)
+		}
+	}
+}
+
+func TestEncodeGIFSharesPaletteAndTiming(t *testing.T) {
+	frames, err := RenderSlides([]byte("# One\n\n---\n\n# Two\n"), RenderOptions{Theme: DarkTheme}, SlideOptions{Width: 320, Height: 180})
+	if err != nil {
+		t.Fatalf("render slides failed: %v", err)
+	}
+	anim := NewAnimation(frames, time.Second, 2500*time.Millisecond)
+	anim.Loops = 3
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, anim); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(g.Image) != 2 || g.Delay[0] != 100 || g.Delay[1] != 250 || g.LoopCount != 2 {
+		t.Fatalf("unexpected frames %d, delays %v, loop count %d", len(g.Image), g.Delay, g.LoopCount)
+	}
+	if len(g.Image[0].Palette) != len(g.Image[1].Palette) {
+		t.Fatalf("expected frames to share one palette")
+	}
+	// The background must survive quantization exactly.
+	r, gr, b, _ := g.Image[0].At(0, 0).RGBA()
+	br, bg, bb, _ := DarkTheme.BG.RGBA()
+	if r != br || gr != bg || b != bb {
+		t.Fatalf("background changed by quantization: got %v", g.Image[0].At(0, 0))
+	}
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	frames, err := RenderSlides([]byte("# One\n\n---\n\n# Two\n\n---\n\n# Three\n"), RenderOptions{}, SlideOptions{Width: 200, Height: 100})
+	if err != nil {
+		t.Fatalf("render slides failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, NewAnimation(frames, 500*time.Millisecond)); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Viewers without APNG support decode the first frame as a plain PNG.
+	first, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if first.Bounds() != frames[0].Bounds() {
+		t.Fatalf("first frame has bounds %v", first.Bounds())
+	}
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			r1, g1, b1, _ := first.At(x, y).RGBA()
+			r2, g2, b2, _ := frames[0].At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				t.Fatalf("first frame differs at %d,%d", x, y)
+			}
+		}
+	}
+
+	var fctl, fdat int
+	var seq []uint32
+	for pos := 8; pos+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		body := data[pos+8 : pos+8+n]
+		switch typ {
+		case "acTL":
+			if binary.BigEndian.Uint32(body) != 3 {
+				t.Fatalf("expected 3 frames in acTL, got %d", binary.BigEndian.Uint32(body))
+			}
+		case "fcTL":
+			fctl++
+			seq = append(seq, binary.BigEndian.Uint32(body))
+			if delay := binary.BigEndian.Uint16(body[20:]); delay != 500 {
+				t.Fatalf("expected 500ms delay, got %d", delay)
+			}
+		case "fdAT":
+			fdat++
+			seq = append(seq, binary.BigEndian.Uint32(body))
+		}
+		pos += 12 + n
+	}
+	if fctl != 3 || fdat != 2 {
+		t.Fatalf("expected 3 fcTL and 2 fdAT chunks, got %d and %d", fctl, fdat)
+	}
+	for i, s := range seq {
+		if s != uint32(i) {
+			t.Fatalf("chunk sequence numbers out of order: %v", seq)
+		}
+	}
+}
@@ -3,46 +3,71 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/arran4/md2png"
 )
 
 func main() {
 	in := flag.String("in", "", "Input Markdown file (default: stdin if empty)")
-	out := flag.String("out", "out.png", "Output image file (.png, .jpg, or .gif)")
+	out := flag.String("out", "out.png", "Output file (.png, .jpg, .gif, .svg, or .pdf)")
 	width := flag.Int("width", 1024, "Output image width in pixels")
 	margin := flag.Int("margin", 48, "Margin in pixels")
 	pt := flag.Float64("pt", 16, "Base font size in points (paragraph)")
-	theme := flag.String("theme", "light", "Theme: light|dark")
+	theme := flag.String("theme", "light", "Theme: light|dark, or a path to a JSON or YAML theme file")
 	fontRegular := flag.String("font", "", "Path to TTF for regular text (optional; default Go Regular)")
 	fontBold := flag.String("fontbold", "", "Path to TTF for bold text (optional; default Go Bold)")
+	fontItalic := flag.String("fontitalic", "", "Path to TTF for italic text (optional; default Go Italic)")
+	fontBoldItalic := flag.String("fontbolditalic", "", "Path to TTF for bold italic text (optional; default Go Bold Italic)")
 	fontMono := flag.String("fontmono", "", "Path to TTF for mono/code (optional; default Go Mono)")
 	footnoteLinks := flag.Bool("footnote-links", true, "Add footnotes for link destinations")
 	footnoteImages := flag.Bool("footnote-images", false, "Add footnotes for image destinations")
+	pageSize := flag.String("page-size", "a4", "PDF page size: a4|letter")
+	pageMargin := flag.Float64("page-margin", 36, "PDF page margin in points")
+	slides := flag.Bool("slides", false, "Render a slide deck: one frame per --- or H1/H2 (numbered images, or an animated .gif)")
+	slideSize := flag.String("slide-size", "1920x1080", "Slide frame size as WIDTHxHEIGHT")
+	reveal := flag.Bool("reveal", false, "Render a progressive reveal: one frame per list item (numbered images, or an animated .gif)")
+	frameDelay := flag.String("frame-delay", "3", "Seconds each animation frame is shown; a comma-separated list sets each frame in turn, the last repeating")
+	loop := flag.Int("loop", 0, "Number of times an animation plays (0 = forever)")
+	apng := flag.Bool("apng", false, "Write slides or reveal frames to a .png output as one animated PNG")
+	pageHeight := flag.Int("page-height", 0, "Split raster output into pages of this height in pixels (writes out-001.png, out-002.png, ...)")
+	tableOverflow := flag.String("table-overflow", "wrap", "How tables too wide for the page fit: wrap|shrink|cards|widen|split")
+	maxImageHeight := flag.Int("max-image-height", 0, "Scale images down to at most this many pixels tall (0 = no limit)")
+	upscaleImages := flag.Bool("upscale-images", false, "Scale images narrower than the text up to its width")
 	flag.Parse()
 
-	th, err := md2png.ThemeByName(*theme)
+	th, err := loadTheme(*theme)
 	if err != nil {
 		fatal(err)
 	}
 
 	fonts, err := md2png.LoadFonts(md2png.FontConfig{
-		RegularPath: *fontRegular,
-		BoldPath:    *fontBold,
-		MonoPath:    *fontMono,
-		SizeBase:    *pt,
+		RegularPath:    *fontRegular,
+		BoldPath:       *fontBold,
+		ItalicPath:     *fontItalic,
+		BoldItalicPath: *fontBoldItalic,
+		MonoPath:       *fontMono,
+		SizeBase:       *pt,
 	})
 	if err != nil {
 		fatal(err)
 	}
 
+	overflow, err := md2png.TableOverflowByName(*tableOverflow)
+	if err != nil {
+		fatal(err)
+	}
+
 	var data []byte
 	var baseDir string
 	if *in == "" {
@@ -66,7 +91,7 @@ func main() {
 		fatal(err)
 	}
 
-	img, err := md2png.Render(data, md2png.RenderOptions{
+	opts := md2png.RenderOptions{
 		Width:          *width,
 		Margin:         *margin,
 		BaseFontSize:   *pt,
@@ -75,34 +100,187 @@ func main() {
 		LinkFootnotes:  footnoteLinks,
 		ImageFootnotes: footnoteImages,
 		BaseDir:        baseDir,
-	})
-	if err != nil {
-		fatal(err)
-	}
-
-	file, err := os.Create(*out)
-	if err != nil {
-		fatal(err)
+		TableOverflow:  overflow,
+		MaxImageHeight: *maxImageHeight,
+		UpscaleImages:  *upscaleImages,
+		Diagnostics: func(d md2png.Diagnostic) {
+			_, _ = os.Stderr.WriteString("md2png: warning: " + d.String() + "\n")
+		},
 	}
-	defer func() { _ = file.Close() }()
 
 	ext := strings.ToLower(filepath.Ext(*out))
+	if *apng && (!*slides && !*reveal || ext != ".png") {
+		fatal(errors.New("-apng needs -slides or -reveal and a .png output"))
+	}
+	if (ext == ".pdf" || ext == ".svg") && (*slides || *reveal || *pageHeight > 0) {
+		fatal(errors.New("-slides, -reveal and -page-height need raster output, not " + ext))
+	}
 	switch ext {
-	case ".png":
-		if err := png.Encode(file, img); err != nil {
+	case ".pdf":
+		size, err := md2png.PageSizeByName(*pageSize)
+		if err != nil {
 			fatal(err)
 		}
-	case ".jpg", ".jpeg":
-		if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 92}); err != nil {
+		popts := md2png.PDFOptions{PageSize: size, Margin: *pageMargin}
+		if err := writeFile(*out, func(w io.Writer) error { return md2png.RenderPDF(w, data, opts, popts) }); err != nil {
 			fatal(err)
 		}
-	case ".gif":
-		if err := gif.Encode(file, img, nil); err != nil {
+		return
+	case ".svg":
+		if err := writeFile(*out, func(w io.Writer) error { return md2png.RenderSVG(w, data, opts) }); err != nil {
 			fatal(err)
 		}
+		return
+	case ".png", ".jpg", ".jpeg", ".gif":
 	default:
 		fatal(errors.New("unsupported output extension: " + ext))
 	}
+
+	if *slides && *reveal {
+		fatal(errors.New("-slides and -reveal cannot be combined"))
+	}
+	if *slides || *reveal {
+		var frames []*image.RGBA
+		if *slides {
+			var sopts md2png.SlideOptions
+			if !flagSet("margin") {
+				// Let the slide renderer size the margin to the frame.
+				opts.Margin = 0
+			}
+			if _, err := fmt.Sscanf(strings.ToLower(*slideSize), "%dx%d", &sopts.Width, &sopts.Height); err != nil {
+				fatal(fmt.Errorf("invalid -slide-size %q: %w", *slideSize, err))
+			}
+			frames, err = md2png.RenderSlides(data, opts, sopts)
+		} else {
+			var l *md2png.Layout
+			l, err = md2png.LayoutDocument(data, opts)
+			if err == nil {
+				frames = md2png.RevealFrames(l)
+			}
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if len(frames) == 0 {
+			fatal(errors.New("no slides found in input"))
+		}
+		delays, err := parseDelays(*frameDelay)
+		if err != nil {
+			fatal(err)
+		}
+		anim := md2png.NewAnimation(frames, delays...)
+		anim.Loops = *loop
+		switch {
+		case ext == ".gif":
+			err = writeFile(*out, func(w io.Writer) error { return md2png.EncodeGIF(w, anim) })
+		case ext == ".png" && *apng:
+			err = writeFile(*out, func(w io.Writer) error { return md2png.EncodeAPNG(w, anim) })
+		default:
+			for i, frame := range frames {
+				if err = writeFile(pagePath(*out, i+1), func(w io.Writer) error { return encodeImage(w, ext, frame) }); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *pageHeight > 0 {
+		opts.PageHeight = *pageHeight
+		pages, err := md2png.RenderPages(data, opts)
+		if err != nil {
+			fatal(err)
+		}
+		for i, page := range pages {
+			if err := writeFile(pagePath(*out, i+1), func(w io.Writer) error { return encodeImage(w, ext, page) }); err != nil {
+				fatal(err)
+			}
+		}
+		return
+	}
+
+	img, err := md2png.Render(data, opts)
+	if err != nil {
+		fatal(err)
+	}
+	if err := writeFile(*out, func(w io.Writer) error { return encodeImage(w, ext, img) }); err != nil {
+		fatal(err)
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func encodeImage(w io.Writer, ext string, img image.Image) error {
+	switch ext {
+	case ".png":
+		return png.Encode(w, img)
+	case ".jpg", ".jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 92})
+	case ".gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return errors.New("unsupported output extension: " + ext)
+	}
+}
+
+// loadTheme returns the built-in theme called name, or reads name as a theme
+// file when there is no such theme.
+func loadTheme(name string) (md2png.Theme, error) {
+	th, err := md2png.ThemeByName(name)
+	if err == nil {
+		return th, nil
+	}
+	f, openErr := os.Open(name)
+	if errors.Is(openErr, os.ErrNotExist) {
+		return th, err
+	} else if openErr != nil {
+		return th, openErr
+	}
+	defer func() { _ = f.Close() }()
+	return md2png.LoadTheme(f)
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseDelays parses a comma-separated list of frame delays in seconds.
+func parseDelays(list string) ([]time.Duration, error) {
+	var delays []time.Duration
+	for _, field := range strings.Split(list, ",") {
+		secs, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || secs < 0 {
+			return nil, fmt.Errorf("invalid -frame-delay %q", list)
+		}
+		delays = append(delays, time.Duration(secs*float64(time.Second)))
+	}
+	return delays, nil
+}
+
+// pagePath numbers an output path for one page: out.png becomes out-001.png.
+func pagePath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), n, ext)
 }
 
 func fatal(err error) {
@@ -0,0 +1,486 @@
+package md2png
+
+import (
+	"image/color"
+	"strings"
+)
+
+// ---- Syntax highlighting ----
+
+// SyntaxTheme colors the tokens of highlighted fenced code blocks. A nil
+// color draws that kind of token in the theme's FG.
+type SyntaxTheme struct {
+	Keyword  color.Color
+	String   color.Color
+	Number   color.Color
+	Comment  color.Color
+	Type     color.Color
+	Literal  color.Color // true, false, nil and friends
+	Key      color.Color // object keys in JSON and YAML
+	Inserted color.Color // added lines in diffs
+	Deleted  color.Color // removed lines in diffs
+	Meta     color.Color // diff hunk headers, shell variables, YAML anchors
+}
+
+var (
+	lightSyntax = SyntaxTheme{
+		Keyword:  color.RGBA{0xCF, 0x22, 0x2E, 0xFF},
+		String:   color.RGBA{0x0A, 0x30, 0x69, 0xFF},
+		Number:   color.RGBA{0x05, 0x50, 0xAE, 0xFF},
+		Comment:  color.RGBA{0x6E, 0x77, 0x81, 0xFF},
+		Type:     color.RGBA{0x95, 0x38, 0x00, 0xFF},
+		Literal:  color.RGBA{0x05, 0x50, 0xAE, 0xFF},
+		Key:      color.RGBA{0x11, 0x63, 0x29, 0xFF},
+		Inserted: color.RGBA{0x11, 0x63, 0x29, 0xFF},
+		Deleted:  color.RGBA{0x82, 0x07, 0x1E, 0xFF},
+		Meta:     color.RGBA{0x82, 0x50, 0xDF, 0xFF},
+	}
+	darkSyntax = SyntaxTheme{
+		Keyword:  color.RGBA{0xFF, 0x7B, 0x72, 0xFF},
+		String:   color.RGBA{0xA5, 0xD6, 0xFF, 0xFF},
+		Number:   color.RGBA{0x79, 0xC0, 0xFF, 0xFF},
+		Comment:  color.RGBA{0x8B, 0x94, 0x9E, 0xFF},
+		Type:     color.RGBA{0xFF, 0xA6, 0x57, 0xFF},
+		Literal:  color.RGBA{0x79, 0xC0, 0xFF, 0xFF},
+		Key:      color.RGBA{0x7E, 0xE7, 0x87, 0xFF},
+		Inserted: color.RGBA{0x7E, 0xE7, 0x87, 0xFF},
+		Deleted:  color.RGBA{0xFF, 0xA1, 0x98, 0xFF},
+		Meta:     color.RGBA{0xD2, 0xA8, 0xFF, 0xFF},
+	}
+)
+
+type tokenKind int
+
+const (
+	tokText tokenKind = iota
+	tokKeyword
+	tokString
+	tokNumber
+	tokComment
+	tokType
+	tokLiteral
+	tokKey
+	tokInserted
+	tokDeleted
+	tokMeta
+)
+
+// color returns the color for a token kind, falling back to fg.
+func (s SyntaxTheme) color(kind tokenKind, fg color.Color) color.Color {
+	var c color.Color
+	switch kind {
+	case tokKeyword:
+		c = s.Keyword
+	case tokString:
+		c = s.String
+	case tokNumber:
+		c = s.Number
+	case tokComment:
+		c = s.Comment
+	case tokType:
+		c = s.Type
+	case tokLiteral:
+		c = s.Literal
+	case tokKey:
+		c = s.Key
+	case tokInserted:
+		c = s.Inserted
+	case tokDeleted:
+		c = s.Deleted
+	case tokMeta:
+		c = s.Meta
+	}
+	if c == nil {
+		return fg
+	}
+	return c
+}
+
+// codeSpan is a piece of source text with a single token kind. Spans never
+// contain a newline.
+type codeSpan struct {
+	text string
+	kind tokenKind
+}
+
+// syntax describes a C-like language well enough to color it: words, comments
+// and string delimiters.
+type syntax struct {
+	keywords     []string
+	types        []string
+	literals     []string
+	lineComment  string
+	blockComment [2]string
+	quotes       string // string delimiters that honor backslash escapes
+	rawQuotes    string // string delimiters without escapes, may span lines
+	tripleQuotes bool   // Python's """ and ''' strings
+	variables    bool   // shell $name and ${name}
+	keys         bool   // a string followed by ':' is an object key
+
+	words map[string]tokenKind
+}
+
+var (
+	goSyntax = &syntax{
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+			"for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return",
+			"select", "struct", "switch", "type", "var"},
+		types: []string{"any", "bool", "byte", "comparable", "complex64", "complex128", "error", "float32", "float64",
+			"int", "int8", "int16", "int32", "int64", "rune", "string", "uint", "uint8", "uint16", "uint32",
+			"uint64", "uintptr"},
+		literals:     []string{"true", "false", "nil", "iota"},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+	}
+	pythonSyntax = &syntax{
+		keywords: []string{"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del",
+			"elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda",
+			"nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "match", "case"},
+		types:        []string{"bool", "bytes", "dict", "float", "int", "list", "object", "set", "str", "tuple", "self"},
+		literals:     []string{"True", "False", "None"},
+		lineComment:  "#",
+		quotes:       `"'`,
+		tripleQuotes: true,
+	}
+	shellSyntax = &syntax{
+		keywords: []string{"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done", "case",
+			"esac", "in", "function", "return", "local", "export", "readonly", "set", "unset", "exit", "source"},
+		literals:    []string{"true", "false"},
+		lineComment: "#",
+		quotes:      `"`,
+		rawQuotes:   "'",
+		variables:   true,
+	}
+	jsonSyntax = &syntax{
+		literals: []string{"true", "false", "null"},
+		quotes:   `"`,
+		keys:     true,
+	}
+	jsSyntax = &syntax{
+		keywords: []string{"async", "await", "break", "case", "catch", "class", "const", "continue", "debugger",
+			"default", "delete", "do", "else", "export", "extends", "finally", "for", "from", "function", "if",
+			"import", "in", "instanceof", "interface", "let", "new", "of", "return", "static", "switch", "throw",
+			"try", "type", "typeof", "var", "void", "while", "with", "yield", "enum", "implements"},
+		types:        []string{"any", "boolean", "never", "number", "object", "string", "symbol", "unknown", "bigint"},
+		literals:     []string{"true", "false", "null", "undefined", "this", "super", "NaN", "Infinity"},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+	}
+	cSyntax = &syntax{
+		keywords: []string{"break", "case", "catch", "class", "const", "continue", "default", "delete", "do",
+			"else", "enum", "extends", "extern", "final", "finally", "for", "goto", "if", "implements", "import",
+			"inline", "namespace", "new", "package", "private", "protected", "public", "return", "sizeof",
+			"static", "struct", "switch", "template", "throw", "throws", "try", "typedef", "typename", "union",
+			"using", "virtual", "volatile", "while", "#include", "#define", "#ifdef", "#ifndef", "#endif", "#if", "#else"},
+		types: []string{"auto", "bool", "boolean", "byte", "char", "double", "float", "int", "long", "short",
+			"signed", "size_t", "String", "unsigned", "void", "int8_t", "int16_t", "int32_t", "int64_t",
+			"uint8_t", "uint16_t", "uint32_t", "uint64_t"},
+		literals:     []string{"true", "false", "null", "nullptr", "NULL", "this"},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+	}
+	rustSyntax = &syntax{
+		keywords: []string{"as", "async", "await", "break", "const", "continue", "crate", "dyn", "else", "enum",
+			"extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub",
+			"ref", "return", "static", "struct", "trait", "type", "unsafe", "use", "where", "while"},
+		types: []string{"bool", "char", "f32", "f64", "i8", "i16", "i32", "i64", "i128", "isize", "str", "u8",
+			"u16", "u32", "u64", "u128", "usize", "String", "Vec", "Option", "Result", "Box", "Self"},
+		literals:     []string{"true", "false", "self", "None", "Some", "Ok", "Err"},
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"`,
+	}
+)
+
+// syntaxByLanguage maps fenced code info strings to their syntax. YAML and
+// diffs are line oriented and handled separately.
+var syntaxByLanguage = map[string]*syntax{
+	"go": goSyntax, "golang": goSyntax,
+	"python": pythonSyntax, "py": pythonSyntax, "python3": pythonSyntax,
+	"bash": shellSyntax, "sh": shellSyntax, "shell": shellSyntax, "zsh": shellSyntax, "console": shellSyntax,
+	"json": jsonSyntax, "jsonc": jsonSyntax,
+	"javascript": jsSyntax, "js": jsSyntax, "typescript": jsSyntax, "ts": jsSyntax, "jsx": jsSyntax, "tsx": jsSyntax,
+	"c": cSyntax, "h": cSyntax, "cpp": cSyntax, "c++": cSyntax, "java": cSyntax, "csharp": cSyntax, "cs": cSyntax,
+	"rust": rustSyntax, "rs": rustSyntax,
+}
+
+// highlightCode splits code into colored spans for the language named by a
+// fenced code block's info string. It returns nil for unknown languages.
+func highlightCode(lang, text string) []codeSpan {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, " {"); i >= 0 {
+		lang = lang[:i]
+	}
+	switch lang {
+	case "yaml", "yml":
+		return highlightLines(text, yamlLine)
+	case "diff", "patch":
+		return highlightLines(text, diffLine)
+	}
+	if s, ok := syntaxByLanguage[lang]; ok {
+		return s.highlight(text)
+	}
+	return nil
+}
+
+// Word tables are built once, before any render can read them concurrently.
+func init() {
+	for _, s := range syntaxByLanguage {
+		if s.words == nil {
+			s.words = s.wordKinds()
+		}
+	}
+}
+
+// wordKinds maps each of the syntax's words to its token kind.
+func (s *syntax) wordKinds() map[string]tokenKind {
+	words := make(map[string]tokenKind)
+	for _, w := range s.keywords {
+		words[w] = tokKeyword
+	}
+	for _, w := range s.types {
+		words[w] = tokType
+	}
+	for _, w := range s.literals {
+		words[w] = tokLiteral
+	}
+	return words
+}
+
+func (s *syntax) highlight(text string) []codeSpan {
+	var spans spanList
+	for i := 0; i < len(text); {
+		ch := text[i]
+		rest := text[i:]
+		atWord := i == 0 || !isWordByte(text[i-1])
+		switch {
+		case s.blockComment[0] != "" && strings.HasPrefix(rest, s.blockComment[0]):
+			n := len(s.blockComment[0])
+			if end := strings.Index(rest[n:], s.blockComment[1]); end >= 0 {
+				n += end + len(s.blockComment[1])
+			} else {
+				n = len(rest)
+			}
+			spans.add(rest[:n], tokComment)
+			i += n
+		case s.lineComment != "" && strings.HasPrefix(rest, s.lineComment) &&
+			(s.lineComment != "#" || i == 0 || text[i-1] == ' ' || text[i-1] == '\t' || text[i-1] == '\n'):
+			// A # only starts a comment at the start of a word, so $# and
+			// url#fragment stay intact.
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			spans.add(rest[:n], tokComment)
+			i += n
+		case s.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`)):
+			n := 3
+			if end := strings.Index(rest[3:], rest[:3]); end >= 0 {
+				n += end + 3
+			} else {
+				n = len(rest)
+			}
+			spans.add(rest[:n], tokString)
+			i += n
+		case strings.IndexByte(s.quotes, ch) >= 0:
+			n := scanString(rest, true)
+			kind := tokString
+			if s.keys && strings.HasPrefix(strings.TrimLeft(rest[n:], " \t"), ":") {
+				kind = tokKey
+			}
+			spans.add(rest[:n], kind)
+			i += n
+		case strings.IndexByte(s.rawQuotes, ch) >= 0:
+			n := scanString(rest, false)
+			spans.add(rest[:n], tokString)
+			i += n
+		case s.variables && ch == '$' && len(rest) > 1:
+			n := scanVariable(rest)
+			spans.add(rest[:n], tokMeta)
+			i += n
+		case atWord && isDigit(ch):
+			n := 1
+			for n < len(rest) && (isWordByte(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			spans.add(rest[:n], tokNumber)
+			i += n
+		case isWordByte(ch) || (ch == '#' && atWord && len(rest) > 1 && isWordByte(rest[1])):
+			n := 1
+			for n < len(rest) && isWordByte(rest[n]) {
+				n++
+			}
+			kind, ok := s.words[rest[:n]]
+			if !ok {
+				kind = tokText
+			}
+			spans.add(rest[:n], kind)
+			i += n
+		default:
+			spans.add(rest[:1], tokText)
+			i++
+		}
+	}
+	return spans.spans
+}
+
+// scanString returns the length of the quoted string at the start of s. With
+// escapes, a backslash protects the next byte and the string ends at the end
+// of the line if unterminated; without, it runs to the closing quote.
+func scanString(s string, escapes bool) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case escapes && s[i] == '\\':
+			i++
+		case escapes && s[i] == '\n':
+			return i
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func scanVariable(s string) int {
+	if s[1] == '{' {
+		if end := strings.IndexByte(s, '}'); end > 0 {
+			return end + 1
+		}
+		return len(s)
+	}
+	n := 1
+	for n < len(s) && isWordByte(s[n]) {
+		n++
+	}
+	if n == 1 && strings.IndexByte("#?@*$!-0123456789", s[1]) >= 0 {
+		n = 2
+	}
+	return n
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+func isWordByte(b byte) bool {
+	return b == '_' || isDigit(b) || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b >= 0x80
+}
+
+// highlightLines colors line-oriented formats one line at a time.
+func highlightLines(text string, line func(string, *spanList)) []codeSpan {
+	var spans spanList
+	for i, ln := range strings.Split(text, "\n") {
+		if i > 0 {
+			spans.add("\n", tokText)
+		}
+		line(ln, &spans)
+	}
+	return spans.spans
+}
+
+func diffLine(ln string, spans *spanList) {
+	switch {
+	case strings.HasPrefix(ln, "+++"), strings.HasPrefix(ln, "---"), strings.HasPrefix(ln, "@@"),
+		strings.HasPrefix(ln, "diff "), strings.HasPrefix(ln, "index "):
+		spans.add(ln, tokMeta)
+	case strings.HasPrefix(ln, "+"):
+		spans.add(ln, tokInserted)
+	case strings.HasPrefix(ln, "-"):
+		spans.add(ln, tokDeleted)
+	default:
+		spans.add(ln, tokText)
+	}
+}
+
+func yamlLine(ln string, spans *spanList) {
+	body := strings.TrimLeft(ln, " \t")
+	spans.add(ln[:len(ln)-len(body)], tokText)
+	if body == "---" || body == "..." {
+		spans.add(body, tokMeta)
+		return
+	}
+	if strings.HasPrefix(body, "#") {
+		spans.add(body, tokComment)
+		return
+	}
+	for strings.HasPrefix(body, "- ") {
+		spans.add("- ", tokText)
+		body = body[2:]
+	}
+	if !strings.HasPrefix(body, `"`) && !strings.HasPrefix(body, "'") {
+		if colon := strings.Index(body, ":"); colon > 0 && (colon == len(body)-1 || body[colon+1] == ' ') {
+			spans.add(body[:colon], tokKey)
+			spans.add(":", tokText)
+			body = body[colon+1:]
+		}
+	}
+	value := body
+	comment := ""
+	if i := strings.Index(value, " #"); i >= 0 && !strings.ContainsAny(value[:i], `"'`) {
+		value, comment = value[:i], value[i:]
+	}
+	trimmed := strings.TrimSpace(value)
+	lead := value[:strings.Index(value, trimmed)]
+	spans.add(lead, tokText)
+	switch {
+	case trimmed == "":
+	case trimmed[0] == '"' || trimmed[0] == '\'':
+		spans.add(trimmed, tokString)
+	case trimmed[0] == '&' || trimmed[0] == '*' || trimmed[0] == '!' || trimmed == "|" || trimmed == ">":
+		spans.add(trimmed, tokMeta)
+	case isDigit(trimmed[0]) || (len(trimmed) > 1 && trimmed[0] == '-' && isDigit(trimmed[1])):
+		spans.add(trimmed, tokNumber)
+	default:
+		switch strings.ToLower(trimmed) {
+		case "true", "false", "yes", "no", "on", "off", "null", "~":
+			spans.add(trimmed, tokLiteral)
+		default:
+			spans.add(trimmed, tokText)
+		}
+	}
+	spans.add(value[len(lead)+len(trimmed):], tokText)
+	spans.add(comment, tokComment)
+}
+
+// spanList collects spans, merging neighbours of the same kind and splitting
+// at newlines so every span stays on one line.
+type spanList struct {
+	spans []codeSpan
+}
+
+func (l *spanList) add(text string, kind tokenKind) {
+	for text != "" {
+		piece := text
+		if nl := strings.IndexByte(text, '\n'); nl >= 0 {
+			if nl == 0 {
+				l.spans = append(l.spans, codeSpan{"\n", tokText})
+				text = text[1:]
+				continue
+			}
+			piece = text[:nl]
+		}
+		text = text[len(piece):]
+		if n := len(l.spans); n > 0 && l.spans[n-1].kind == kind && l.spans[n-1].text != "\n" {
+			l.spans[n-1].text += piece
+		} else {
+			l.spans = append(l.spans, codeSpan{piece, kind})
+		}
+	}
+}
+
+// codeLines splits spans into one slice per source line.
+func codeLines(spans []codeSpan) [][]codeSpan {
+	lines := [][]codeSpan{nil}
+	for _, s := range spans {
+		if s.text == "\n" {
+			lines = append(lines, nil)
+			continue
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], s)
+	}
+	return lines
+}
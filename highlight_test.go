@@ -0,0 +1,103 @@
+package md2png
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHighlightCode(t *testing.T) {
+	kinds := func(lang, code string) map[string]tokenKind {
+		out := make(map[string]tokenKind)
+		for _, s := range highlightCode(lang, code) {
+			out[strings.TrimSpace(s.text)] = s.kind
+		}
+		return out
+	}
+
+	goKinds := kinds("go", "func f() error {\n\treturn nil // done\n}\ns := `raw\nstring`")
+	for text, want := range map[string]tokenKind{"func": tokKeyword, "error": tokType, "nil": tokLiteral, "// done": tokComment, "`raw": tokString} {
+		if got := goKinds[text]; got != want {
+			t.Fatalf("go: expected %q to be kind %d, got %d", text, want, got)
+		}
+	}
+	jsonKinds := kinds("json", `{"name": "md2png", "n": 3, "ok": true}`)
+	if jsonKinds[`"name"`] != tokKey || jsonKinds[`"md2png"`] != tokString || jsonKinds["3"] != tokNumber || jsonKinds["true"] != tokLiteral {
+		t.Fatalf("json: unexpected kinds %v", jsonKinds)
+	}
+	shKinds := kinds("bash", "echo $HOME # home\necho $#")
+	if shKinds["$HOME"] != tokMeta || shKinds["# home"] != tokComment || shKinds["$#"] != tokMeta {
+		t.Fatalf("bash: unexpected kinds %v", shKinds)
+	}
+	yamlKinds := kinds("yaml", "server:\n  port: 8080 # web\n  name: \"x\"")
+	if yamlKinds["server"] != tokKey || yamlKinds["8080"] != tokNumber || yamlKinds["# web"] != tokComment || yamlKinds[`"x"`] != tokString {
+		t.Fatalf("yaml: unexpected kinds %v", yamlKinds)
+	}
+	diffKinds := kinds("diff", "@@ -1 +1 @@\n-old\n+new")
+	if diffKinds["@@ -1 +1 @@"] != tokMeta || diffKinds["-old"] != tokDeleted || diffKinds["+new"] != tokInserted {
+		t.Fatalf("diff: unexpected kinds %v", diffKinds)
+	}
+
+	if spans := highlightCode("brainfuck", "+++"); spans != nil {
+		t.Fatalf("expected no highlighting for unknown languages, got %v", spans)
+	}
+	// Spans must reproduce the source exactly.
+	src := "def f(x):\n    \"\"\"doc\n    more\"\"\"\n    return x  # hi\n"
+	var b strings.Builder
+	for _, s := range highlightCode("python", src) {
+		b.WriteString(s.text)
+	}
+	if b.String() != src {
+		t.Fatalf("spans do not reproduce the source: %q", b.String())
+	}
+}
+
+func TestHighlightCodeConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, lang := range []string{"go", "python", "rust", "js"} {
+				if spans := highlightCode(lang, "return true"); len(spans) == 0 || spans[0].kind != tokKeyword {
+					t.Errorf("%s: expected return highlighted as a keyword, got %v", lang, spans)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFencedCodeUsesThemeSyntaxColors(t *testing.T) {
+	markdown := "```go\npackage main // " + strings.Repeat("long comment ", 10) + "\n```\n\n```\npackage main\n```\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 320})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var keywords, plain, comments int
+	var text strings.Builder
+	l.Walk(func(b *Box) bool {
+		if b.Kind != GlyphRunBox || b.Run.Text == "" {
+			return true
+		}
+		switch b.Run.Color {
+		case LightTheme.Syntax.Keyword:
+			keywords++
+		case LightTheme.Syntax.Comment:
+			comments++
+			text.WriteString(b.Run.Text)
+		case LightTheme.FG:
+			plain++
+		}
+		return true
+	})
+	if keywords != 1 {
+		t.Fatalf("expected the fenced go block to color one keyword, got %d", keywords)
+	}
+	if plain < 2 {
+		t.Fatalf("expected the unlabelled block to stay in the foreground color")
+	}
+	if comments < 2 || !strings.Contains(text.String(), "long comment long") {
+		t.Fatalf("expected the comment to stay colored across wrapped lines, got %d runs: %q", comments, text.String())
+	}
+}
@@ -0,0 +1,492 @@
+package md2png
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// ---- Raw HTML ----
+
+// READMEs lean on a handful of HTML tags that Markdown has no syntax for.
+// Those are mapped onto the token and block drawing used for Markdown:
+//
+//	<details>, <summary>       always drawn open, the summary in bold
+//	<p>, <div>, <center>, <h1>-<h6>
+//	                           blocks; align="center" centers their lines
+//	<br>, <hr>, <img width height>
+//	<kbd>, <sup>, <sub>, <b>, <strong>, <i>, <em>, <code>, <s>, <del>,
+//	<u>, <ins>, <a href>, <span>
+//
+// A block may enclose Markdown when its closing tag comes in a later HTML
+// block; one never closed ends with its own HTML block.
+//
+// Any other tag is drawn as a warning, as unsupported Markdown is.
+
+// htmlTag is a parsed start or end tag.
+type htmlTag struct {
+	name  string // lower case
+	end   bool   // </name>
+	void  bool   // <name/>, or an element without content such as br
+	attrs map[string]string
+}
+
+var (
+	htmlTagRe  = regexp.MustCompile(`^<(/?)([A-Za-z][A-Za-z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*(/?)>`)
+	htmlAttrRe = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+)
+
+var htmlVoid = map[string]bool{"br": true, "hr": true, "img": true, "wbr": true, "input": true, "meta": true, "link": true}
+
+// parseHTMLTag parses the tag at the start of s and returns its length.
+func parseHTMLTag(s string) (htmlTag, int, bool) {
+	m := htmlTagRe.FindStringSubmatch(s)
+	if m == nil {
+		return htmlTag{}, 0, false
+	}
+	tag := htmlTag{name: strings.ToLower(m[2]), end: m[1] == "/", attrs: map[string]string{}}
+	tag.void = m[4] == "/" || htmlVoid[tag.name]
+	for _, a := range htmlAttrRe.FindAllStringSubmatch(m[3], -1) {
+		tag.attrs[strings.ToLower(a[1])] = html.UnescapeString(a[2] + a[3] + a[4])
+	}
+	return tag, len(m[0]), true
+}
+
+// htmlPiece is a run of text or a tag of an HTML fragment.
+type htmlPiece struct {
+	text string
+	tag  *htmlTag
+}
+
+// splitHTML breaks src into text and tags, dropping comments. Text has its
+// entities decoded and its white space collapsed, as a browser would.
+func splitHTML(src string) []htmlPiece {
+	var pieces []htmlPiece
+	var text strings.Builder
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		raw := text.String()
+		text.Reset()
+		s := strings.Join(strings.Fields(html.UnescapeString(raw)), " ")
+		if s == "" {
+			pieces = append(pieces, htmlPiece{text: " "})
+			return
+		}
+		if strings.TrimLeft(raw, " \t\n") != raw {
+			s = " " + s
+		}
+		if strings.TrimRight(raw, " \t\n") != raw {
+			s += " "
+		}
+		pieces = append(pieces, htmlPiece{text: s})
+	}
+	for len(src) > 0 {
+		if strings.HasPrefix(src, "<!--") {
+			flush()
+			end := strings.Index(src, "-->")
+			if end < 0 {
+				return pieces
+			}
+			src = src[end+3:]
+			continue
+		}
+		if src[0] == '<' {
+			if tag, n, ok := parseHTMLTag(src); ok {
+				flush()
+				pieces = append(pieces, htmlPiece{tag: &tag})
+				src = src[n:]
+				continue
+			}
+		}
+		text.WriteByte(src[0])
+		src = src[1:]
+	}
+	flush()
+	return pieces
+}
+
+// rawHTML returns the source of an inline HTML node.
+func rawHTML(n *ast.RawHTML, md []byte) string {
+	var sb strings.Builder
+	for i := 0; i < n.Segments.Len(); i++ {
+		seg := n.Segments.At(i)
+		sb.Write(seg.Value(md))
+	}
+	return sb.String()
+}
+
+// htmlInline tracks the inline elements open in a run of tokens, so that an
+// end tag can restyle the tokens collected since its start tag.
+type htmlInline struct {
+	open []htmlOpen
+}
+
+type htmlOpen struct {
+	tag   htmlTag
+	start int
+}
+
+// htmlInlineTags are the tags inlineHTML understands.
+var htmlInlineTags = map[string]bool{
+	"br": true, "img": true, "kbd": true, "sup": true, "sub": true, "b": true, "strong": true, "i": true,
+	"em": true, "code": true, "tt": true, "s": true, "del": true, "strike": true, "u": true, "ins": true,
+	"a": true, "span": true, "wbr": true,
+}
+
+// inlineHTML applies an inline tag to the tokens in out and reports whether
+// the tag was one it understands.
+func (r *renderer) inlineHTML(st *htmlInline, tag htmlTag, size float64, out *[]textToken) bool {
+	if !htmlInlineTags[tag.name] {
+		return false
+	}
+	switch {
+	case tag.name == "br":
+		*out = append(*out, textToken{newline: true})
+	case tag.name == "img":
+		r.htmlImage(tag, size, out)
+	case tag.end:
+		for i := len(st.open) - 1; i >= 0; i-- {
+			if st.open[i].tag.name != tag.name {
+				continue
+			}
+			// Elements left open inside this one end with it.
+			for j := len(st.open) - 1; j >= i; j-- {
+				r.endInlineHTML(st.open[j], size, out)
+			}
+			st.open = st.open[:i]
+			break
+		}
+	case !tag.void:
+		if tag.name == "kbd" {
+			*out = append(*out, r.keySpacer(size))
+		}
+		st.open = append(st.open, htmlOpen{tag: tag, start: len(*out)})
+	}
+	return true
+}
+
+// closeInlineHTML ends the elements still open at the end of a run.
+func (r *renderer) closeInlineHTML(st *htmlInline, size float64, out *[]textToken) {
+	for i := len(st.open) - 1; i >= 0; i-- {
+		r.endInlineHTML(st.open[i], size, out)
+	}
+	st.open = nil
+}
+
+// keySpacer keeps a key cap clear of the text around it.
+func (r *renderer) keySpacer(size float64) textToken {
+	return textToken{text: " ", font: r.c.fonts.Regular, size: size * 0.4, color: r.c.th.FG}
+}
+
+// endInlineHTML restyles the tokens an element spans.
+func (r *renderer) endInlineHTML(el htmlOpen, size float64, out *[]textToken) {
+	tokens := (*out)[min(el.start, len(*out)):]
+	for i := range tokens {
+		tok := &tokens[i]
+		if tok.text == "" {
+			continue
+		}
+		switch el.tag.name {
+		case "b", "strong":
+			tok.font = r.c.fonts.emphasized(tok.font, 2)
+		case "i", "em":
+			tok.font = r.c.fonts.emphasized(tok.font, 1)
+		case "code", "tt", "kbd":
+			if r.c.fonts.Mono != nil {
+				tok.font = r.c.fonts.Mono
+			}
+			tok.size *= 0.9
+			tok.key = el.tag.name == "kbd"
+		case "s", "del", "strike":
+			tok.strike = true
+		case "u", "ins":
+			tok.underline = true
+		case "sup":
+			tok.rise += int(tok.size * 0.4)
+			tok.size *= 0.75
+		case "sub":
+			tok.rise -= int(tok.size * 0.2)
+			tok.size *= 0.75
+		case "a":
+			if el.tag.attrs["href"] != "" {
+				tok.color = r.c.th.Link
+				tok.underline = true
+			}
+		}
+	}
+	switch el.tag.name {
+	case "kbd":
+		*out = append(*out, r.keySpacer(size))
+	case "a":
+		if href := el.tag.attrs["href"]; href != "" && r.linkFootnotes {
+			r.appendFootnoteMarker(out, size, r.ensureFootnote(href))
+		}
+	}
+}
+
+// htmlImage adds an <img>, sized by its width and height attributes, or its
+// alt text when it cannot be loaded. Small images are drawn inline.
+func (r *renderer) htmlImage(tag htmlTag, size float64, out *[]textToken) {
+	src := strings.TrimSpace(tag.attrs["src"])
+	if img, err := r.loadImage(src); err == nil {
+		*out = append(*out, r.imageToken(img, htmlLength(tag.attrs["width"]), htmlLength(tag.attrs["height"]), size))
+	} else {
+		fallback, col := tag.attrs["alt"], r.c.th.FG
+		if fallback == "" {
+			fallback, col = src, r.c.th.Warning
+		}
+		if fallback != "" {
+			*out = append(*out, textToken{text: fallback, font: r.c.fonts.Regular, size: size, color: col})
+		}
+	}
+	if r.imageFootnotes {
+		r.appendFootnoteMarker(out, size, r.ensureFootnote(src))
+	}
+}
+
+// htmlLength parses a length attribute in pixels ("200" or "200px"); other
+// units are ignored.
+func htmlLength(s string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// sizeImage returns the drawn size of an image asked to be width x height
+// pixels, either of which may be zero to keep the aspect ratio, capped at
+// maxWidth.
+func sizeImage(bounds image.Rectangle, width, height, maxWidth int) (int, int) {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	switch {
+	case w <= 0 || h <= 0:
+		return fitImage(bounds, maxWidth)
+	case width > 0 && height > 0:
+		w, h = float64(width), float64(height)
+	case width > 0:
+		w, h = float64(width), h*float64(width)/w
+	case height > 0:
+		w, h = w*float64(height)/h, float64(height)
+	}
+	if maxWidth > 0 && w > float64(maxWidth) {
+		w, h = float64(maxWidth), h*float64(maxWidth)/w
+	}
+	return max(int(math.Round(w)), 1), max(int(math.Round(h)), 1)
+}
+
+// keyCap returns the boxes drawn behind a <kbd> key spanning x0 to x1: a
+// rounded patch of the code background with a thin border.
+func (c *canvas) keyCap(x0, x1, baseline int, size float64) []*Box {
+	pad := int(size * 0.3)
+	rect := image.Rect(x0-pad, baseline-int(size*0.95), x1+pad, baseline+int(size*0.35))
+	radius := size * 0.25
+	stroke := max(size/14, 1)
+	outline := roundedRectPolygon(rect, radius)
+	inner := roundedRectPolygon(rect.Inset(int(math.Ceil(stroke))), radius-stroke)
+	return []*Box{
+		{Kind: PathBox, Rect: rect, Fill: c.th.CodeBG, Path: Path{outline}},
+		{Kind: PathBox, Rect: rect, Fill: c.th.QuoteBar, Path: Path{outline, reversePolygon(inner)}},
+	}
+}
+
+// htmlBlock is an open block element of raw HTML. Blocks may span several
+// HTML nodes with Markdown in between, so they are tracked on the renderer.
+type htmlBlock struct {
+	name     string
+	center   bool
+	unclosed bool // no closing tag follows, so it ends with its HTML node
+}
+
+func (r *renderer) htmlCentered() bool {
+	return len(r.htmlBlocks) > 0 && r.htmlBlocks[len(r.htmlBlocks)-1].center
+}
+
+// alignTokens centers tokens inside a centered HTML block.
+func (r *renderer) alignTokens(tokens []textToken) {
+	if !r.htmlCentered() {
+		return
+	}
+	for i := range tokens {
+		tokens[i].center = true
+	}
+}
+
+var htmlHeadings = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+// htmlBlockSource returns the raw HTML of n, closing line included.
+func htmlBlockSource(n *ast.HTMLBlock, md []byte) string {
+	var src strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		src.Write(seg.Value(md))
+	}
+	if n.HasClosure() {
+		src.Write(n.ClosureLine.Value(md))
+	}
+	return src.String()
+}
+
+// htmlCloses reports whether a name element just opened is closed in rest,
+// the remainder of HTML block n, or in an HTML block following n in the
+// same parent.
+func htmlCloses(name string, rest []htmlPiece, n ast.Node, md []byte) bool {
+	depth := 1
+	closes := func(pieces []htmlPiece) bool {
+		for _, p := range pieces {
+			if p.tag == nil || p.tag.name != name || p.tag.void {
+				continue
+			}
+			if p.tag.end {
+				depth--
+			} else {
+				depth++
+			}
+			if depth == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if closes(rest) {
+		return true
+	}
+	for next := n.NextSibling(); next != nil; next = next.NextSibling() {
+		if h, ok := next.(*ast.HTMLBlock); ok && closes(splitHTML(htmlBlockSource(h, md))) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderHTMLBlock draws a raw HTML block between left and right.
+func (r *renderer) renderHTMLBlock(n *ast.HTMLBlock, md []byte, left, right int) {
+	src := htmlBlockSource(n, md)
+
+	var tokens []textToken
+	var inline htmlInline
+	var unknown []string
+	heading, summary, skip := 0, false, 0
+	style := func() (*FontAndFace, float64) {
+		switch {
+		case heading > 0:
+			st := r.c.th.Style.Headings[heading-1]
+			return r.c.fonts.byRole(st.Font), r.baseSize * st.Scale
+		case summary:
+			return r.c.fonts.byRole(FontBold), r.baseSize
+		}
+		return r.c.fonts.Regular, r.baseSize
+	}
+	flush := func() {
+		_, size := style()
+		r.closeInlineHTML(&inline, size, &tokens)
+		visible := false
+		for _, tok := range tokens {
+			visible = visible || tok.newline || tok.image != nil || strings.TrimSpace(tok.text) != ""
+		}
+		if !visible {
+			tokens = nil
+			return
+		}
+		r.alignTokens(tokens)
+		role, before, after := RoleParagraph, 0, r.c.em(r.c.th.Style.Paragraph.SpaceAfter)
+		if heading > 0 {
+			st := r.c.th.Style.Headings[heading-1]
+			role, before, after = RoleHeading, r.c.em(st.SpaceBefore), r.c.em(st.SpaceAfter)
+		}
+		r.c.addVSpace(before)
+		block := r.c.beginBlock(role, left, right)
+		_ = r.c.drawTokens(tokens, left, right)
+		r.c.endBlock(block)
+		r.c.addVSpace(after)
+		tokens = nil
+	}
+
+	pieces := splitHTML(src)
+	for i, p := range pieces {
+		if p.tag == nil {
+			if skip == 0 {
+				font, size := style()
+				tokens = append(tokens, textToken{text: p.text, font: font, size: size, color: r.c.th.FG})
+			}
+			continue
+		}
+		tag := *p.tag
+		switch tag.name {
+		case "p", "div", "center", "h1", "h2", "h3", "h4", "h5", "h6":
+			flush()
+			if tag.end {
+				for i := len(r.htmlBlocks) - 1; i >= 0; i-- {
+					if r.htmlBlocks[i].name == tag.name {
+						r.htmlBlocks = r.htmlBlocks[:i]
+						break
+					}
+				}
+				if htmlHeadings[tag.name] > 0 {
+					heading = 0
+				}
+				continue
+			}
+			center := tag.name == "center" || strings.EqualFold(tag.attrs["align"], "center") || r.htmlCentered()
+			if !tag.void {
+				r.htmlBlocks = append(r.htmlBlocks, htmlBlock{name: tag.name, center: center, unclosed: !htmlCloses(tag.name, pieces[i+1:], n, md)})
+			}
+			heading = htmlHeadings[tag.name]
+		case "details":
+			flush()
+		case "summary":
+			flush()
+			summary = !tag.end
+			if summary {
+				font, _ := style()
+				tokens = append(tokens, textToken{text: "▼ ", font: font, size: r.baseSize * 0.7, color: r.c.th.FG})
+			}
+		case "hr":
+			flush()
+			r.c.drawHRule(left, right)
+		case "script", "style":
+			if tag.end {
+				skip = max(skip-1, 0)
+			} else {
+				skip++
+				unknown = appendUnique(unknown, tag.name)
+			}
+		default:
+			_, size := style()
+			if !r.inlineHTML(&inline, tag, size, &tokens) && !tag.end {
+				unknown = appendUnique(unknown, tag.name)
+			}
+		}
+	}
+	flush()
+	// An element never closed ends with its HTML block, rather than
+	// centering the rest of the document.
+	open := r.htmlBlocks[:0]
+	for _, b := range r.htmlBlocks {
+		if !b.unclosed {
+			open = append(open, b)
+		}
+	}
+	r.htmlBlocks = open
+	for _, name := range unknown {
+		r.warnUnsupported(fmt.Sprintf("<%s>", name), left, right)
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
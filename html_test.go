@@ -0,0 +1,127 @@
+package md2png
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitHTML(t *testing.T) {
+	pieces := splitHTML("<p align=\"center\">\n  Tom &amp;   Jerry<!-- note --><br/><IMG SRC='a.png' width=20>\n</p>")
+	if len(pieces) != 6 {
+		t.Fatalf("expected 6 pieces, got %d: %+v", len(pieces), pieces)
+	}
+	if p := pieces[0].tag; p == nil || p.name != "p" || p.end || p.attrs["align"] != "center" {
+		t.Fatalf("unexpected start tag: %+v", pieces[0])
+	}
+	if pieces[1].text != " Tom & Jerry" {
+		t.Fatalf("expected collapsed, unescaped text, got %q", pieces[1].text)
+	}
+	if br := pieces[2].tag; br == nil || br.name != "br" || !br.void {
+		t.Fatalf("expected a void br, got %+v", pieces[2])
+	}
+	if img := pieces[3].tag; img == nil || img.name != "img" || img.attrs["src"] != "a.png" || htmlLength(img.attrs["width"]) != 20 {
+		t.Fatalf("unexpected img tag: %+v", pieces[3])
+	}
+	if end := pieces[5].tag; end == nil || end.name != "p" || !end.end {
+		t.Fatalf("expected the closing p, got %+v", pieces[5])
+	}
+}
+
+func TestRenderInlineHTML(t *testing.T) {
+	opts, err := RenderOptions{Width: 640}.withDefaults()
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	l, err := LayoutDocument([]byte("Press <kbd>Ctrl</kbd> and x<sup>2</sup><br>then <b>stop</b> <blink>now</blink>.\n"), opts)
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := map[string]*Box{}
+	var lines, caps int
+	l.Walk(func(b *Box) bool {
+		switch b.Kind {
+		case LineBox:
+			lines++
+		case PathBox:
+			caps++
+		case GlyphRunBox:
+			runs[strings.TrimSpace(b.Run.Text)] = b
+		}
+		return true
+	})
+	if lines != 2 {
+		t.Fatalf("expected <br> to break the line, got %d lines", lines)
+	}
+	if caps != 2 || runs["Ctrl"] == nil || runs["Ctrl"].Run.Font != opts.Fonts.Mono {
+		t.Fatalf("expected a monospaced key cap for <kbd>")
+	}
+	if sup := runs["2"]; sup == nil || sup.Run.Baseline >= runs["and x"].Run.Baseline || sup.Run.Size >= runs["and x"].Run.Size {
+		t.Fatalf("expected a raised, smaller superscript")
+	}
+	if stop := runs["stop"]; stop == nil || stop.Run.Font != opts.Fonts.Bold {
+		t.Fatalf("expected <b> to embolden its text")
+	}
+	if blink := runs["<blink>"]; blink == nil || blink.Run.Color != LightTheme.Warning {
+		t.Fatalf("expected the unknown tag drawn as a warning")
+	}
+}
+
+func TestRenderHTMLBlocks(t *testing.T) {
+	markdown := "<h1 align=\"center\">Title</h1>\n\n<details>\n<summary>More</summary>\n\nBody\n\n</details>\n\n<table>\n<tr><td>cell</td></tr>\n</table>\n"
+	opts, err := RenderOptions{Width: 640}.withDefaults()
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	l, err := LayoutDocument([]byte(markdown), opts)
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := map[string]*Box{}
+	var warning *Box
+	l.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox {
+			runs[strings.TrimSpace(b.Run.Text)] = b
+		}
+		if b.Role == RoleUnsupported {
+			warning = b
+		}
+		return true
+	})
+	title := runs["Title"]
+	if title == nil || title.Run.Size <= 16 {
+		t.Fatalf("expected a heading from <h1>")
+	}
+	if left, right := title.Rect.Min.X-48, 640-48-title.Rect.Max.X; left-right > 2 || right-left > 2 {
+		t.Fatalf("expected the heading centered, got margins %d and %d", left, right)
+	}
+	if more := runs["More"]; more == nil || more.Run.Font != opts.Fonts.Bold || runs["Body"] == nil {
+		t.Fatalf("expected a bold summary followed by the details body")
+	}
+	if warning == nil || runs["cell"] == nil || runs["⚠ Unsupported: <table>"] == nil {
+		t.Fatalf("expected the table text with a warning for the unknown tag")
+	}
+}
+
+func TestHTMLAlignmentEnds(t *testing.T) {
+	markdown := "<div align=\"center\">\n\nInside\n\n</div>\n\nOutside\n\n<div align=\"center\">\nUnclosed\n\nLater paragraph.\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := map[string]*Box{}
+	l.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox {
+			runs[strings.TrimSpace(b.Run.Text)] = b
+		}
+		return true
+	})
+	for text, centered := range map[string]bool{"Inside": true, "Outside": false, "Unclosed": true, "Later paragraph.": false} {
+		b := runs[text]
+		if b == nil {
+			t.Fatalf("expected %q drawn", text)
+		}
+		if got := b.Rect.Min.X > 48; got != centered {
+			t.Fatalf("expected %q centered %v, got x %d", text, centered, b.Rect.Min.X)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package md2png
+
+import (
+	"bytes"
+	"image"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ---- Image sizing ----
+
+// An image may ask for a size after its destination:
+//
+//	![logo](logo.png =300x)
+//	![logo](logo.png =300x200 "Title")
+//	![logo](logo.png =x120)
+//
+// or in an attribute block straight after it:
+//
+//	![logo](logo.png){width=300 height=200}
+//
+// Sizes are in pixels, with or without a px suffix; given one side, the other
+// keeps the aspect ratio. Images no taller than two lines of text, such as
+// icons and badges, sit on the baseline within the text around them. Larger
+// ones are drawn as centered blocks of their own.
+
+var (
+	sizedImagePattern = regexp.MustCompile(`^!\[((?:[^\[\]\\]|\\.|\[[^\[\]]*\])*)\]\(\s*(<[^<>\n]*>|[^\s()]+)\s+=(\d*)x(\d*)\s*(?:"([^"]*)"|'([^']*)')?\s*\)`)
+	imageAttrsPattern = regexp.MustCompile(`^\{\s*(?:[A-Za-z-]+\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'{}]+)\s*)+\}`)
+	imageAttrPattern  = regexp.MustCompile(`([A-Za-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'{}]+))`)
+)
+
+// imageSizeExtension adds size hints to Markdown images.
+type imageSizeExtension struct{}
+
+func (imageSizeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		// Ahead of goldmark's link parser, which gives up on a hint.
+		parser.WithInlineParsers(util.Prioritized(sizedImageParser{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(imageAttrsTransformer{}, 100)),
+	)
+}
+
+// sizedImageParser parses images whose destination is followed by =WxH.
+// Images without a hint are left to the link parser.
+type sizedImageParser struct{}
+
+func (sizedImageParser) Trigger() []byte { return []byte{'!'} }
+
+func (sizedImageParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, seg := block.PeekLine()
+	m := sizedImagePattern.FindSubmatchIndex(line)
+	if m == nil || (m[6] == m[7] && m[8] == m[9]) {
+		return nil
+	}
+	link := ast.NewLink()
+	link.Destination = bytes.TrimSuffix(bytes.TrimPrefix(line[m[4]:m[5]], []byte("<")), []byte(">"))
+	for _, g := range [][2]int{{m[10], m[11]}, {m[12], m[13]}} {
+		if g[0] >= 0 {
+			link.Title = line[g[0]:g[1]]
+		}
+	}
+	img := ast.NewImage(link)
+	if m[3] > m[2] {
+		img.AppendChild(img, ast.NewTextSegment(text.NewSegment(seg.Start+m[2], seg.Start+m[3])))
+	}
+	setImageSize(img, string(line[m[6]:m[7]]), string(line[m[8]:m[9]]))
+	block.Advance(m[1])
+	return img
+}
+
+// imageAttrsTransformer moves a {width=... height=...} block following an
+// image onto the image.
+type imageAttrsTransformer struct{}
+
+func (imageAttrsTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var images []*ast.Image
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			images = append(images, img)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, img := range images {
+		txt, ok := img.NextSibling().(*ast.Text)
+		if !ok {
+			continue
+		}
+		attrs := imageAttrsPattern.Find(txt.Segment.Value(source))
+		if attrs == nil {
+			continue
+		}
+		values := map[string]string{}
+		for _, a := range imageAttrPattern.FindAllSubmatch(attrs, -1) {
+			values[strings.ToLower(string(a[1]))] = string(a[2]) + string(a[3]) + string(a[4])
+		}
+		setImageSize(img, values["width"], values["height"])
+		txt.Segment = txt.Segment.WithStart(txt.Segment.Start + len(attrs))
+		if txt.Segment.IsEmpty() && !txt.SoftLineBreak() && !txt.HardLineBreak() {
+			txt.Parent().RemoveChild(txt.Parent(), txt)
+		}
+	}
+}
+
+// setImageSize records the size asked of img as attributes, which
+// imageHint reads back. Empty sizes are left unset.
+func setImageSize(img *ast.Image, width, height string) {
+	if width != "" {
+		img.SetAttributeString("width", []byte(width))
+	}
+	if height != "" {
+		img.SetAttributeString("height", []byte(height))
+	}
+}
+
+// imageHint returns the width or height, in pixels, asked of img, or 0.
+func imageHint(img *ast.Image, name string) int {
+	v, ok := img.AttributeString(name)
+	if !ok {
+		return 0
+	}
+	b, _ := v.([]byte)
+	return htmlLength(string(b))
+}
+
+// imageToken returns the token drawing img, asked to be width x height
+// (either may be 0), among text of the given size.
+func (r *renderer) imageToken(img image.Image, width, height int, size float64) textToken {
+	tok := textToken{image: img, width: width, height: height}
+	_, h := r.c.imageSize(tok, 0)
+	tok.inline = float64(h) <= 2*size
+	return tok
+}
+
+// imageSize returns the size tok's image is drawn at when it may be at most
+// maxWidth pixels wide (0 for no limit): the size asked for, or the image's
+// own. Block images narrower than maxWidth are scaled up to it when the
+// canvas upscales images, and no image is drawn taller than the canvas's
+// maximum image height.
+func (c *canvas) imageSize(tok textToken, maxWidth int) (int, int) {
+	bounds := tok.image.Bounds()
+	w, h := fitImage(bounds, maxWidth)
+	switch {
+	case tok.width > 0 || tok.height > 0:
+		w, h = sizeImage(bounds, tok.width, tok.height, maxWidth)
+	case c.upscaleImages && !tok.inline && w > 0 && maxWidth > w:
+		w, h = maxWidth, max(h*maxWidth/w, 1)
+	}
+	if c.maxImageHeight > 0 && h > c.maxImageHeight {
+		w, h = max(w*c.maxImageHeight/h, 1), c.maxImageHeight
+	}
+	return w, h
+}
@@ -0,0 +1,94 @@
+package md2png
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestImage writes a blank PNG of the given size into dir.
+func writeTestImage(t *testing.T, dir, name string, width, height int) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("create image: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+}
+
+// imageBoxes lays out markdown and returns its image boxes, each with the
+// kind of box holding it.
+func imageBoxes(t *testing.T, markdown string, opts RenderOptions) (images []*Box, parents []BoxKind) {
+	t.Helper()
+	l, err := LayoutDocument([]byte(markdown), opts)
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	l.Walk(func(b *Box) bool {
+		for _, child := range b.Children {
+			if child.Kind == ImageBox {
+				images = append(images, child)
+				parents = append(parents, b.Kind)
+			}
+		}
+		return true
+	})
+	return images, parents
+}
+
+func TestImageSizeHints(t *testing.T) {
+	dir := t.TempDir()
+	writeTestImage(t, dir, "pic.png", 120, 80)
+	markdown := "![a](pic.png =240x)\n\n![b](<pic.png> =x40 \"Title\")\n\n![c](pic.png){width=60px height=50} text\n\n![d](pic.png)\n"
+	images, _ := imageBoxes(t, markdown, RenderOptions{Width: 600, BaseDir: dir})
+	want := []image.Point{{240, 160}, {60, 40}, {60, 50}, {120, 80}}
+	if len(images) != len(want) {
+		t.Fatalf("expected %d images, got %d", len(want), len(images))
+	}
+	for i, img := range images {
+		if got := img.Rect.Size(); got != want[i] {
+			t.Fatalf("image %d: expected %v, got %v", i, want[i], got)
+		}
+	}
+
+	images, _ = imageBoxes(t, markdown, RenderOptions{Width: 600, BaseDir: dir, MaxImageHeight: 100, UpscaleImages: true})
+	if got := images[0].Rect.Size(); got != (image.Point{150, 100}) {
+		t.Fatalf("expected the hinted image capped at 100px tall, got %v", got)
+	}
+	if got := images[3].Rect.Size(); got != (image.Point{150, 100}) {
+		t.Fatalf("expected the plain image upscaled, then capped, got %v", got)
+	}
+}
+
+func TestInlineImagesSitOnTheBaseline(t *testing.T) {
+	dir := t.TempDir()
+	writeTestImage(t, dir, "badge.png", 90, 20)
+	writeTestImage(t, dir, "pic.png", 120, 80)
+	markdown := "Build ![build](badge.png) passing.\n\n![pic](pic.png)\n"
+	images, parents := imageBoxes(t, markdown, RenderOptions{Width: 600, BaseDir: dir, UpscaleImages: true})
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+	if parents[0] != LineBox || images[0].Rect.Size() != (image.Point{90, 20}) {
+		t.Fatalf("expected the badge inline at its own size, got %v in a %s", images[0].Rect, parents[0])
+	}
+	if parents[1] == LineBox || images[1].Rect.Dx() != 600-2*48 {
+		t.Fatalf("expected the picture as an upscaled block, got %v in a %s", images[1].Rect, parents[1])
+	}
+
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 600, BaseDir: dir})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	l.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox && b.Run.Text == "Build " && b.Run.Baseline != images[0].Rect.Max.Y {
+			t.Fatalf("expected the badge on the text baseline %d, got bottom %d", b.Run.Baseline, images[0].Rect.Max.Y)
+		}
+		return true
+	})
+}
@@ -0,0 +1,271 @@
+package md2png
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ---- Layout tree ----
+
+// BoxKind identifies what a Box in a Layout represents.
+type BoxKind int
+
+const (
+	// BlockBox groups other boxes: paragraphs, list items, tables, code blocks.
+	BlockBox BoxKind = iota
+	// LineBox holds the glyph runs that make up one line of text.
+	LineBox
+	// GlyphRunBox is a run of text sharing a single font, size and color.
+	GlyphRunBox
+	// ImageBox is an embedded image scaled into its rectangle.
+	ImageBox
+	// RuleBox is a solid rectangle: horizontal rules, quote bars, borders.
+	RuleBox
+	// PathBox is a filled vector shape, such as a task list checkbox.
+	PathBox
+)
+
+func (k BoxKind) String() string {
+	switch k {
+	case BlockBox:
+		return "block"
+	case LineBox:
+		return "line"
+	case GlyphRunBox:
+		return "glyph-run"
+	case ImageBox:
+		return "image"
+	case RuleBox:
+		return "rule"
+	case PathBox:
+		return "path"
+	default:
+		return "unknown"
+	}
+}
+
+// Block roles describe which Markdown construct produced a BlockBox.
+const (
+	RoleDocument    = "document"
+	RoleHeading     = "heading"
+	RoleParagraph   = "paragraph"
+	RoleList        = "list"
+	RoleListItem    = "list-item"
+	RoleCode        = "code"
+	RoleBlockquote  = "blockquote"
+	RoleAlert       = "alert"
+	RoleTable       = "table"
+	RoleTableRow    = "table-row"
+	RoleTableCell   = "table-cell"
+	RoleFootnotes   = "footnotes"
+	RoleFootnote    = "footnote"
+	RoleMath        = "math"
+	RoleDiagram     = "diagram"
+	RoleUnsupported = "unsupported"
+
+	RoleDefinitionList        = "definition-list"
+	RoleDefinitionTerm        = "definition-term"
+	RoleDefinitionDescription = "definition-description"
+)
+
+// GlyphRun is a piece of text drawn in one style with its baseline at
+// Baseline and its left edge at the owning box's Rect.Min.X.
+type GlyphRun struct {
+	Text      string
+	Font      *FontAndFace
+	Size      float64
+	Color     color.Color
+	Baseline  int
+	Underline bool
+	Strike    bool
+}
+
+func (g *GlyphRun) sameStyle(w styledWord) bool {
+	return g.Font == w.font && g.Size == w.size && g.Color == w.color && g.Underline == w.underline &&
+		g.Strike == w.strike
+}
+
+// decorations returns the underline and strikethrough bars of a run spanning
+// rect horizontally, to be filled in the run's color.
+func (g *GlyphRun) decorations(rect image.Rectangle) []image.Rectangle {
+	if rect.Dx() <= 0 {
+		return nil
+	}
+	thickness := max(int(g.Size/16), 1)
+	var bars []image.Rectangle
+	if g.Underline {
+		y := max(g.Baseline+int(g.Size*0.12), g.Baseline+1)
+		bars = append(bars, image.Rect(rect.Min.X, y, rect.Max.X, y+thickness))
+	}
+	if g.Strike {
+		// Through the middle of the lowercase letters.
+		y := g.Baseline - int(g.Size*0.35)
+		bars = append(bars, image.Rect(rect.Min.X, y, rect.Max.X, y+thickness))
+	}
+	return bars
+}
+
+// PathPoint is a point of a Path in document pixels.
+type PathPoint struct {
+	X, Y float64
+}
+
+// Path is a set of closed polygons filled with the nonzero winding rule, so
+// a polygon wound against the one around it cuts a hole.
+type Path [][]PathPoint
+
+// rectPolygon returns r as a clockwise polygon, or counter-clockwise when
+// reversed is set.
+func rectPolygon(r image.Rectangle, reversed bool) []PathPoint {
+	pts := []PathPoint{
+		{float64(r.Min.X), float64(r.Min.Y)}, {float64(r.Max.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Max.Y)}, {float64(r.Min.X), float64(r.Max.Y)},
+	}
+	if reversed {
+		pts[1], pts[3] = pts[3], pts[1]
+	}
+	return pts
+}
+
+// roundedRectPolygon returns r with corners of the given radius, clockwise.
+func roundedRectPolygon(r image.Rectangle, radius float64) []PathPoint {
+	return roundedCornersPolygon(r, radius, radius)
+}
+
+// roundedCornersPolygon returns r with its top corners rounded by top and its
+// bottom corners by bottom, clockwise.
+func roundedCornersPolygon(r image.Rectangle, top, bottom float64) []PathPoint {
+	limit := min(float64(r.Dx())/2, float64(r.Dy())/2)
+	top, bottom = min(top, limit), min(bottom, limit)
+	if top <= 0 && bottom <= 0 {
+		return rectPolygon(r, false)
+	}
+	const steps = 6
+	corners := []struct{ x, y, dx, dy, radius, start float64 }{
+		{float64(r.Max.X), float64(r.Min.Y), -1, 1, top, -math.Pi / 2},
+		{float64(r.Max.X), float64(r.Max.Y), -1, -1, bottom, 0},
+		{float64(r.Min.X), float64(r.Max.Y), 1, -1, bottom, math.Pi / 2},
+		{float64(r.Min.X), float64(r.Min.Y), 1, 1, top, math.Pi},
+	}
+	var pts []PathPoint
+	for _, c := range corners {
+		if c.radius <= 0 {
+			pts = append(pts, PathPoint{c.x, c.y})
+			continue
+		}
+		cx, cy := c.x+c.dx*c.radius, c.y+c.dy*c.radius
+		for i := 0; i <= steps; i++ {
+			a := c.start + float64(i)*math.Pi/2/steps
+			pts = append(pts, PathPoint{cx + c.radius*math.Cos(a), cy + c.radius*math.Sin(a)})
+		}
+	}
+	return pts
+}
+
+// reversePolygon returns pts in the opposite winding order.
+func reversePolygon(pts []PathPoint) []PathPoint {
+	out := make([]PathPoint, len(pts))
+	for i, p := range pts {
+		out[len(pts)-1-i] = p
+	}
+	return out
+}
+
+// strokeSegment returns the clockwise quadrilateral covering a line of the
+// given width from a to b. Overlapping strokes share a winding direction, so
+// they merge rather than cancel.
+func strokeSegment(a, b PathPoint, width float64) []PathPoint {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil
+	}
+	nx, ny := dy/length*width/2, -dx/length*width/2
+	return []PathPoint{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}}
+}
+
+// Box is a positioned element of a Layout. Rect is in document pixels.
+// Only the fields relevant to Kind are set: Run for glyph runs, Image for
+// images, Path for paths, and Fill for rules, paths and blocks with a
+// background.
+type Box struct {
+	Kind     BoxKind
+	Role     string
+	Rect     image.Rectangle
+	Fill     color.Color
+	Run      *GlyphRun
+	Image    image.Image
+	Path     Path
+	Children []*Box
+}
+
+// Layout is the measured, positioned result of laying out a document. Its
+// boxes are painted in tree order, parents before children.
+type Layout struct {
+	Width      int
+	Height     int
+	Margin     int
+	Background color.Color
+	Root       *Box
+	// Diagnostics lists the problems met while laying out, such as table
+	// content too wide for its column.
+	Diagnostics []Diagnostic
+}
+
+// Diagnostic reports a problem met while laying out a document. The document
+// still renders, but not quite as written.
+type Diagnostic struct {
+	Line    int // 1-based line of the Markdown source, 0 if unknown
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line <= 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+// Walk visits every box in paint order. Returning false from fn skips the
+// children of the box just visited.
+func (l *Layout) Walk(fn func(b *Box) bool) {
+	if l == nil || l.Root == nil {
+		return
+	}
+	walkBoxes(l.Root, fn)
+}
+
+func walkBoxes(b *Box, fn func(b *Box) bool) {
+	if !fn(b) {
+		return
+	}
+	for _, child := range b.Children {
+		walkBoxes(child, fn)
+	}
+}
+
+// HitTest returns the boxes containing p, from the document root down to the
+// innermost box. It returns nil when p falls outside the document.
+func (l *Layout) HitTest(p image.Point) []*Box {
+	if l == nil || l.Root == nil || !p.In(l.Root.Rect) {
+		return nil
+	}
+	path := []*Box{l.Root}
+	for b := l.Root; ; {
+		var next *Box
+		// Later children paint on top, so prefer them.
+		for i := len(b.Children) - 1; i >= 0; i-- {
+			if p.In(b.Children[i].Rect) {
+				next = b.Children[i]
+				break
+			}
+		}
+		if next == nil {
+			return path
+		}
+		path = append(path, next)
+		b = next
+	}
+}
@@ -0,0 +1,130 @@
+package md2png
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+func TestLayoutDocumentBuildsBoxTree(t *testing.T) {
+	markdown := "# Title\n\nSome **bold** text.\n\n```\ncode line\n```\n\n---\n\n| A | B |\n| --- | --- |\n| 1 | 2 |\n"
+	opts := RenderOptions{Width: 480, Margin: 24}
+	l, err := LayoutDocument([]byte(markdown), opts)
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	img, err := Render([]byte(markdown), opts)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if l.Width != img.Bounds().Dx() || l.Height != img.Bounds().Dy() {
+		t.Fatalf("expected layout size %dx%d to match render %v", l.Width, l.Height, img.Bounds())
+	}
+
+	roles := map[string]int{}
+	kinds := map[BoxKind]int{}
+	var text strings.Builder
+	l.Walk(func(b *Box) bool {
+		kinds[b.Kind]++
+		if b.Kind == BlockBox {
+			roles[b.Role]++
+		}
+		if b.Run != nil {
+			text.WriteString(b.Run.Text)
+		}
+		return true
+	})
+	for _, role := range []string{RoleHeading, RoleParagraph, RoleCode, RoleTable, RoleTableRow, RoleTableCell} {
+		if roles[role] == 0 {
+			t.Fatalf("expected a %q block in the layout, got %v", role, roles)
+		}
+	}
+	for _, kind := range []BoxKind{LineBox, GlyphRunBox, RuleBox} {
+		if kinds[kind] == 0 {
+			t.Fatalf("expected %s boxes in the layout", kind)
+		}
+	}
+	if !strings.Contains(text.String(), "code line") {
+		t.Fatalf("expected code text in glyph runs, got %q", text.String())
+	}
+}
+
+func TestLayoutHitTest(t *testing.T) {
+	l, err := LayoutDocument([]byte("Hello world"), RenderOptions{Width: 400, Margin: 20})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var run *Box
+	l.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox && run == nil {
+			run = b
+		}
+		return true
+	})
+	if run == nil {
+		t.Fatalf("expected a glyph run")
+	}
+	center := image.Pt((run.Rect.Min.X+run.Rect.Max.X)/2, (run.Rect.Min.Y+run.Rect.Max.Y)/2)
+	path := l.HitTest(center)
+	if len(path) == 0 || path[len(path)-1] != run {
+		t.Fatalf("expected hit test to end at the glyph run, got %v", path)
+	}
+	if path[0] != l.Root {
+		t.Fatalf("expected hit test path to start at the root")
+	}
+	if got := l.HitTest(image.Pt(-1, -1)); got != nil {
+		t.Fatalf("expected no hit outside the document, got %v", got)
+	}
+}
+
+func TestPaintRasterBlendsTranslucentFills(t *testing.T) {
+	l := &Layout{Width: 10, Height: 10, Background: color.White, Root: &Box{Kind: BlockBox, Rect: image.Rect(0, 0, 10, 10), Children: []*Box{
+		{Kind: BlockBox, Rect: image.Rect(0, 0, 10, 10), Fill: color.RGBA{0xFF, 0, 0, 0xFF}},
+		{Kind: RuleBox, Rect: image.Rect(0, 0, 5, 10), Fill: color.NRGBA{0, 0, 0xFF, 0x80}},
+	}}}
+	got := PaintRaster(l).RGBAAt(2, 5)
+	if got.R < 0x70 || got.R > 0x90 || got.B < 0x70 || got.B > 0x90 || got.A != 0xFF {
+		t.Fatalf("expected the translucent rule blended over the block, got %v", got)
+	}
+}
+
+func TestPaintRasterGlyphRunsFillTheirBoxes(t *testing.T) {
+	markdown := "# Heading text that is long enough\n\nA run of plain text measuring 41 characters\n\nSee [the linked reference documentation](https://example.com) here.\n\n`monospaced code that runs for a while`\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 800})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := 0
+	l.Walk(func(b *Box) bool {
+		if b.Kind != GlyphRunBox || len(b.Run.Text) < 20 {
+			return true
+		}
+		runs++
+		// Paint the run on its own so only its ink is measured.
+		run := *b
+		img := PaintRaster(&Layout{Width: l.Width, Height: l.Height, Background: color.White, Root: &Box{Kind: BlockBox, Rect: image.Rect(0, 0, l.Width, l.Height), Children: []*Box{&run}}})
+		right := -1
+		for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+			for x := b.Rect.Min.X; x < l.Width; x++ {
+				if c := img.RGBAAt(x, y); c.R < 0x80 || c.G < 0x80 || c.B < 0x80 {
+					right = max(right, x+1)
+				}
+			}
+		}
+		// The last glyph's ink stops short of the advance by its side bearing.
+		face := truetype.NewFace(b.Run.Font.Font, &truetype.Options{Size: b.Run.Size, DPI: 96, Hinting: font.HintingFull})
+		bounds, advance := font.BoundString(face, b.Run.Text)
+		want := b.Rect.Max.X - (advance - bounds.Max.X).Floor()
+		if right < want-1 || right > want+1 {
+			t.Fatalf("expected %q inked up to %d for its box edge %d, got %d", b.Run.Text, want, b.Rect.Max.X, right)
+		}
+		return true
+	})
+	if runs < 4 {
+		t.Fatalf("expected 4 long runs, got %d", runs)
+	}
+}
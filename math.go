@@ -0,0 +1,660 @@
+package md2png
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ---- Math: Markdown syntax ----
+
+// Inline math is written $...$ and display math $$...$$, either on lines of
+// its own or inline within a paragraph. An opening $ must be followed, and a
+// closing $ preceded, by something other than a space, and a closing $ may
+// not be followed by a digit, so prices such as "$5 and $10" stay text.
+
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+// mathInline is a TeX formula inside a paragraph.
+type mathInline struct {
+	ast.BaseInline
+	tex     string
+	display bool // written $$...$$: typeset in display style
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.tex}, nil)
+}
+
+// mathBlock is a display formula between $$ lines.
+type mathBlock struct {
+	ast.BaseBlock
+	tex    string
+	closed bool // the closing $$ has been read
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.tex}, nil)
+}
+
+// mathExtension adds $...$ and $$...$$ to a goldmark parser.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 700)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 500)),
+	)
+}
+
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	body := line[delim:]
+	if len(body) == 0 || (delim == 1 && isSpaceByte(body[0])) {
+		return nil
+	}
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '$':
+			if delim == 2 {
+				if i == 0 || i+1 >= len(body) || body[i+1] != '$' {
+					continue
+				}
+			} else if i == 0 || isSpaceByte(body[i-1]) || (i+1 < len(body) && body[i+1] >= '0' && body[i+1] <= '9') {
+				continue
+			}
+			block.Advance(delim + i + delim)
+			return &mathInline{tex: string(body[:i]), display: delim == 2}
+		}
+	}
+	return nil
+}
+
+func isSpaceByte(b byte) bool { return b == ' ' || b == '\t' || b == '\n' || b == '\r' }
+
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	rest := bytes.TrimSpace(line[pos+2:])
+	if i := bytes.Index(rest, []byte("$$")); i >= 0 {
+		// A one-line $$...$$ is a block only when nothing follows it;
+		// otherwise it is display math inside a paragraph.
+		if i != len(rest)-2 {
+			return nil, parser.NoChildren
+		}
+		reader.AdvanceToEOL()
+		return &mathBlock{tex: string(rest[:i]), closed: true}, parser.NoChildren
+	}
+	reader.AdvanceToEOL()
+	return &mathBlock{tex: string(rest)}, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*mathBlock)
+	if n.closed {
+		return parser.Close
+	}
+	line, _ := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	closing := bytes.HasSuffix(trimmed, []byte("$$"))
+	if closing {
+		trimmed = trimmed[:len(trimmed)-2]
+	}
+	if len(trimmed) > 0 {
+		if n.tex != "" {
+			n.tex += "\n"
+		}
+		n.tex += string(trimmed)
+	}
+	reader.AdvanceToEOL()
+	if closing {
+		n.closed = true
+		return parser.Close
+	}
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+// ---- Math: TeX parsing ----
+
+// mathClass is the TeX atom class, which decides the spacing between atoms.
+type mathClass int
+
+const (
+	classOrd mathClass = iota
+	classOp
+	classBin
+	classRel
+	classOpen
+	classClose
+	classPunct
+	classInner
+)
+
+type mathKind int
+
+const (
+	mathAtom    mathKind = iota // a symbol, letter, number or word
+	mathGroup                   // {...}
+	mathFrac                    // \frac, \binom
+	mathSqrt                    // \sqrt[index]{body}
+	mathScripts                 // base with sub- and superscripts
+	mathSpace                   // \, \quad and friends
+	mathFenced                  // \left ... \right
+	mathMatrix                  // \begin{...} ... \end{...} or rows split by \\
+	mathAccent                  // \hat, \vec, \overline ...
+)
+
+// mathNode is one element of a parsed formula. Only the fields relevant to
+// kind are set.
+type mathNode struct {
+	kind   mathKind
+	class  mathClass
+	text   string
+	role   FontRole
+	large  bool // big operator such as \sum, drawn larger in display style
+	limits bool // scripts go above and below in display style
+	err    bool // unknown command, drawn in the theme's warning color
+
+	body     []*mathNode // group, root, fenced or accented content
+	num, den []*mathNode // fraction
+	index    []*mathNode // root index
+	base     *mathNode   // scripts
+	sup, sub []*mathNode // scripts
+
+	noRule      bool   // \binom: a fraction without a bar
+	open, close string // fence delimiters, "" for none
+	rows        [][][]*mathNode
+	env         string
+	space       float64 // ems
+}
+
+// mathSym is a TeX command that stands for one symbol.
+type mathSym struct {
+	text  string
+	class mathClass
+	role  FontRole
+}
+
+var mathSymbols = map[string]mathSym{
+	// Greek: lowercase italic, uppercase upright, as TeX sets them.
+	"alpha": {"α", classOrd, FontItalic}, "beta": {"β", classOrd, FontItalic}, "gamma": {"γ", classOrd, FontItalic},
+	"delta": {"δ", classOrd, FontItalic}, "epsilon": {"ε", classOrd, FontItalic}, "varepsilon": {"ε", classOrd, FontItalic},
+	"zeta": {"ζ", classOrd, FontItalic}, "eta": {"η", classOrd, FontItalic}, "theta": {"θ", classOrd, FontItalic},
+	"vartheta": {"θ", classOrd, FontItalic}, "iota": {"ι", classOrd, FontItalic}, "kappa": {"κ", classOrd, FontItalic},
+	"lambda": {"λ", classOrd, FontItalic}, "mu": {"μ", classOrd, FontItalic}, "nu": {"ν", classOrd, FontItalic},
+	"xi": {"ξ", classOrd, FontItalic}, "pi": {"π", classOrd, FontItalic}, "rho": {"ρ", classOrd, FontItalic},
+	"sigma": {"σ", classOrd, FontItalic}, "tau": {"τ", classOrd, FontItalic}, "upsilon": {"υ", classOrd, FontItalic},
+	"phi": {"φ", classOrd, FontItalic}, "varphi": {"φ", classOrd, FontItalic}, "chi": {"χ", classOrd, FontItalic},
+	"psi": {"ψ", classOrd, FontItalic}, "omega": {"ω", classOrd, FontItalic},
+	"Gamma": {"Γ", classOrd, FontRegular}, "Delta": {"Δ", classOrd, FontRegular}, "Theta": {"Θ", classOrd, FontRegular},
+	"Lambda": {"Λ", classOrd, FontRegular}, "Xi": {"Ξ", classOrd, FontRegular}, "Pi": {"Π", classOrd, FontRegular},
+	"Sigma": {"Σ", classOrd, FontRegular}, "Upsilon": {"Υ", classOrd, FontRegular}, "Phi": {"Φ", classOrd, FontRegular},
+	"Psi": {"Ψ", classOrd, FontRegular}, "Omega": {"Ω", classOrd, FontRegular},
+
+	"infty": {"∞", classOrd, FontRegular}, "partial": {"∂", classOrd, FontRegular}, "nabla": {"∇", classOrd, FontRegular},
+	"ell": {"ℓ", classOrd, FontRegular}, "forall": {"∀", classOrd, FontRegular}, "exists": {"∃", classOrd, FontRegular},
+	"neg": {"¬", classOrd, FontRegular}, "prime": {"′", classOrd, FontRegular}, "degree": {"°", classOrd, FontRegular},
+	"ldots": {"…", classInner, FontRegular}, "dots": {"…", classInner, FontRegular}, "cdots": {"···", classInner, FontRegular},
+
+	"pm": {"±", classBin, FontRegular}, "mp": {"∓", classBin, FontRegular}, "times": {"×", classBin, FontRegular},
+	"div": {"÷", classBin, FontRegular}, "cdot": {"·", classBin, FontRegular}, "cup": {"∪", classBin, FontRegular},
+	"cap": {"∩", classBin, FontRegular}, "circ": {"∘", classBin, FontRegular}, "oplus": {"⊕", classBin, FontRegular},
+	"otimes": {"⊗", classBin, FontRegular}, "ast": {"*", classBin, FontRegular},
+
+	"le": {"≤", classRel, FontRegular}, "leq": {"≤", classRel, FontRegular}, "ge": {"≥", classRel, FontRegular},
+	"geq": {"≥", classRel, FontRegular}, "ne": {"≠", classRel, FontRegular}, "neq": {"≠", classRel, FontRegular},
+	"approx": {"≈", classRel, FontRegular}, "equiv": {"≡", classRel, FontRegular}, "sim": {"∼", classRel, FontRegular},
+	"in": {"∈", classRel, FontRegular}, "notin": {"∉", classRel, FontRegular}, "subset": {"⊂", classRel, FontRegular},
+	"supset": {"⊃", classRel, FontRegular}, "to": {"→", classRel, FontRegular}, "rightarrow": {"→", classRel, FontRegular},
+	"leftarrow": {"←", classRel, FontRegular}, "gets": {"←", classRel, FontRegular}, "leftrightarrow": {"↔", classRel, FontRegular},
+	"Rightarrow": {"⇒", classRel, FontRegular}, "Leftrightarrow": {"⇔", classRel, FontRegular},
+	"uparrow": {"↑", classRel, FontRegular}, "downarrow": {"↓", classRel, FontRegular},
+
+	"{": {"{", classOpen, FontRegular}, "}": {"}", classClose, FontRegular}, "|": {"‖", classOrd, FontRegular},
+	"lbrace": {"{", classOpen, FontRegular}, "rbrace": {"}", classClose, FontRegular},
+	"%": {"%", classOrd, FontRegular}, "$": {"$", classOrd, FontRegular}, "#": {"#", classOrd, FontRegular},
+	"&": {"&", classOrd, FontRegular}, "_": {"_", classOrd, FontRegular},
+}
+
+// mathLargeOps are the big operators. Those with limits take their scripts
+// above and below in display style.
+var mathLargeOps = map[string]struct {
+	text   string
+	limits bool
+}{
+	"sum": {"∑", true}, "prod": {"∏", true}, "bigcup": {"∪", true}, "bigcap": {"∩", true},
+	"int": {"∫", false}, "iint": {"∫∫", false}, "iiint": {"∫∫∫", false}, "oint": {"∮", false},
+}
+
+// mathFunctions are set upright; those marked true take limits like \sum.
+var mathFunctions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false, "tanh": false,
+	"log": false, "ln": false, "lg": false, "exp": false, "deg": false, "dim": false, "arg": false,
+	"ker": false, "hom": false, "lim": true, "liminf": true, "limsup": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "gcd": true, "Pr": true,
+}
+
+var mathSpaces = map[string]float64{
+	",": 3.0 / 18, ":": 4.0 / 18, ">": 4.0 / 18, ";": 5.0 / 18, "!": -3.0 / 18,
+	" ": 0.25, "quad": 1, "qquad": 2,
+}
+
+var mathAccents = map[string]string{
+	"hat": "ˆ", "widehat": "ˆ", "tilde": "˜", "widetilde": "˜", "dot": "˙", "ddot": "¨", "vec": "→",
+	"bar": "", "overline": "", // drawn as a rule
+}
+
+// mathDelimiters maps the names accepted after \left and \right, and in
+// \begin{pmatrix} style environments, to the delimiter drawn.
+var mathDelimiters = map[string]string{
+	"(": "(", ")": ")", "[": "[", "]": "]", "|": "|", ".": "",
+	`\{`: "{", `\}`: "}", `\lbrace`: "{", `\rbrace`: "}", `\|`: "‖", `\Vert`: "‖",
+	`\vert`: "|", `\lvert`: "|", `\rvert`: "|", `\langle`: "⟨", `\rangle`: "⟩",
+}
+
+type mathParser struct {
+	src string
+	pos int
+	// Open braces, \left and \begin: their closers end a list only while
+	// one is open.
+	braces, fences, envs int
+}
+
+// parseTeX parses a formula. It never fails: unknown commands and stray
+// closers become error atoms, and unclosed groups end with the input, so a
+// typo shows up in place.
+func parseTeX(src string) []*mathNode {
+	p := &mathParser{src: src}
+	rows := p.parseRows()
+	if len(rows) == 1 && len(rows[0]) == 1 {
+		return rows[0][0]
+	}
+	// Several lines (\\) or alignment points (&) at the top level.
+	env := "gathered"
+	for _, row := range rows {
+		if len(row) > 1 {
+			env = "aligned"
+		}
+	}
+	return []*mathNode{{kind: mathMatrix, class: classInner, rows: rows, env: env}}
+}
+
+func (p *mathParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *mathParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// command reads a command name after its backslash: a run of letters, or
+// a single other character.
+func (p *mathParser) command() string {
+	start := p.pos
+	for !p.eof() && isASCIILetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start && !p.eof() {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+func isASCIILetter(b byte) bool { return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') }
+
+// atCommand reports whether the input continues with \name.
+func (p *mathParser) atCommand(name string) bool {
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, `\`+name) {
+		return false
+	}
+	rest = rest[1+len(name):]
+	return rest == "" || !isASCIILetter(rest[0])
+}
+
+// parseRows reads cells separated by & and rows separated by \\, up to a
+// closing brace, \end, \right or the end of input.
+func (p *mathParser) parseRows() [][][]*mathNode {
+	rows := [][][]*mathNode{nil}
+	for {
+		cell := p.parseList()
+		rows[len(rows)-1] = append(rows[len(rows)-1], cell)
+		switch {
+		case !p.eof() && p.src[p.pos] == '&':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], `\\`):
+			p.pos += 2
+			rows = append(rows, nil)
+		default:
+			return rows
+		}
+	}
+}
+
+// parseList reads atoms until a closing brace, &, \\, \right, \end or the
+// end of input, leaving the terminator unread.
+func (p *mathParser) parseList() []*mathNode {
+	var list []*mathNode
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return list
+		}
+		switch c := p.src[p.pos]; {
+		case c == '&', strings.HasPrefix(p.src[p.pos:], `\\`):
+			return list
+		case c == '}' && p.braces > 0, p.atCommand("right") && p.fences > 0, p.atCommand("end") && p.envs > 0:
+			return list
+		case c == '}', p.atCommand("right"), p.atCommand("end"):
+			start := p.pos
+			p.pos++
+			if c == '\\' {
+				p.command()
+			}
+			list = append(list, &mathNode{kind: mathAtom, text: p.src[start:p.pos], err: true})
+		case c == '^', c == '_':
+			p.pos++
+			list = attachScript(list, c == '^', p.parseArg())
+		case c == '\'':
+			p.pos++
+			list = attachScript(list, true, []*mathNode{{kind: mathAtom, text: "′"}})
+		default:
+			if n := p.parseAtom(); n != nil {
+				if n.kind == mathAtom && n.class == classOp && len(list) > 0 && n.text == "" {
+					// \limits or \nolimits
+					if last := list[len(list)-1]; last.kind == mathAtom && last.class == classOp {
+						last.limits = n.limits
+					}
+					continue
+				}
+				list = append(list, n)
+			}
+		}
+	}
+}
+
+// attachScript sets a sub- or superscript on the last atom of list.
+func attachScript(list []*mathNode, sup bool, arg []*mathNode) []*mathNode {
+	var n *mathNode
+	if len(list) > 0 && list[len(list)-1].kind == mathScripts {
+		n = list[len(list)-1]
+	} else {
+		base := &mathNode{kind: mathGroup}
+		if len(list) > 0 {
+			base = list[len(list)-1]
+			list = list[:len(list)-1]
+		}
+		n = &mathNode{kind: mathScripts, class: base.class, base: base}
+		list = append(list, n)
+	}
+	if sup {
+		n.sup = append(n.sup, arg...)
+	} else {
+		n.sub = append(n.sub, arg...)
+	}
+	return list
+}
+
+// parseArg reads a command argument: a braced group or a single atom.
+func (p *mathParser) parseArg() []*mathNode {
+	p.skipSpace()
+	if p.eof() {
+		return nil
+	}
+	if p.src[p.pos] == '{' {
+		return p.group()
+	}
+	if n := p.parseAtom(); n != nil {
+		return []*mathNode{n}
+	}
+	return nil
+}
+
+// group reads a braced list, starting at its opening brace.
+func (p *mathParser) group() []*mathNode {
+	p.pos++
+	p.braces++
+	list := p.parseList()
+	p.braces--
+	if !p.eof() && p.src[p.pos] == '}' {
+		p.pos++
+	}
+	return list
+}
+
+// rawArg reads a braced argument as plain text, for \text and \begin.
+func (p *mathParser) rawArg() string {
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != '{' {
+		return ""
+	}
+	depth, start := 0, p.pos+1
+	for ; !p.eof(); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.src[start : p.pos-1]
+			}
+		}
+	}
+	return p.src[start:]
+}
+
+func (p *mathParser) parseAtom() *mathNode {
+	c := p.src[p.pos]
+	switch {
+	case c == '{':
+		return &mathNode{kind: mathGroup, body: p.group()}
+	case c == '\\':
+		p.pos++
+		return p.parseCommand(p.command())
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for !p.eof() && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		return &mathNode{kind: mathAtom, text: p.src[start:p.pos]}
+	case c == '~':
+		p.pos++
+		return &mathNode{kind: mathSpace, space: mathSpaces[" "]}
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	n := &mathNode{kind: mathAtom, text: string(r)}
+	switch r {
+	case '+', '*':
+		n.class = classBin
+	case '-':
+		n.class, n.text = classBin, "−"
+	case '=', '<', '>', ':':
+		n.class = classRel
+	case ',', ';':
+		n.class = classPunct
+	case '(', '[':
+		n.class = classOpen
+	case ')', ']':
+		n.class = classClose
+	default:
+		if unicode.IsLetter(r) {
+			n.role = FontItalic
+		}
+	}
+	return n
+}
+
+func (p *mathParser) parseCommand(name string) *mathNode {
+	if sym, ok := mathSymbols[name]; ok {
+		return &mathNode{kind: mathAtom, class: sym.class, text: sym.text, role: sym.role}
+	}
+	if op, ok := mathLargeOps[name]; ok {
+		return &mathNode{kind: mathAtom, class: classOp, text: op.text, large: true, limits: op.limits}
+	}
+	if limits, ok := mathFunctions[name]; ok {
+		return &mathNode{kind: mathAtom, class: classOp, text: name, limits: limits}
+	}
+	if space, ok := mathSpaces[name]; ok {
+		return &mathNode{kind: mathSpace, space: space}
+	}
+	if accent, ok := mathAccents[name]; ok {
+		return &mathNode{kind: mathAccent, text: accent, body: p.parseArg()}
+	}
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num := p.parseArg()
+		return &mathNode{kind: mathFrac, class: classInner, num: num, den: p.parseArg()}
+	case "binom":
+		num := p.parseArg()
+		frac := &mathNode{kind: mathFrac, num: num, den: p.parseArg(), noRule: true}
+		return &mathNode{kind: mathFenced, class: classInner, open: "(", close: ")", body: []*mathNode{frac}}
+	case "sqrt":
+		n := &mathNode{kind: mathSqrt}
+		p.skipSpace()
+		if !p.eof() && p.src[p.pos] == '[' {
+			end := strings.IndexByte(p.src[p.pos:], ']')
+			if end > 0 {
+				n.index = parseTeX(p.src[p.pos+1 : p.pos+end])
+				p.pos += end + 1
+			}
+		}
+		n.body = p.parseArg()
+		return n
+	case "left":
+		n := &mathNode{kind: mathFenced, class: classInner, open: p.delimiter()}
+		p.fences++
+		n.body = p.parseList()
+		p.fences--
+		if p.atCommand("right") {
+			p.pos += len(`\right`)
+			n.close = p.delimiter()
+		}
+		return n
+	case "begin":
+		env := p.rawArg()
+		p.envs++
+		n := &mathNode{kind: mathMatrix, class: classInner, env: env, rows: p.parseRows()}
+		p.envs--
+		if last := n.rows[len(n.rows)-1]; len(n.rows) > 1 && len(last) == 1 && len(last[0]) == 0 {
+			n.rows = n.rows[:len(n.rows)-1] // trailing \\
+		}
+		if p.atCommand("end") {
+			p.pos += len(`\end`)
+			p.rawArg()
+		}
+		switch env {
+		case "pmatrix":
+			n.open, n.close = "(", ")"
+		case "bmatrix":
+			n.open, n.close = "[", "]"
+		case "Bmatrix":
+			n.open, n.close = "{", "}"
+		case "vmatrix":
+			n.open, n.close = "|", "|"
+		case "Vmatrix":
+			n.open, n.close = "‖", "‖"
+		case "cases":
+			n.open = "{"
+		case "matrix", "smallmatrix", "aligned", "align", "align*", "gathered", "array":
+		default:
+			return &mathNode{kind: mathAtom, text: `\begin{` + env + `}`, err: true}
+		}
+		return n
+	case "text", "textrm", "mbox", "textit", "textbf", "operatorname":
+		role := map[string]FontRole{"textit": FontItalic, "textbf": FontBold}[name]
+		n := &mathNode{kind: mathAtom, text: p.rawArg(), role: role}
+		if name == "operatorname" {
+			n.class = classOp
+		}
+		return n
+	case "mathrm", "mathit", "mathbf", "boldsymbol", "mathsf", "mathtt", "mathcal", "mathbb":
+		role := map[string]FontRole{"mathit": FontItalic, "mathbf": FontBold, "boldsymbol": FontBoldItalic, "mathtt": FontMono}[name]
+		body := p.parseArg()
+		setMathRole(body, role)
+		return &mathNode{kind: mathGroup, body: body}
+	case "limits", "nolimits":
+		return &mathNode{kind: mathAtom, class: classOp, limits: name == "limits"}
+	case "displaystyle", "textstyle", "scriptstyle", "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr":
+		return nil
+	}
+	return &mathNode{kind: mathAtom, text: `\` + name, err: true}
+}
+
+// delimiter reads the delimiter after \left or \right.
+func (p *mathParser) delimiter() string {
+	p.skipSpace()
+	if p.eof() {
+		return ""
+	}
+	start := p.pos
+	if p.src[p.pos] == '\\' {
+		p.pos++
+		p.command()
+	} else {
+		p.pos++
+	}
+	return mathDelimiters[p.src[start:p.pos]]
+}
+
+// setMathRole switches letters in nodes to role, for \mathrm and friends.
+func setMathRole(nodes []*mathNode, role FontRole) {
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		if n.kind == mathAtom && !n.err {
+			n.role = role
+		}
+		if n.base != nil {
+			setMathRole([]*mathNode{n.base}, role)
+		}
+		setMathRole(n.body, role)
+		setMathRole(n.num, role)
+		setMathRole(n.den, role)
+		setMathRole(n.sup, role)
+		setMathRole(n.sub, role)
+	}
+}
@@ -0,0 +1,127 @@
+package md2png
+
+import (
+	"image"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestParseMathSyntax(t *testing.T) {
+	src := []byte("Inline $x^2$ and $$\\frac12$$, but $5 and $10 are prices.\n\n$$\na + b\n= c\n$$\n\n$$\\sqrt{2}$$\n\nAfter.\n")
+	doc := parseMarkdown(src)
+	var inline []*mathInline
+	var blocks []*mathBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch m := n.(type) {
+			case *mathInline:
+				inline = append(inline, m)
+			case *mathBlock:
+				blocks = append(blocks, m)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(inline) != 2 || inline[0].tex != "x^2" || inline[0].display || inline[1].tex != `\frac12` || !inline[1].display {
+		t.Fatalf("unexpected inline math: %+v", inline)
+	}
+	if len(blocks) != 2 || blocks[0].tex != "a + b\n= c" || blocks[1].tex != `\sqrt{2}` {
+		t.Fatalf("unexpected display math: %+v", blocks)
+	}
+	if last := doc.LastChild(); last.Kind() != ast.KindParagraph || string(last.Lines().Value(src)) != "After." {
+		t.Fatalf("expected the paragraph after the blocks to survive")
+	}
+
+	// The closing $$ may end the file without a newline.
+	doc = parseMarkdown([]byte("$$\nx = 1\n$$"))
+	if m, ok := doc.FirstChild().(*mathBlock); !ok || m.tex != "x = 1" || doc.ChildCount() != 1 {
+		t.Fatalf("expected a single math block at the end of the file, got %d children", doc.ChildCount())
+	}
+}
+
+func TestParseTeX(t *testing.T) {
+	nodes := parseTeX(`\frac{a}{b} + x_i^2 - \alpha \foo }`)
+	if len(nodes) != 7 {
+		t.Fatalf("expected 7 atoms, got %d", len(nodes))
+	}
+	if nodes[0].kind != mathFrac || len(nodes[0].num) != 1 || nodes[0].num[0].text != "a" {
+		t.Fatalf("expected a fraction first, got %+v", nodes[0])
+	}
+	if s := nodes[2]; s.kind != mathScripts || s.base.text != "x" || s.sub[0].text != "i" || s.sup[0].text != "2" {
+		t.Fatalf("expected x with both scripts, got %+v", s)
+	}
+	if nodes[3].text != "−" || nodes[4].text != "α" || nodes[4].role != FontItalic {
+		t.Fatalf("expected a minus sign and an italic alpha")
+	}
+	if !nodes[5].err || nodes[5].text != `\foo` || !nodes[6].err || nodes[6].text != "}" {
+		t.Fatalf("expected the unknown command and stray brace as errors")
+	}
+
+	m := parseTeX(`\begin{pmatrix} 1 & 2 \\ 3 & 4 \\ \end{pmatrix}`)
+	if len(m) != 1 || m[0].kind != mathMatrix || len(m[0].rows) != 2 || len(m[0].rows[1]) != 2 || m[0].open != "(" {
+		t.Fatalf("expected a 2x2 parenthesised matrix, got %+v", m)
+	}
+	if lines := parseTeX(`a &= b \\ &= c`); len(lines) != 1 || lines[0].env != "aligned" {
+		t.Fatalf("expected top-level rows to become an aligned block")
+	}
+}
+
+func TestRenderMath(t *testing.T) {
+	markdown := "Text $\\frac{a}{b}$ inline.\n\n$$\n\\sum_{i=1}^n i\n$$\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var formulas []*Box
+	var lines []*Box
+	l.Walk(func(b *Box) bool {
+		switch {
+		case b.Kind == LineBox:
+			lines = append(lines, b)
+		case b.Kind == BlockBox && b.Role == RoleMath:
+			formulas = append(formulas, b)
+			return false
+		}
+		return true
+	})
+	if len(formulas) != 2 {
+		t.Fatalf("expected an inline and a display formula, got %d", len(formulas))
+	}
+
+	frac := formulas[0]
+	var num, den *Box
+	var bar bool
+	for _, b := range frac.Children {
+		switch {
+		case b.Kind == RuleBox:
+			bar = true
+		case b.Kind == GlyphRunBox && b.Run.Text == "a":
+			num = b
+		case b.Kind == GlyphRunBox && b.Run.Text == "b":
+			den = b
+		}
+	}
+	if !bar || num == nil || den == nil || num.Run.Baseline >= den.Run.Baseline {
+		t.Fatalf("expected a fraction bar with the numerator above the denominator")
+	}
+	if lines[0].Rect.Dy() <= 22 {
+		t.Fatalf("expected the line holding the fraction to grow, got height %d", lines[0].Rect.Dy())
+	}
+
+	display := formulas[1]
+	var ink image.Rectangle
+	var sum *Box
+	for _, b := range display.Children {
+		ink = ink.Union(b.Rect)
+		if b.Kind == GlyphRunBox && b.Run.Text == "∑" {
+			sum = b
+		}
+	}
+	if left, right := ink.Min.X-48, 640-48-ink.Max.X; left < 100 || right < 100 || left-right > 2 || right-left > 2 {
+		t.Fatalf("expected the display formula to be centered, got margins %d and %d", left, right)
+	}
+	if sum == nil || sum.Run.Size <= 16 {
+		t.Fatalf("expected an enlarged summation sign")
+	}
+}
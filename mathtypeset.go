@@ -0,0 +1,693 @@
+package md2png
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// ---- Math: typesetting ----
+
+// mathStyle is the TeX style: display, text, script or scriptscript.
+type mathStyle int
+
+const (
+	styleDisplay mathStyle = iota
+	styleText
+	styleScript
+	styleScriptScript
+)
+
+// script is the style of sub- and superscripts; fractions step down
+// one level in the same way.
+func (st mathStyle) script() mathStyle { return min(max(st+1, styleScript), styleScriptScript) }
+
+func (st mathStyle) fraction() mathStyle { return min(st+1, styleScriptScript) }
+
+type mathItemKind int
+
+const (
+	mathItemGlyph mathItemKind = iota
+	mathItemRule
+	mathItemPath
+)
+
+// mathItem is a glyph, rule or shape of a typeset formula, positioned
+// relative to the formula's left edge and baseline.
+type mathItem struct {
+	kind  mathItemKind
+	x, y  float64 // glyph origin, rule top-left, or path offset
+	w, h  float64 // rule size
+	text  string
+	font  *FontAndFace
+	size  float64
+	path  Path
+	color color.Color // nil for the surrounding text color
+}
+
+// mathBox is a typeset formula or part of one. Ascent and descent are
+// measured from the baseline.
+type mathBox struct {
+	width, ascent, descent float64
+	items                  []mathItem
+}
+
+// place draws child with its origin at (dx, dy), growing b to fit.
+func (b *mathBox) place(child mathBox, dx, dy float64) {
+	for _, it := range child.items {
+		it.x += dx
+		it.y += dy
+		b.items = append(b.items, it)
+	}
+	b.width = max(b.width, dx+child.width)
+	b.ascent = max(b.ascent, child.ascent-dy)
+	b.descent = max(b.descent, child.descent+dy)
+}
+
+// rule draws a filled rectangle, growing b to fit.
+func (b *mathBox) rule(x, y, w, h float64) {
+	b.items = append(b.items, mathItem{kind: mathItemRule, x: x, y: y, w: w, h: h})
+	b.ascent = max(b.ascent, -y)
+	b.descent = max(b.descent, y+h)
+}
+
+// shape draws a filled path, growing b to fit.
+func (b *mathBox) shape(path Path) {
+	for _, poly := range path {
+		for _, pt := range poly {
+			b.ascent = max(b.ascent, -pt.Y)
+			b.descent = max(b.descent, pt.Y)
+		}
+	}
+	b.items = append(b.items, mathItem{kind: mathItemPath, path: path})
+}
+
+// mathSetter typesets parsed formulas with a font set at a base size.
+type mathSetter struct {
+	fonts Fonts
+	size  float64
+	warn  color.Color
+}
+
+func (s *mathSetter) sizeOf(st mathStyle) float64 {
+	switch st {
+	case styleScript:
+		return s.size * 0.7
+	case styleScriptScript:
+		return s.size * 0.5
+	}
+	return s.size
+}
+
+// axis is the height of the math axis, where fraction bars sit and big
+// operators are centered.
+func (s *mathSetter) axis(st mathStyle) float64 { return s.sizeOf(st) * 0.25 }
+
+func (s *mathSetter) thickness(st mathStyle) float64 { return max(s.sizeOf(st)/18, 1) }
+
+func (s *mathSetter) glyph(text string, role FontRole, size float64) mathBox {
+	f := s.fonts.byRole(role)
+	if f == nil || f.Face == nil || text == "" {
+		return mathBox{}
+	}
+	scale := 1.0
+	if f.baseSize > 0 {
+		scale = size / f.baseSize
+	}
+	bounds, advance := font.BoundString(f.Face, text)
+	return mathBox{
+		width:   fixedFloat(advance) * scale,
+		ascent:  max(-fixedFloat(bounds.Min.Y)*scale, 0),
+		descent: max(fixedFloat(bounds.Max.Y)*scale, 0),
+		items:   []mathItem{{kind: mathItemGlyph, text: text, font: f, size: size}},
+	}
+}
+
+// ink returns the top and bottom of the ink of text relative to its
+// baseline, negative above it.
+func (s *mathSetter) ink(text string, role FontRole, size float64) (top, bottom float64) {
+	f := s.fonts.byRole(role)
+	if f == nil || f.Face == nil {
+		return 0, 0
+	}
+	scale := 1.0
+	if f.baseSize > 0 {
+		scale = size / f.baseSize
+	}
+	bounds, _ := font.BoundString(f.Face, text)
+	return fixedFloat(bounds.Min.Y) * scale, fixedFloat(bounds.Max.Y) * scale
+}
+
+func fixedFloat(v fixed.Int26_6) float64 { return float64(v) / 64 }
+
+// layout typesets nodes as a horizontal list in style st.
+func (s *mathSetter) layout(nodes []*mathNode, st mathStyle) mathBox {
+	var box mathBox
+	classes := atomClasses(nodes)
+	x := 0.0
+	for i, n := range nodes {
+		if i > 0 {
+			x += s.spacing(classes[i-1], classes[i], st)
+		}
+		child := s.node(n, st)
+		box.place(child, x, 0)
+		x += child.width
+	}
+	box.width = max(box.width, x)
+	return box
+}
+
+// atomClasses returns the class of each node, turning binary operators with
+// nothing to operate on into ordinary atoms, as in -x or (+).
+func atomClasses(nodes []*mathNode) []mathClass {
+	classes := make([]mathClass, len(nodes))
+	for i, n := range nodes {
+		classes[i] = n.class
+		if n.kind == mathSpace {
+			classes[i] = -1
+		}
+	}
+	prev := func(i int) mathClass {
+		for i--; i >= 0; i-- {
+			if classes[i] >= 0 {
+				return classes[i]
+			}
+		}
+		return classBin // start of list
+	}
+	for i, c := range classes {
+		if c != classBin {
+			continue
+		}
+		switch prev(i) {
+		case classBin, classOp, classRel, classOpen, classPunct:
+			classes[i] = classOrd
+		}
+	}
+	for i := len(classes) - 1; i > 0; i-- {
+		switch classes[i] {
+		case classRel, classClose, classPunct:
+			if classes[i-1] == classBin {
+				classes[i-1] = classOrd
+			}
+		}
+	}
+	return classes
+}
+
+// mathSpacing is TeX's table of spaces between atoms, in eighteenths of an
+// em. Negative entries only apply in display and text style.
+var mathSpacing = [8][8]int{
+	//  Ord Op Bin Rel Open Close Punct Inner
+	{0, 3, -4, -5, 0, 0, 0, -3},     // Ord
+	{3, 3, 0, -5, 0, 0, 0, -3},      // Op
+	{-4, -4, 0, 0, -4, 0, 0, -4},    // Bin
+	{-5, -5, 0, 0, -5, 0, 0, -5},    // Rel
+	{0, 0, 0, 0, 0, 0, 0, 0},        // Open
+	{0, 3, -4, -5, 0, 0, 0, -3},     // Close
+	{-3, -3, 0, -3, -3, -3, -3, -3}, // Punct
+	{-3, 3, -4, -5, -3, 0, -3, -3},  // Inner
+}
+
+func (s *mathSetter) spacing(left, right mathClass, st mathStyle) float64 {
+	if left < 0 || right < 0 {
+		return 0
+	}
+	v := mathSpacing[left][right]
+	if v < 0 {
+		if st >= styleScript {
+			return 0
+		}
+		v = -v
+	}
+	return float64(v) / 18 * s.sizeOf(st)
+}
+
+func (s *mathSetter) node(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	switch n.kind {
+	case mathAtom:
+		role := n.role
+		if n.class == classOp && !n.large {
+			role = FontRegular
+		}
+		if !n.large {
+			box := s.glyph(n.text, role, size)
+			if n.err {
+				for i := range box.items {
+					box.items[i].color = s.warn
+				}
+			}
+			return box
+		}
+		// Big operators grow in display style and sit on the axis.
+		if st == styleDisplay {
+			size *= 1.6
+		} else {
+			size *= 1.15
+		}
+		g := s.glyph(n.text, role, size)
+		var box mathBox
+		box.place(g, 0, (g.ascent-g.descent)/2-s.axis(st))
+		box.width += size * 0.05
+		return box
+	case mathGroup:
+		return s.layout(n.body, st)
+	case mathSpace:
+		return mathBox{width: n.space * size}
+	case mathFrac:
+		return s.fraction(n, st)
+	case mathSqrt:
+		return s.root(n, st)
+	case mathScripts:
+		return s.scripts(n, st)
+	case mathFenced:
+		body := s.layout(n.body, st)
+		return s.fence(body, n.open, n.close, st)
+	case mathMatrix:
+		return s.matrix(n, st)
+	case mathAccent:
+		return s.accent(n, st)
+	}
+	return mathBox{}
+}
+
+func (s *mathSetter) fraction(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	num := s.layout(n.num, st.fraction())
+	den := s.layout(n.den, st.fraction())
+	t := s.thickness(st)
+	gap := size * 0.1
+	if st == styleDisplay {
+		gap = size * 0.15
+	}
+	pad := size * 0.1
+	width := max(num.width, den.width) + 2*pad
+	axis := s.axis(st)
+
+	var box mathBox
+	box.place(num, (width-num.width)/2, -axis-t/2-gap-num.descent)
+	box.place(den, (width-den.width)/2, -axis+t/2+gap+den.ascent)
+	if !n.noRule {
+		box.rule(0, -axis-t/2, width, t)
+	}
+	box.width = width
+	return box
+}
+
+func (s *mathSetter) root(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	body := s.layout(n.body, st)
+	body.ascent = max(body.ascent, size*0.7)
+	body.descent = max(body.descent, size*0.2)
+	t := s.thickness(st)
+	gap := size * 0.12
+	top := -body.ascent - gap - t // top edge of the bar
+	bottom := body.descent + t
+	height := bottom - top
+	signWidth := size * 0.55
+
+	var box mathBox
+	index := s.layout(n.index, styleScriptScript)
+	shift := max(index.width-signWidth*0.55, 0)
+	if len(n.index) > 0 {
+		box.place(index, shift+signWidth*0.55-index.width, bottom-height*0.5-index.descent)
+	}
+	// The radical sign: a short rising tick, a thick down-stroke and a
+	// thin up-stroke to the bar.
+	x := shift
+	tick := PathPoint{x, bottom - height*0.45}
+	hook := PathPoint{x + signWidth*0.25, bottom - height*0.5}
+	foot := PathPoint{x + signWidth*0.55, bottom - t}
+	peak := PathPoint{x + signWidth, top + t/2}
+	box.shape(strokePolyline([]PathPoint{tick, hook}, t))
+	box.shape(strokePolyline([]PathPoint{hook, foot}, t*2))
+	box.shape(strokePolyline([]PathPoint{foot, peak}, t))
+	barLeft := x + signWidth - t/2
+	box.rule(barLeft, top, body.width+size*0.2+t/2, t)
+	box.place(body, x+signWidth+size*0.1, 0)
+	box.width = barLeft + body.width + size*0.2 + t/2
+	return box
+}
+
+func (s *mathSetter) scripts(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	base := s.node(n.base, st)
+	sub := s.layout(n.sub, st.script())
+	sup := s.layout(n.sup, st.script())
+
+	var box mathBox
+	if n.base.kind == mathAtom && n.base.class == classOp && n.base.limits && st == styleDisplay {
+		gap := size * 0.15
+		width := max(base.width, sup.width, sub.width)
+		box.place(base, (width-base.width)/2, 0)
+		if len(n.sup) > 0 {
+			box.place(sup, (width-sup.width)/2, -base.ascent-gap-sup.descent)
+		}
+		if len(n.sub) > 0 {
+			box.place(sub, (width-sub.width)/2, base.descent+gap+sub.ascent)
+		}
+		box.width = width
+		return box
+	}
+
+	box.place(base, 0, 0)
+	supY := -max(size*0.4, base.ascent-size*0.35)
+	subY := max(size*0.2, base.descent+size*0.05)
+	if len(n.sup) > 0 && len(n.sub) > 0 {
+		// Keep a gap between the two scripts.
+		if clash := (supY + sup.descent) - (subY - sub.ascent) + size*0.15; clash > 0 {
+			subY += clash
+		}
+	}
+	x := base.width
+	italic := 0.0
+	if n.base.role == FontItalic || n.base.role == FontBoldItalic || (n.base.large && !n.base.limits) {
+		italic = size * 0.08
+	}
+	width := x
+	if len(n.sup) > 0 {
+		box.place(sup, x+italic, supY)
+		width = max(width, x+italic+sup.width)
+	}
+	if len(n.sub) > 0 {
+		box.place(sub, x, subY)
+		width = max(width, x+sub.width)
+	}
+	box.width = width + size*0.05
+	return box
+}
+
+func (s *mathSetter) accent(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	body := s.layout(n.body, st)
+	var box mathBox
+	box.place(body, 0, 0)
+	gap := size * 0.08
+	if n.text == "" {
+		t := s.thickness(st)
+		box.rule(0, -max(body.ascent, size*0.5)-gap-t, body.width, t)
+		box.width = body.width
+		return box
+	}
+	markSize := size
+	if n.text == "→" {
+		markSize = size * 0.7
+	}
+	mark := s.glyph(n.text, FontRegular, markSize)
+	skew := 0.0
+	if len(n.body) == 1 && n.body[0].role == FontItalic {
+		skew = size * 0.08
+	}
+	// Accent glyphs sit well above their own baseline; line up their ink.
+	_, inkBottom := s.ink(n.text, FontRegular, markSize)
+	box.place(mark, (body.width-mark.width)/2+skew, -max(body.ascent, size*0.5)-gap-inkBottom)
+	box.width = body.width
+	return box
+}
+
+func (s *mathSetter) matrix(n *mathNode, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	cellStyle := max(st, styleText)
+	if n.env == "smallmatrix" {
+		cellStyle = st.script()
+	}
+	if n.env == "gathered" || n.env == "aligned" || n.env == "align" || n.env == "align*" {
+		cellStyle = st
+	}
+	aligned := n.env == "aligned" || n.env == "align" || n.env == "align*"
+	var cells [][]mathBox
+	var widths []float64
+	for _, row := range n.rows {
+		var boxes []mathBox
+		for j, cell := range row {
+			b := s.layout(cell, cellStyle)
+			if aligned && j%2 == 1 {
+				// The right-hand column starts with its relation; give
+				// it the space it would have after the left-hand side.
+				if classes := atomClasses(cell); len(classes) > 0 && classes[0] == classRel {
+					lead := s.spacing(classOrd, classRel, cellStyle)
+					shifted := mathBox{}
+					shifted.place(b, lead, 0)
+					b = shifted
+				}
+			}
+			boxes = append(boxes, b)
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], b.width)
+		}
+		cells = append(cells, boxes)
+	}
+
+	colGap := size
+	align := func(int) byte { return 'c' }
+	switch {
+	case n.env == "cases":
+		align = func(int) byte { return 'l' }
+	case aligned:
+		colGap = 0
+		align = func(j int) byte {
+			if j%2 == 0 {
+				return 'r'
+			}
+			return 'l'
+		}
+	case n.env == "smallmatrix":
+		colGap = size * 0.5
+	}
+	gapAfter := func(j int) float64 {
+		if aligned && j%2 == 1 {
+			return size * 2
+		}
+		return colGap
+	}
+
+	rowGap := size * 0.3
+	strutAscent, strutDescent := s.sizeOf(cellStyle)*0.75, s.sizeOf(cellStyle)*0.3
+	var grid mathBox
+	y := 0.0
+	for i, row := range cells {
+		ascent, descent := strutAscent, strutDescent
+		for _, b := range row {
+			ascent, descent = max(ascent, b.ascent), max(descent, b.descent)
+		}
+		if i > 0 {
+			y += rowGap
+		}
+		y += ascent
+		x := 0.0
+		for j, b := range row {
+			switch align(j) {
+			case 'c':
+				grid.place(b, x+(widths[j]-b.width)/2, y)
+			case 'r':
+				grid.place(b, x+widths[j]-b.width, y)
+			default:
+				grid.place(b, x, y)
+			}
+			x += widths[j] + gapAfter(j)
+		}
+		y += descent
+	}
+	total := 0.0
+	for j, w := range widths {
+		total += w
+		if j < len(widths)-1 {
+			total += gapAfter(j)
+		}
+	}
+	grid.width = total
+
+	// Center the grid on the axis.
+	var box mathBox
+	box.place(grid, 0, -s.axis(st)-y/2)
+	box.ascent = max(box.ascent, s.axis(st)+y/2)
+	box.descent = max(box.descent, y/2-s.axis(st))
+	if n.open == "" && n.close == "" {
+		return box
+	}
+	return s.fence(box, n.open, n.close, st)
+}
+
+// fence surrounds body with delimiters tall enough to cover it, centered on
+// the axis.
+func (s *mathSetter) fence(body mathBox, open, close string, st mathStyle) mathBox {
+	size := s.sizeOf(st)
+	axis := s.axis(st)
+	half := max(body.ascent-axis, body.descent+axis, size*0.6) + size*0.1
+	top, bottom := -axis-half, -axis+half
+
+	var box mathBox
+	x := 0.0
+	if open != "" {
+		x += s.delimiter(&box, open, x, top, bottom, size, false) + size*0.1
+	}
+	box.place(body, x, 0)
+	x += body.width
+	if close != "" {
+		x += size * 0.1
+		x += s.delimiter(&box, close, x, top, bottom, size, true)
+	}
+	box.width = x
+	return box
+}
+
+// delimiter draws a stretchy delimiter between top and bottom with its left
+// edge at x, returning its width. right mirrors ( [ { and ⟨.
+func (s *mathSetter) delimiter(box *mathBox, delim string, x, top, bottom, size float64, right bool) float64 {
+	height := bottom - top
+	t := max(size*0.07, 1)
+	width := min(size*0.25+height*0.04, size*0.6)
+	mirror := func(pts []PathPoint) []PathPoint {
+		out := make([]PathPoint, len(pts))
+		for i, p := range pts {
+			if right {
+				p.X = width - p.X
+			}
+			out[i] = PathPoint{x + p.X, p.Y}
+		}
+		return out
+	}
+	switch delim {
+	case "(", ")":
+		var pts []PathPoint
+		const steps = 16
+		for i := 0; i <= steps; i++ {
+			a := math.Pi * float64(i) / steps
+			pts = append(pts, PathPoint{width - t/2 - (width-t)*math.Sin(a), top + height*(1-math.Cos(a))/2})
+		}
+		box.shape(strokePolyline(mirror(pts), t))
+	case "[", "]":
+		width = size * 0.3
+		pts := mirror([]PathPoint{{width, top + t/2}, {t / 2, top + t/2}, {t / 2, bottom - t/2}, {width, bottom - t/2}})
+		box.shape(strokePolyline(pts, t))
+	case "{", "}":
+		mid := (top + bottom) / 2
+		q := min(width*0.5, height/4)
+		xr, xm, xl := width-t/2, width/2, t/2
+		var pts []PathPoint
+		pts = append(pts, quadPoints(PathPoint{xr, top + t/2}, PathPoint{xm, top + t/2}, PathPoint{xm, top + q})...)
+		pts = append(pts, quadPoints(PathPoint{xm, mid - q}, PathPoint{xm, mid}, PathPoint{xl, mid})...)
+		pts = append(pts, quadPoints(PathPoint{xl, mid}, PathPoint{xm, mid}, PathPoint{xm, mid + q})...)
+		pts = append(pts, quadPoints(PathPoint{xm, bottom - q}, PathPoint{xm, bottom - t/2}, PathPoint{xr, bottom - t/2})...)
+		box.shape(strokePolyline(mirror(pts), t))
+	case "⟨", "⟩":
+		pts := mirror([]PathPoint{{width - t/2, top}, {t / 2, (top + bottom) / 2}, {width - t/2, bottom}})
+		box.shape(strokePolyline(pts, t))
+	case "|":
+		width = t + size*0.1
+		box.rule(x+size*0.05, top, t, height)
+	case "‖":
+		width = 3*t + size*0.1
+		box.rule(x+size*0.05, top, t, height)
+		box.rule(x+size*0.05+2*t, top, t, height)
+	default:
+		return 0
+	}
+	return width
+}
+
+// quadPoints samples the quadratic Bézier curve from a to b with control c.
+func quadPoints(a, c, b PathPoint) []PathPoint {
+	const steps = 6
+	pts := make([]PathPoint, 0, steps+1)
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / steps
+		u := 1 - t
+		pts = append(pts, PathPoint{u*u*a.X + 2*u*t*c.X + t*t*b.X, u*u*a.Y + 2*u*t*c.Y + t*t*b.Y})
+	}
+	return pts
+}
+
+// strokePolyline covers a line of the given width through pts, with square
+// joins so the segments meet without gaps.
+func strokePolyline(pts []PathPoint, width float64) Path {
+	var path Path
+	for i := 1; i < len(pts); i++ {
+		if seg := strokeSegment(pts[i-1], pts[i], width); seg != nil {
+			path = append(path, seg)
+		}
+		if i < len(pts)-1 {
+			p, h := pts[i], width/2
+			path = append(path, []PathPoint{{p.X - h, p.Y - h}, {p.X + h, p.Y - h}, {p.X + h, p.Y + h}, {p.X - h, p.Y + h}})
+		}
+	}
+	return path
+}
+
+// ---- Math: layout ----
+
+// typesetMath parses and typesets tex at the renderer's base size.
+func (r *renderer) typesetMath(tex string, display bool, size float64) mathBox {
+	s := &mathSetter{fonts: r.c.fonts, size: size, warn: r.c.th.Warning}
+	st := styleText
+	if display {
+		st = styleDisplay
+	}
+	return s.layout(parseTeX(tex), st)
+}
+
+// mathBoxes converts a typeset formula to layout boxes with its left edge at
+// x and its baseline at baseline.
+func (c *canvas) mathBoxes(m mathBox, x, baseline int, col color.Color) []*Box {
+	var boxes []*Box
+	for _, it := range m.items {
+		fill := it.color
+		if fill == nil {
+			fill = col
+		}
+		ox, oy := float64(x)+it.x, float64(baseline)+it.y
+		switch it.kind {
+		case mathItemGlyph:
+			boxes = append(boxes, c.glyphRun(GlyphRun{
+				Text:     it.text,
+				Font:     it.font,
+				Size:     it.size,
+				Color:    fill,
+				Baseline: int(math.Round(oy)),
+			}, int(math.Round(ox))))
+		case mathItemRule:
+			top := int(math.Round(oy))
+			rect := image.Rect(int(math.Round(ox)), top, int(math.Round(ox+it.w)), max(int(math.Round(oy+it.h)), top+1))
+			boxes = append(boxes, &Box{Kind: RuleBox, Rect: rect, Fill: fill})
+		case mathItemPath:
+			path := make(Path, len(it.path))
+			bounds := image.Rectangle{}
+			for i, poly := range it.path {
+				path[i] = make([]PathPoint, len(poly))
+				for j, p := range poly {
+					p = PathPoint{p.X + ox, p.Y + oy}
+					path[i][j] = p
+					pt := image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Ceil(p.X))+1, int(math.Ceil(p.Y))+1)
+					if bounds.Empty() {
+						bounds = pt
+					} else {
+						bounds = bounds.Union(pt)
+					}
+				}
+			}
+			boxes = append(boxes, &Box{Kind: PathBox, Rect: bounds, Fill: fill, Path: path})
+		}
+	}
+	return boxes
+}
+
+// drawMathBlock lays out a display formula centered between left and right.
+func (r *renderer) drawMathBlock(tex string, left, right int) {
+	m := r.typesetMath(tex, true, r.baseSize)
+	pad := int(r.baseSize * 0.3)
+	block := r.c.beginBlock(RoleMath, left, right)
+	r.c.addVSpace(pad)
+	x := left + max((right-left-int(math.Ceil(m.width)))/2, 0)
+	baseline := r.c.cursorY + int(math.Ceil(m.ascent))
+	for _, b := range r.c.mathBoxes(m, x, baseline, r.c.th.FG) {
+		r.c.add(b)
+	}
+	r.c.cursorY = baseline + int(math.Ceil(m.descent)) + pad
+	r.c.endBlock(block)
+}
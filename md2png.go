@@ -2,19 +2,20 @@ package md2png
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
-	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
@@ -25,6 +26,8 @@ import (
 	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
 	"golang.org/x/image/font/gofont/gomono"
 	"golang.org/x/image/font/gofont/goregular"
 )
@@ -46,6 +49,12 @@ type Theme struct {
 	CodeBG   color.Color
 	QuoteBar color.Color
 	HRule    color.Color
+	Link     color.Color
+	Warning  color.Color // unsupported-content notices and missing images
+	Syntax   SyntaxTheme
+	Alerts   AlertTheme
+	Tables   TableTheme
+	Style    StyleSheet
 }
 
 var (
@@ -56,6 +65,11 @@ var (
 		CodeBG:   color.RGBA{0xF5, 0xF5, 0xF7, 0xFF},
 		QuoteBar: color.RGBA{0xCC, 0xCC, 0xCC, 0xFF},
 		HRule:    color.RGBA{0xDD, 0xDD, 0xDD, 0xFF},
+		Link:     linkColor,
+		Warning:  warningColor,
+		Syntax:   lightSyntax,
+		Alerts:   lightAlerts,
+		Tables:   lightTables,
 	}
 	// Dark theme defaults
 	darkTheme = Theme{
@@ -64,7 +78,14 @@ var (
 		CodeBG:   color.RGBA{0x1E, 0x1E, 0x22, 0xFF},
 		QuoteBar: color.RGBA{0x44, 0x44, 0x48, 0xFF},
 		HRule:    color.RGBA{0x33, 0x33, 0x36, 0xFF},
-	}
+		Link:     color.RGBA{0x58, 0xA6, 0xFF, 0xFF},
+		Warning:  color.RGBA{0xF0, 0x88, 0x3E, 0xFF},
+		Syntax:   darkSyntax,
+		Alerts:   darkAlerts,
+		Tables:   darkTables,
+	}
+	// Link and warning colors of the light theme, also used for themes that
+	// leave them unset.
 	linkColor    = color.RGBA{0x06, 0x4F, 0xBD, 0xFF}
 	warningColor = color.RGBA{0xD9, 0x51, 0x2C, 0xFF}
 )
@@ -75,19 +96,24 @@ type FontAndFace struct {
 	Font     *truetype.Font
 	Face     font.Face
 	baseSize float64
+	ttf      []byte // original font file, kept for backends that embed fonts
 }
 
 type Fonts struct {
-	Regular *FontAndFace
-	Bold    *FontAndFace
-	Mono    *FontAndFace
+	Regular    *FontAndFace
+	Bold       *FontAndFace
+	Italic     *FontAndFace
+	BoldItalic *FontAndFace
+	Mono       *FontAndFace
 }
 
 type FontConfig struct {
-	RegularPath string
-	BoldPath    string
-	MonoPath    string
-	SizeBase    float64 // paragraph font size in pt
+	RegularPath    string
+	BoldPath       string
+	ItalicPath     string
+	BoldItalicPath string
+	MonoPath       string
+	SizeBase       float64 // paragraph font size in pt
 }
 
 func loadFontAndFace(ttfBytes []byte, size float64) (*FontAndFace, error) {
@@ -100,110 +126,174 @@ func loadFontAndFace(ttfBytes []byte, size float64) (*FontAndFace, error) {
 		Font:     ft,
 		Face:     face,
 		baseSize: size,
+		ttf:      ttfBytes,
 	}, err
 }
 
 func loadFonts(cfg FontConfig) (Fonts, error) {
 	var f Fonts
-	var err error
-
-	// RegularFace
-	if cfg.RegularPath != "" {
-		b, e := os.ReadFile(cfg.RegularPath)
-		if e != nil {
-			return f, e
-		}
-		f.Regular, err = loadFontAndFace(b, cfg.SizeBase)
-		if err != nil {
-			return f, err
+	faces := []struct {
+		dst      **FontAndFace
+		path     string
+		fallback []byte
+	}{
+		{&f.Regular, cfg.RegularPath, goregular.TTF},
+		{&f.Bold, cfg.BoldPath, gobold.TTF},
+		{&f.Italic, cfg.ItalicPath, goitalic.TTF},
+		{&f.BoldItalic, cfg.BoldItalicPath, gobolditalic.TTF},
+		{&f.Mono, cfg.MonoPath, gomono.TTF},
+	}
+	for _, face := range faces {
+		ttf := face.fallback
+		if face.path != "" {
+			b, err := os.ReadFile(face.path)
+			if err != nil {
+				return f, err
+			}
+			ttf = b
 		}
-	} else {
-		f.Regular, err = loadFontAndFace(goregular.TTF, cfg.SizeBase)
+		loaded, err := loadFontAndFace(ttf, cfg.SizeBase)
 		if err != nil {
 			return f, err
 		}
+		*face.dst = loaded
 	}
-	// Bold
-	if cfg.BoldPath != "" {
-		b, e := os.ReadFile(cfg.BoldPath)
-		if e != nil {
-			return f, e
-		}
-		f.Bold, err = loadFontAndFace(b, cfg.SizeBase)
-		if err != nil {
-			return f, err
-		}
+	return f, nil
+}
+
+// emphasized returns the face for text set in font with emphasis of the given
+// level applied: level 1 adds italic and level 2 adds bold. Emphasis
+// composes, so bold inside italic (or italic inside bold) is bold italic.
+// Faces outside the regular family, such as Mono, are returned unchanged.
+func (f Fonts) emphasized(font *FontAndFace, level int) *FontAndFace {
+	bold := font == f.Bold || font == f.BoldItalic
+	italic := font == f.Italic || font == f.BoldItalic
+	if font != f.Regular && !bold && !italic {
+		return font
+	}
+	if level >= 2 {
+		bold = true
 	} else {
-		f.Bold, err = loadFontAndFace(gobold.TTF, cfg.SizeBase)
-		if err != nil {
-			return f, err
-		}
+		italic = true
 	}
-	// Mono
-	if cfg.MonoPath != "" {
-		b, e := os.ReadFile(cfg.MonoPath)
-		if e != nil {
-			return f, e
-		}
-		f.Mono, err = loadFontAndFace(b, cfg.SizeBase)
-		if err != nil {
-			return f, err
-		}
-	} else {
-		f.Mono, err = loadFontAndFace(gomono.TTF, cfg.SizeBase)
-		if err != nil {
-			return f, err
-		}
+	switch {
+	case bold && italic && f.BoldItalic != nil:
+		return f.BoldItalic
+	case bold && f.Bold != nil:
+		return f.Bold
+	case italic && f.Italic != nil:
+		return f.Italic
 	}
-	return f, nil
+	return font
 }
 
 // ---- Layout primitives ----
 
+// canvas lays out content top to bottom, recording what it places as a tree
+// of positioned boxes. Painting happens later, from the finished Layout.
 type canvas struct {
-	img     *image.RGBA
-	dc      *freetype.Context
-	w, h    int
+	root    *Box
+	stack   []*Box
+	w       int
+	pageW   int // the requested width, before wide tables widen w
 	margin  int
 	cursorY int
 	lineGap int // pixels between text lines
 	th      Theme
 	fonts   Fonts
 	ptSize  float64
+
+	maxImageHeight int  // pixels, 0 for no limit
+	upscaleImages  bool // scale block images up to the text width
 }
 
 func newCanvas(width int, margin int, th Theme, fonts Fonts, ptSize float64) *canvas {
-	// Start tall; we'll crop later
-	img := image.NewRGBA(image.Rect(0, 0, width, 4096*2))
-	dc := freetype.NewContext()
-	dc.SetDPI(96)
-	dc.SetClip(img.Bounds())
-	dc.SetDst(img)
-	dc.SetSrc(image.NewUniform(th.FG))
-	dc.SetFont(nil)
-	dc.SetFontSize(ptSize)
-
-	// Fill BG
-	draw.Draw(img, img.Bounds(), image.NewUniform(th.BG), image.Point{}, draw.Src)
-
 	return &canvas{
-		img:     img,
-		dc:      dc,
+		root:    &Box{Kind: BlockBox, Role: RoleDocument},
 		w:       width,
-		h:       img.Bounds().Dy(),
+		pageW:   width,
 		margin:  margin,
 		cursorY: margin,
 		lineGap: 4,
-		th:      th,
+		th:      withStyleDefaults(th),
 		fonts:   fonts,
 		ptSize:  ptSize,
 	}
 }
 
-func (c *canvas) setFace(fnt *FontAndFace, color color.Color, size float64) {
-	c.dc.SetFontSize(size)
-	c.dc.SetSrc(image.NewUniform(color))
-	c.dc.SetFont(fnt.Font)
+// withStyleDefaults returns th with its style sheet's zero fields filled in.
+func withStyleDefaults(th Theme) Theme {
+	th.Style = th.Style.withDefaults()
+	return th
+}
+
+// add appends b to the innermost open block.
+func (c *canvas) add(b *Box) {
+	parent := c.root
+	if n := len(c.stack); n > 0 {
+		parent = c.stack[n-1]
+	}
+	parent.Children = append(parent.Children, b)
+}
+
+// beginBlock opens a block box at the cursor. Boxes added until the matching
+// endBlock become its children.
+func (c *canvas) beginBlock(role string, left, right int) *Box {
+	b := &Box{Kind: BlockBox, Role: role, Rect: image.Rect(left, c.cursorY, right, c.cursorY)}
+	c.add(b)
+	c.stack = append(c.stack, b)
+	return b
+}
+
+// endBlock closes b (and anything still open inside it), extending it down to
+// the cursor.
+func (c *canvas) endBlock(b *Box) {
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i] == b {
+			c.stack = c.stack[:i]
+			break
+		}
+	}
+	if c.cursorY > b.Rect.Max.Y {
+		b.Rect.Max.Y = c.cursorY
+	}
+}
+
+// contentBottom returns the lowest edge of b's children, or top when it has
+// none. Blocks leave their spacing below them, outside their boxes.
+func contentBottom(b *Box, top int) int {
+	for _, child := range b.Children {
+		top = max(top, child.Rect.Max.Y)
+	}
+	return top
+}
+
+func (c *canvas) fillRect(rect image.Rectangle, col color.Color) {
+	c.add(&Box{Kind: RuleBox, Rect: rect, Fill: col})
+}
+
+// glyphRun builds a run box for text whose baseline starts at (x, baseline).
+func (c *canvas) glyphRun(run GlyphRun, x int) *Box {
+	if run.Font == nil {
+		run.Font = c.fonts.Regular
+	}
+	width := int(measureWidth(run.Font, run.Size, run.Text))
+	ascent, descent := fontExtents(run.Font, run.Size)
+	return &Box{
+		Kind: GlyphRunBox,
+		Rect: image.Rect(x, run.Baseline-ascent, x+width, run.Baseline+descent),
+		Run:  &run,
+	}
+}
+
+// layout finalises the tree, sizing the document to the content drawn so far.
+func (c *canvas) layout() *Layout {
+	used := c.cursorY + c.margin
+	if used < c.margin+50 {
+		used = c.margin + 50
+	}
+	c.root.Rect = image.Rect(0, 0, c.w, used)
+	return &Layout{Width: c.w, Height: used, Margin: c.margin, Background: c.th.BG, Root: c.root}
 }
 
 func getNodeText(n ast.Node, md []byte) string {
@@ -227,17 +317,26 @@ func getNodeText(n ast.Node, md []byte) string {
 	return string(b)
 }
 
+// sizedFaces caches a hinted face per font and size, so text is measured
+// with the same rounded advances the raster painter draws it with.
+var sizedFaces sync.Map // sizedFaceKey -> *sizedFace
+
+type sizedFaceKey struct {
+	font *truetype.Font
+	size float64
+}
+
+// sizedFace guards a face; truetype faces keep glyph caches and are not safe
+// for concurrent use.
+type sizedFace struct {
+	mu   sync.Mutex
+	face font.Face
+}
+
 func measureWidth(fnt *FontAndFace, size float64, s string) float64 {
 	if fnt == nil || s == "" {
 		return 0
 	}
-	// freetype.Context lacks a direct width measurement; approximate using font.Drawer
-	var d font.Drawer
-	d.Face = fnt.Face
-	// d.Dot fixed point ignores size; face was created at size
-	d.Src = image.NewUniform(color.Black)
-	d.Dst = nil
-	width := float64(d.MeasureString(s).Round())
 	base := fnt.baseSize
 	if base <= 0 {
 		base = size
@@ -248,70 +347,153 @@ func measureWidth(fnt *FontAndFace, size float64, s string) float64 {
 	if size <= 0 {
 		size = base
 	}
-	if size <= 0 {
-		size = 1
+	if fnt.Font != nil {
+		key := sizedFaceKey{fnt.Font, size}
+		v, ok := sizedFaces.Load(key)
+		if !ok {
+			face := truetype.NewFace(fnt.Font, &truetype.Options{Size: size, DPI: 96, Hinting: font.HintingFull})
+			v, _ = sizedFaces.LoadOrStore(key, &sizedFace{face: face})
+		}
+		sf := v.(*sizedFace)
+		sf.mu.Lock()
+		defer sf.mu.Unlock()
+		return float64(font.MeasureString(sf.face, s).Round())
+	}
+	if fnt.Face == nil {
+		return 0
 	}
+	// Without the parsed font only the base face is available; scale its width.
+	width := float64(font.MeasureString(fnt.Face, s).Round())
 	if size != base {
 		width *= size / base
 	}
 	return width
 }
 
+// fontExtents returns the ascent and descent of fnt scaled to size, in pixels.
+func fontExtents(fnt *FontAndFace, size float64) (ascent, descent int) {
+	if fnt == nil || fnt.Face == nil {
+		return int(size), int(size * 0.3)
+	}
+	m := fnt.Face.Metrics()
+	scale := 1.0
+	if fnt.baseSize > 0 && size > 0 {
+		scale = size / fnt.baseSize
+	}
+	return int(float64(m.Ascent.Ceil()) * scale), int(float64(m.Descent.Ceil()) * scale)
+}
+
 func (c *canvas) addVSpace(px int) { c.cursorY += px }
 
-func (c *canvas) drawHRule() {
+func (c *canvas) drawHRule(left, right int) {
 	y := c.cursorY + 4
-	rect := image.Rect(c.margin, y, c.w-c.margin, y+2)
-	draw.Draw(c.img, rect, image.NewUniform(c.th.HRule), image.Point{}, draw.Src)
+	c.fillRect(image.Rect(left, y, right, y+2), c.th.HRule)
 	c.cursorY = y + 10
 }
 
-func (c *canvas) drawBlockquoteBar(topY, height int) {
-	x0 := c.margin
-	rect := image.Rect(x0, topY, x0+4, topY+height)
-	draw.Draw(c.img, rect, image.NewUniform(c.th.QuoteBar), image.Point{}, draw.Src)
+func (c *canvas) drawBlockquoteBar(x0, topY, height int) {
+	c.fillRect(image.Rect(x0, topY, x0+max(c.th.Style.Blockquote.BarWidth, 0), topY+height), c.th.QuoteBar)
 }
 
-func (c *canvas) drawCodeBlock(text string, left, right int, size float64) {
-	pad := 10
+// drawCodeBlock draws text in a shaded block. When lang names a language
+// highlightCode knows, tokens are colored from the theme's Syntax palette.
+func (c *canvas) drawCodeBlock(text, lang string, left, right int, size float64) {
+	st := c.th.Style.Code
+	if lang == "mermaid" && c.drawDiagram(text, left, right) {
+		c.cursorY += c.em(st.SpaceAfter)
+		return
+	}
+	pad := c.em(st.Padding)
 	top := c.cursorY
-	// measure height by counting wrapped lines
 	mono := c.fonts.Mono
-	lines := wrapLines(mono, size, text, float64(right-left-2*pad))
-	lineHeight := int(size * 1.4)
+	// The Go fonts have no tab glyph; expand tabs to four spaces.
+	text = strings.ReplaceAll(text, "\t", "    ")
+	highlighted := codeLines(highlightCode(lang, text))
+	var lines [][]codeSpan
+	for i, src := range strings.Split(text, "\n") {
+		src = strings.TrimSuffix(src, "\r")
+		spans := []codeSpan{{src, tokText}}
+		if i < len(highlighted) && highlighted[i] != nil {
+			spans = highlighted[i]
+		}
+		for _, piece := range wrapLines(mono, size, src, float64(right-left-2*pad)) {
+			lines = append(lines, takeSpans(&spans, len(piece)))
+		}
+	}
+	lineHeight := int(size * st.LineHeight)
 	height := len(lines)*lineHeight + 2*pad + 6
-	// bg
-	rect := image.Rect(left, top, right, top+height)
-	draw.Draw(c.img, rect, image.NewUniform(c.th.CodeBG), image.Point{}, draw.Src)
+	block := c.beginBlock(RoleCode, left, right)
+	block.Fill = c.th.CodeBG
 
-	// draw text
-	c.setFace(mono, c.th.FG, size)
 	y := top + pad + int(size)
-	for _, ln := range lines {
-		pt := freetype.Pt(left+pad, y)
-		_, _ = c.dc.DrawString(ln, pt)
+	for _, spans := range lines {
+		lineTop := y - int(size)
+		line := &Box{Kind: LineBox, Rect: image.Rect(left+pad, lineTop, left+pad, lineTop+lineHeight)}
+		prefix := ""
+		for _, span := range spans {
+			// Position each run from the width of the whole prefix so rounding
+			// does not accumulate along the line.
+			x := left + pad + int(measureWidth(mono, size, prefix))
+			prefix += span.text
+			if strings.TrimSpace(span.text) == "" {
+				continue
+			}
+			col := c.th.Syntax.color(span.kind, c.th.FG)
+			run := c.glyphRun(GlyphRun{Text: span.text, Font: mono, Size: size, Color: col, Baseline: y}, x)
+			line.Children = append(line.Children, run)
+			line.Rect.Max.X = run.Rect.Max.X
+		}
+		c.add(line)
 		y += lineHeight
 	}
-	c.cursorY = top + height + 6
+	c.cursorY = top + height
+	c.endBlock(block)
+	c.cursorY += c.em(st.SpaceAfter)
+}
+
+// takeSpans removes the first n bytes of text from spans and returns them as
+// spans of their own.
+func takeSpans(spans *[]codeSpan, n int) []codeSpan {
+	var out []codeSpan
+	for n > 0 && len(*spans) > 0 {
+		s := (*spans)[0]
+		if len(s.text) > n {
+			out = append(out, codeSpan{s.text[:n], s.kind})
+			(*spans)[0].text = s.text[n:]
+			break
+		}
+		out = append(out, s)
+		n -= len(s.text)
+		*spans = (*spans)[1:]
+	}
+	return out
+}
+
+// fitImage returns the size an image of the given bounds is drawn at when it
+// may be at most maxWidth pixels wide, preserving its aspect ratio.
+func fitImage(bounds image.Rectangle, maxWidth int) (int, int) {
+	w, h := bounds.Dx(), bounds.Dy()
+	if maxWidth <= 0 || w <= maxWidth {
+		return w, h
+	}
+	scale := float64(maxWidth) / float64(w)
+	h = int(float64(h) * scale)
+	if h <= 0 {
+		h = 1
+	}
+	return maxWidth, h
 }
 
-func scaleImageToWidth(img image.Image, maxWidth int) image.Image {
+// scaleImage resamples img to exactly width x height pixels.
+func scaleImage(img image.Image, width, height int) image.Image {
 	if img == nil {
 		return nil
 	}
-	if maxWidth <= 0 {
-		return img
-	}
 	bounds := img.Bounds()
-	if bounds.Dx() <= maxWidth {
+	if width <= 0 || height <= 0 || (bounds.Dx() == width && bounds.Dy() == height) {
 		return img
 	}
-	scale := float64(maxWidth) / float64(bounds.Dx())
-	height := int(float64(bounds.Dy()) * scale)
-	if height <= 0 {
-		height = 1
-	}
-	dst := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
 	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
 	return dst
 }
@@ -413,20 +595,27 @@ type renderer struct {
 	linkFootnotes  bool
 	imageFootnotes bool
 	footnoteIndex  map[string]int
-	footnotes      []string
+	noteIndex      map[*extensionAST.Footnote]int
+	noteDefs       map[int]*extensionAST.Footnote
+	footnotes      []footnote
 	baseDir        string
 	imageCache     map[string]image.Image
 	imageResolvers map[string]imageResolver
 	httpClient     *http.Client
+	htmlBlocks     []htmlBlock
+	tableOverflow  TableOverflow
+	diagnostics    []Diagnostic
+	onDiagnostic   func(Diagnostic)
 }
 
-type imageResolver func(dest string) (cacheKey string, loader func() (image.Image, error), err error)
+// footnote is an entry of the footnote list: either a link or image
+// destination, or a Markdown footnote definition.
+type footnote struct {
+	text string
+	note *extensionAST.Footnote
+}
 
-const (
-	listIndentStep  = 32
-	listMarkerWidth = 28
-	listMarkerGap   = 8
-)
+type imageResolver func(dest string) (cacheKey string, loader func() (image.Image, error), err error)
 
 type textToken struct {
 	text      string
@@ -434,9 +623,16 @@ type textToken struct {
 	size      float64
 	color     color.Color
 	underline bool
+	strike    bool
+	rise      int // pixels above the baseline, for superscripts
 	newline   bool
 	image     image.Image
-	center    bool
+	width     int      // requested image size in pixels, from size hints or <img> attributes
+	height    int      //
+	inline    bool     // draws the image within the line, on the baseline
+	formula   *mathBox // inline math, placed on the baseline like a word
+	key       bool     // drawn as a key cap, for <kbd>
+	center    bool     // centers the image, or the line holding the text
 }
 
 func (r *renderer) ensureFootnote(raw string) int {
@@ -451,10 +647,47 @@ func (r *renderer) ensureFootnote(raw string) int {
 	}
 	idx := len(r.footnotes) + 1
 	r.footnoteIndex[raw] = idx
-	r.footnotes = append(r.footnotes, raw)
+	r.footnotes = append(r.footnotes, footnote{text: raw})
 	return idx
 }
 
+// ensureNoteFootnote numbers a Markdown footnote definition in the same
+// sequence as link footnotes, in order of first reference.
+func (r *renderer) ensureNoteFootnote(note *extensionAST.Footnote) int {
+	if note == nil {
+		return 0
+	}
+	if r.noteIndex == nil {
+		r.noteIndex = make(map[*extensionAST.Footnote]int)
+	}
+	if idx, ok := r.noteIndex[note]; ok {
+		return idx
+	}
+	idx := len(r.footnotes) + 1
+	r.noteIndex[note] = idx
+	r.footnotes = append(r.footnotes, footnote{note: note})
+	return idx
+}
+
+// footnoteDefinitions detaches the footnote list goldmark appends to doc and
+// returns its definitions by goldmark's footnote index.
+func footnoteDefinitions(doc ast.Node) map[int]*extensionAST.Footnote {
+	defs := make(map[int]*extensionAST.Footnote)
+	for child := doc.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		if list, ok := child.(*extensionAST.FootnoteList); ok {
+			for n := list.FirstChild(); n != nil; n = n.NextSibling() {
+				if note, ok := n.(*extensionAST.Footnote); ok {
+					defs[note.Index] = note
+				}
+			}
+			doc.RemoveChild(doc, child)
+		}
+		child = next
+	}
+	return defs
+}
+
 func (r *renderer) appendFootnoteMarker(out *[]textToken, size float64, index int) {
 	if out == nil || index <= 0 {
 		return
@@ -471,6 +704,7 @@ func (r *renderer) appendFootnoteMarker(out *[]textToken, size float64, index in
 		font:  r.c.fonts.Regular,
 		size:  markerSize,
 		color: r.c.th.FG,
+		rise:  int(markerSize * 0.4),
 	})
 }
 
@@ -553,11 +787,7 @@ func (r *renderer) resolveLocalImage(dest string) (string, func() (image.Image,
 			return nil, err
 		}
 		defer func() { _ = f.Close() }()
-		img, _, err := image.Decode(f)
-		if err != nil {
-			return nil, err
-		}
-		return img, nil
+		return r.decodeImage(f)
 	}
 	return cleaned, loader, nil
 }
@@ -577,11 +807,7 @@ func (r *renderer) resolveRemoteImage(dest string) (string, func() (image.Image,
 		if resp.StatusCode != http.StatusOK {
 			return nil, fmt.Errorf("md2png: fetching image %s: %s", url, resp.Status)
 		}
-		img, _, err := image.Decode(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return img, nil
+		return r.decodeImage(resp.Body)
 	}
 	return url, loader, nil
 }
@@ -590,6 +816,8 @@ func (r *renderer) collectInlineTokens(node ast.Node, md []byte, font *FontAndFa
 	if font == nil {
 		font = r.c.fonts.Regular
 	}
+	var inline htmlInline
+	defer r.closeInlineHTML(&inline, size, out)
 	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
 		switch c := child.(type) {
 		case *ast.Text:
@@ -610,9 +838,9 @@ func (r *renderer) collectInlineTokens(node ast.Node, md []byte, font *FontAndFa
 			}
 		case *ast.Link:
 			before := len(*out)
-			r.collectInlineTokens(c, md, font, size, linkColor, out)
+			r.collectInlineTokens(c, md, font, size, r.c.th.Link, out)
 			for i := before; i < len(*out); i++ {
-				(*out)[i].color = linkColor
+				(*out)[i].color = r.c.th.Link
 				(*out)[i].underline = true
 			}
 			if r.linkFootnotes {
@@ -625,7 +853,7 @@ func (r *renderer) collectInlineTokens(node ast.Node, md []byte, font *FontAndFa
 				label = string(c.URL(md))
 			}
 			if label != "" {
-				*out = append(*out, textToken{text: label, font: font, size: size, color: linkColor, underline: true})
+				*out = append(*out, textToken{text: label, font: font, size: size, color: r.c.th.Link, underline: true})
 			}
 			if r.linkFootnotes {
 				idx := r.ensureFootnote(string(c.URL(md)))
@@ -638,13 +866,15 @@ func (r *renderer) collectInlineTokens(node ast.Node, md []byte, font *FontAndFa
 				alt = strings.TrimSpace(string(c.Title))
 			}
 			if img, err := r.loadImage(dest); err == nil {
-				*out = append(*out, textToken{image: img, center: true})
+				tok := r.imageToken(img, imageHint(c, "width"), imageHint(c, "height"), size)
+				tok.center = !tok.inline
+				*out = append(*out, tok)
 			} else {
 				fallback := alt
 				fallbackColor := r.c.th.FG
 				if fallback == "" {
 					fallback = dest
-					fallbackColor = warningColor
+					fallbackColor = r.c.th.Warning
 				}
 				if fallback != "" {
 					*out = append(*out, textToken{text: fallback, font: font, size: size, color: fallbackColor})
@@ -660,11 +890,27 @@ func (r *renderer) collectInlineTokens(node ast.Node, md []byte, font *FontAndFa
 				*out = append(*out, textToken{newline: true})
 			}
 		case *ast.Emphasis:
-			nextFont := font
-			if c.Level >= 2 && r.c.fonts.Bold != nil {
-				nextFont = r.c.fonts.Bold
+			r.collectInlineTokens(c, md, r.c.fonts.emphasized(font, c.Level), size, color, out)
+		case *extensionAST.Strikethrough:
+			before := len(*out)
+			r.collectInlineTokens(c, md, font, size, color, out)
+			for i := before; i < len(*out); i++ {
+				(*out)[i].strike = true
+			}
+		case *mathInline:
+			formula := r.typesetMath(c.tex, c.display, size)
+			*out = append(*out, textToken{formula: &formula, size: size, color: color})
+		case *extensionAST.FootnoteLink:
+			idx := r.ensureNoteFootnote(r.noteDefs[c.Index])
+			r.appendFootnoteMarker(out, size, idx)
+		case *ast.RawHTML:
+			raw := rawHTML(c, md)
+			if tag, _, ok := parseHTMLTag(raw); ok && r.inlineHTML(&inline, tag, size, out) {
+				continue
+			}
+			if !strings.HasPrefix(raw, "<!--") {
+				*out = append(*out, textToken{text: raw, font: font, size: size, color: r.c.th.Warning})
 			}
-			r.collectInlineTokens(c, md, nextFont, size, color, out)
 		case *ast.CodeSpan:
 			mono := r.c.fonts.Mono
 			if mono == nil {
@@ -688,6 +934,13 @@ type styledWord struct {
 	size      float64
 	color     color.Color
 	underline bool
+	strike    bool
+	rise      int
+	formula   *mathBox
+	image     image.Image // an inline image, drawn imageSize big
+	imageSize image.Point
+	key       bool
+	center    bool
 }
 
 func splitTextPreserveSpaces(s string) []string {
@@ -722,10 +975,11 @@ func splitTextPreserveSpaces(s string) []string {
 	return parts
 }
 
-func (r *renderer) markerPositions(level int) (markerLeft, markerRight, contentLeft int) {
-	markerLeft = r.c.margin + level*listIndentStep
-	markerRight = markerLeft + listMarkerWidth
-	contentLeft = markerRight + listMarkerGap
+func (r *renderer) markerPositions(left, level int) (markerLeft, markerRight, contentLeft int) {
+	st := r.c.th.Style.List
+	markerLeft = left + level*r.c.em(st.Indent)
+	markerRight = markerLeft + r.c.em(st.MarkerWidth)
+	contentLeft = markerRight + r.c.em(st.MarkerGap)
 	return
 }
 
@@ -734,14 +988,52 @@ func (r *renderer) drawListMarker(marker string, baseline int, markerLeft, marke
 	if font == nil {
 		return
 	}
-	r.c.setFace(font, r.c.th.FG, r.baseSize)
-	width := measureWidth(font, r.baseSize, marker)
+	size := r.baseSize * r.c.th.Style.List.MarkerSize
+	width := measureWidth(font, size, marker)
 	x := markerRight - int(width)
 	if x < markerLeft {
 		x = markerLeft
 	}
-	pt := freetype.Pt(x, baseline)
-	_, _ = r.c.dc.DrawString(marker, pt)
+	r.c.add(r.c.glyphRun(GlyphRun{Text: marker, Font: font, Size: size, Color: r.c.th.FG, Baseline: baseline}, x))
+}
+
+// drawTaskMarker draws a task list checkbox right-aligned in the marker
+// column: an outlined square when open, a filled square with a check mark
+// when done.
+func (r *renderer) drawTaskMarker(checked bool, baseline int, markerLeft, markerRight int) {
+	side := int(r.baseSize * r.c.th.Style.List.MarkerSize * 0.9)
+	bottom := baseline + side/8
+	x0 := max(markerRight-side, markerLeft)
+	rect := image.Rect(x0, bottom-side, x0+side, bottom)
+	radius := float64(side) / 5
+	outline := roundedRectPolygon(rect, radius)
+	if !checked {
+		stroke := max(float64(side)/10, 1)
+		inner := roundedRectPolygon(rect.Inset(int(math.Round(stroke))), radius-stroke)
+		r.c.add(&Box{Kind: PathBox, Rect: rect, Fill: r.c.th.FG, Path: Path{outline, reversePolygon(inner)}})
+		return
+	}
+	r.c.add(&Box{Kind: PathBox, Rect: rect, Fill: r.c.th.Link, Path: Path{outline}})
+	s := float64(side)
+	at := func(fx, fy float64) PathPoint {
+		return PathPoint{float64(rect.Min.X) + fx*s, float64(rect.Min.Y) + fy*s}
+	}
+	width := max(s/7, 1.5)
+	check := Path{
+		strokeSegment(at(0.22, 0.52), at(0.42, 0.72), width),
+		strokeSegment(at(0.40, 0.72), at(0.78, 0.30), width),
+	}
+	r.c.add(&Box{Kind: PathBox, Rect: rect, Fill: r.c.th.BG, Path: check})
+}
+
+// taskCheckBox returns the checkbox that opens a task list item, if any.
+func taskCheckBox(li *ast.ListItem) *extensionAST.TaskCheckBox {
+	if first := li.FirstChild(); first != nil {
+		if cb, ok := first.FirstChild().(*extensionAST.TaskCheckBox); ok {
+			return cb
+		}
+	}
+	return nil
 }
 
 type lineMetric struct {
@@ -757,6 +1049,7 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 	var line []styledWord
 	var lineWidth float64
 	var lineMaxSize float64
+	var lineAscent, lineDescent float64 // of formulas, which may be taller than the text
 	var metrics []lineMetric
 
 	flush := func(force bool) {
@@ -778,35 +1071,83 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 		if baselineSize == 0 {
 			baselineSize = c.ptSize
 		}
-		baseline := c.cursorY + int(baselineSize)
+		baseline := c.cursorY + max(int(baselineSize), int(math.Ceil(lineAscent+baselineSize*0.1)))
+		lineHeight := int(baselineSize * 1.4)
+		if lineHeight <= 0 {
+			lineHeight = int(c.ptSize * 1.4)
+		}
+		lineHeight = max(lineHeight, baseline-c.cursorY+int(math.Ceil(lineDescent+baselineSize*0.2)))
 		x := left
+		if line[0].center {
+			visible := lineWidth
+			for i := len(line) - 1; i >= 0 && line[i].formula == nil && line[i].image == nil && strings.TrimSpace(line[i].text) == ""; i-- {
+				visible -= measureWidth(line[i].font, line[i].size, line[i].text)
+			}
+			x += max(int((maxWidth-visible)/2), 0)
+		}
+		lineBox := &Box{Kind: LineBox, Rect: image.Rect(x, c.cursorY, x, c.cursorY+lineHeight)}
+		var last *Box
+		keyStart, keyAt, keySize := -1, 0, 0.0
+		endKey := func() {
+			if keyStart >= 0 {
+				caps := c.keyCap(keyStart, x, baseline, keySize)
+				lineBox.Children = append(lineBox.Children[:keyAt], append(caps, lineBox.Children[keyAt:]...)...)
+				keyStart = -1
+			}
+		}
 		for _, w := range line {
+			if w.key && keyStart < 0 {
+				keyStart, keyAt, keySize = x, len(lineBox.Children), w.size
+			} else if !w.key {
+				endKey()
+			}
+			if w.formula != nil {
+				width := int(math.Ceil(w.formula.width))
+				rect := image.Rect(x, baseline-int(math.Ceil(w.formula.ascent)), x+width, baseline+int(math.Ceil(w.formula.descent)))
+				lineBox.Children = append(lineBox.Children, &Box{Kind: BlockBox, Role: RoleMath, Rect: rect,
+					Children: c.mathBoxes(*w.formula, x, baseline, w.color)})
+				last = nil
+				x += width
+				continue
+			}
+			if w.image != nil {
+				rect := image.Rectangle{Min: image.Pt(x, baseline-w.imageSize.Y), Max: image.Pt(x+w.imageSize.X, baseline)}
+				lineBox.Children = append(lineBox.Children, &Box{Kind: ImageBox, Rect: rect, Image: drawnImage(w.image, rect.Dx(), rect.Dy())})
+				last = nil
+				x += w.imageSize.X
+				continue
+			}
 			if w.font == nil {
 				w.font = c.fonts.Regular
 			}
-			c.setFace(w.font, w.color, w.size)
-			pt := freetype.Pt(x, baseline)
-			_, _ = c.dc.DrawString(w.text, pt)
 			width := int(measureWidth(w.font, w.size, w.text))
-			if w.underline && width > 0 {
-				underlineY := baseline + int(w.size*0.12)
-				if underlineY <= baseline {
-					underlineY = baseline + 1
-				}
-				rect := image.Rect(x, underlineY, x+width, underlineY+1)
-				draw.Draw(c.img, rect, image.NewUniform(w.color), image.Point{}, draw.Src)
+			if last != nil && last.Run.sameStyle(w) && last.Run.Baseline == baseline-w.rise && last.Rect.Max.X == x {
+				last.Run.Text += w.text
+				last.Rect.Max.X += width
+			} else {
+				last = c.glyphRun(GlyphRun{
+					Text:      w.text,
+					Font:      w.font,
+					Size:      w.size,
+					Color:     w.color,
+					Baseline:  baseline - w.rise,
+					Underline: w.underline,
+					Strike:    w.strike,
+				}, x)
+				last.Rect.Max.X = x + width
+				lineBox.Children = append(lineBox.Children, last)
 			}
 			x += width
 		}
-		lineHeight := int(baselineSize * 1.4)
-		if lineHeight <= 0 {
-			lineHeight = int(c.ptSize * 1.4)
-		}
+		endKey()
+		lineBox.Rect.Max.X = x
+		c.add(lineBox)
 		metrics = append(metrics, lineMetric{baseline: baseline, height: lineHeight})
 		c.cursorY += lineHeight
 		line = line[:0]
 		lineWidth = 0
 		lineMaxSize = 0
+		lineAscent, lineDescent = 0, 0
 	}
 
 	for _, tok := range tokens {
@@ -814,23 +1155,27 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 			flush(true)
 			continue
 		}
+		if tok.image != nil && tok.inline {
+			width, height := c.imageSize(tok, int(maxWidth))
+			if lineWidth+float64(width) > maxWidth && len(line) > 0 {
+				flush(false)
+			}
+			line = append(line, styledWord{image: tok.image, imageSize: image.Pt(width, height), center: tok.center})
+			lineWidth += float64(width)
+			lineAscent = max(lineAscent, float64(height))
+			continue
+		}
 		if tok.image != nil {
 			flush(false)
 			maxWidthInt := int(maxWidth)
-			img := tok.image
-			if b := img.Bounds(); maxWidthInt > 0 && b.Dx() > maxWidthInt {
-				img = scaleImageToWidth(img, maxWidthInt)
-			}
-			bounds := img.Bounds()
+			drawWidth, drawHeight := c.imageSize(tok, maxWidthInt)
 			startY := c.cursorY
-			drawWidth := bounds.Dx()
-			drawHeight := bounds.Dy()
 			x := left
 			if tok.center && maxWidthInt > drawWidth {
 				x += (maxWidthInt - drawWidth) / 2
 			}
 			rect := image.Rect(x, startY, x+drawWidth, startY+drawHeight)
-			draw.Draw(c.img, rect, img, bounds.Min, draw.Over)
+			c.add(&Box{Kind: ImageBox, Rect: rect, Image: drawnImage(tok.image, rect.Dx(), rect.Dy())})
 			baseline := startY + int(c.ptSize)
 			if baseline > rect.Max.Y {
 				baseline = rect.Max.Y
@@ -843,6 +1188,17 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 			c.cursorY += int(c.ptSize * 0.6)
 			continue
 		}
+		if tok.formula != nil {
+			width := math.Ceil(tok.formula.width)
+			if lineWidth+width > maxWidth && len(line) > 0 {
+				flush(false)
+			}
+			line = append(line, styledWord{formula: tok.formula, color: tok.color, center: tok.center})
+			lineWidth += width
+			lineMaxSize = max(lineMaxSize, tok.size)
+			lineAscent, lineDescent = max(lineAscent, tok.formula.ascent), max(lineDescent, tok.formula.descent)
+			continue
+		}
 		font := tok.font
 		if font == nil {
 			font = c.fonts.Regular
@@ -858,14 +1214,14 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 				if len(line) == 0 {
 					continue
 				}
-				line = append(line, styledWord{text: seg, font: font, size: tok.size, color: tok.color, underline: tok.underline})
+				line = append(line, styledWord{text: seg, font: font, size: tok.size, color: tok.color, underline: tok.underline, strike: tok.strike, rise: tok.rise, key: tok.key, center: tok.center})
 				lineWidth += segWidth
 				continue
 			}
 			if lineWidth+segWidth > maxWidth && len(line) > 0 {
 				flush(false)
 			}
-			line = append(line, styledWord{text: seg, font: font, size: tok.size, color: tok.color, underline: tok.underline})
+			line = append(line, styledWord{text: seg, font: font, size: tok.size, color: tok.color, underline: tok.underline, strike: tok.strike, rise: tok.rise, key: tok.key, center: tok.center})
 			if tok.size > lineMaxSize {
 				lineMaxSize = tok.size
 			}
@@ -876,14 +1232,16 @@ func (c *canvas) drawTokens(tokens []textToken, left, right int) []lineMetric {
 	return metrics
 }
 
-func (r *renderer) renderList(list *ast.List, md []byte, level int) {
-	markerLeft, markerRight, contentLeft := r.markerPositions(level)
-	itemSpacing := int(r.baseSize * 0.6)
+// renderList draws a list between left and right, indented level steps.
+func (r *renderer) renderList(list *ast.List, md []byte, left, right, level int) {
+	markerLeft, markerRight, contentLeft := r.markerPositions(left, level)
+	itemSpacing := r.c.em(r.c.th.Style.List.ItemSpacing)
 	start := list.Start
 	if !list.IsOrdered() || start == 0 {
 		start = 1
 	}
 	index := 0
+	block := r.c.beginBlock(RoleList, markerLeft, right)
 	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
 		li, ok := item.(*ast.ListItem)
 		if !ok {
@@ -893,25 +1251,33 @@ func (r *renderer) renderList(list *ast.List, md []byte, level int) {
 		if list.IsOrdered() {
 			marker = fmt.Sprintf("%d%c", start+index, list.Marker)
 		}
-		r.renderListItem(li, md, level, marker, markerLeft, markerRight, contentLeft)
+		r.renderListItem(li, md, left, right, level, marker, markerLeft, markerRight, contentLeft)
 		if item.NextSibling() != nil {
 			r.c.addVSpace(itemSpacing)
 		}
 		index++
 	}
-	r.c.addVSpace(int(r.baseSize * 0.7))
+	r.c.endBlock(block)
+	r.c.addVSpace(r.c.em(r.c.th.Style.List.SpaceAfter))
 }
 
-func (r *renderer) renderListItem(li *ast.ListItem, md []byte, level int, marker string, markerLeft, markerRight, contentLeft int) {
+func (r *renderer) renderListItem(li *ast.ListItem, md []byte, left, right, level int, marker string, markerLeft, markerRight, contentLeft int) {
 	startY := r.c.cursorY
 	markerDrawn := false
-	blockSpacing := int(r.baseSize * 0.5)
+	block := r.c.beginBlock(RoleListItem, markerLeft, right)
+	defer r.c.endBlock(block)
+	blockSpacing := r.c.em(r.c.th.Style.List.BlockSpacing)
 
+	task := taskCheckBox(li)
 	ensureMarker := func(baseline int) {
 		if markerDrawn {
 			return
 		}
-		r.drawListMarker(marker, baseline, markerLeft, markerRight)
+		if task != nil {
+			r.drawTaskMarker(task.IsChecked, baseline, markerLeft, markerRight)
+		} else {
+			r.drawListMarker(marker, baseline, markerLeft, markerRight)
+		}
 		markerDrawn = true
 	}
 
@@ -925,7 +1291,7 @@ func (r *renderer) renderListItem(li *ast.ListItem, md []byte, level int, marker
 			}
 			tokens = []textToken{{text: text, font: r.c.fonts.Regular, size: r.baseSize, color: r.c.th.FG}}
 		}
-		metrics := r.c.drawTokens(tokens, contentLeft, r.c.w-r.c.margin)
+		metrics := r.c.drawTokens(tokens, contentLeft, right)
 		if len(metrics) > 0 {
 			ensureMarker(metrics[0].baseline)
 		} else {
@@ -944,40 +1310,17 @@ func (r *renderer) renderListItem(li *ast.ListItem, md []byte, level int, marker
 			inlineBlock(c)
 		case *ast.List:
 			ensureMarker(startY + int(r.baseSize))
-			r.c.addVSpace(int(r.baseSize * 0.3))
-			r.renderList(c, md, level+1)
-		case *ast.CodeBlock:
-			ensureMarker(startY + int(r.baseSize))
-			text := strings.TrimRight(getNodeText(c, md), "\n")
-			r.c.addVSpace(int(r.baseSize * 0.2))
-			r.c.drawCodeBlock(text, contentLeft, r.c.w-r.c.margin, r.baseSize*0.95)
-			if child.NextSibling() != nil {
-				r.c.addVSpace(blockSpacing)
-			}
-		case *ast.FencedCodeBlock:
-			ensureMarker(startY + int(r.baseSize))
-			text := strings.TrimRight(getNodeText(c, md), "\n")
-			r.c.addVSpace(int(r.baseSize * 0.2))
-			r.c.drawCodeBlock(text, contentLeft, r.c.w-r.c.margin, r.baseSize*0.95)
-			if child.NextSibling() != nil {
-				r.c.addVSpace(blockSpacing)
+			r.c.addVSpace(r.c.em(r.c.th.Style.List.NestedGap))
+			r.renderList(c, md, left, right, level+1)
+		default:
+			// Any other block draws as it would outside the list, with the
+			// marker on its first line.
+			first := len(block.Children)
+			r.renderBlock(c, md, contentLeft, right)
+			if baseline, ok := firstBaseline(block.Children[first:]); ok {
+				ensureMarker(baseline)
 			}
-		case *ast.Blockquote:
 			ensureMarker(startY + int(r.baseSize))
-			quoteStart := r.c.cursorY
-			var tokens []textToken
-			r.collectInlineTokens(c, md, r.c.fonts.Regular, r.baseSize, r.c.th.FG, &tokens)
-			if len(tokens) > 0 {
-				r.c.addVSpace(2)
-				_ = r.c.drawTokens(tokens, contentLeft+10, r.c.w-r.c.margin)
-				r.c.addVSpace(6)
-				r.c.drawBlockquoteBar(quoteStart+2, r.c.cursorY-quoteStart-2)
-			}
-			if child.NextSibling() != nil {
-				r.c.addVSpace(blockSpacing)
-			}
-		default:
-			// Ignore unsupported inline nodes; block handlers cover known types.
 		}
 	}
 
@@ -986,251 +1329,229 @@ func (r *renderer) renderListItem(li *ast.ListItem, md []byte, level int, marker
 	}
 }
 
-func (r *renderer) collectTableRow(row *extensionAST.TableRow, md []byte, isHeader bool) [][]textToken {
-	var cells [][]textToken
-	for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
-		if tc, ok := cell.(*extensionAST.TableCell); ok {
-			var tokens []textToken
-			font := r.c.fonts.Regular
-			if isHeader && r.c.fonts.Bold != nil {
-				font = r.c.fonts.Bold
-			}
-			r.collectInlineTokens(tc, md, font, r.baseSize, r.c.th.FG, &tokens)
-			cells = append(cells, tokens)
-		}
-	}
-	return cells
-}
-
-func (r *renderer) renderTable(tbl *extensionAST.Table, md []byte) {
-	var rows [][][]textToken
-	for node := tbl.FirstChild(); node != nil; node = node.NextSibling() {
-		switch n := node.(type) {
-		case *extensionAST.TableHeader:
-			// The children of TableHeader are TableCell, not TableRow!
-			// We need to collect the cells directly.
-			// Actually, wait, goldmark v1.7.4 might be different from whatever was assumed.
-			// Let's create a pseudo-row just to pass to a logic, or adjust.
-			// The original code was:
-			/*
-			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-				if tr, ok := child.(*extensionAST.TableRow); ok {
-					rows = append(rows, r.collectTableRow(tr, md, true))
-				}
-			}
-			*/
-			// Since we know TableHeader directly contains TableCells, let's collect them!
-			var cells [][]textToken
-			for cell := n.FirstChild(); cell != nil; cell = cell.NextSibling() {
-				if tc, ok := cell.(*extensionAST.TableCell); ok {
-					var tokens []textToken
-					font := r.c.fonts.Regular
-					if r.c.fonts.Bold != nil {
-						font = r.c.fonts.Bold
-					}
-					r.collectInlineTokens(tc, md, font, r.baseSize, r.c.th.FG, &tokens)
-					cells = append(cells, tokens)
-				}
-			}
-			rows = append(rows, cells)
-		case *extensionAST.TableRow:
-			rows = append(rows, r.collectTableRow(n, md, false))
+// firstBaseline returns the baseline of the first text in boxes.
+func firstBaseline(boxes []*Box) (int, bool) {
+	for _, b := range boxes {
+		if b.Kind == GlyphRunBox {
+			return b.Run.Baseline, true
 		}
-	}
-	if len(rows) == 0 {
-		return
-	}
-	colCount := 0
-	for _, row := range rows {
-		if len(row) > colCount {
-			colCount = len(row)
+		if baseline, ok := firstBaseline(b.Children); ok {
+			return baseline, true
 		}
 	}
-	if colCount == 0 {
-		return
-	}
+	return 0, false
+}
 
-	border := 1
-	cellPadding := int(r.baseSize * 0.6)
-	if cellPadding < 8 {
-		cellPadding = 8
-	}
-	availableWidth := r.c.w - 2*r.c.margin
-	minWidth := colCount*40 + border*(colCount+1)
-	if availableWidth < minWidth {
-		availableWidth = minWidth
-	}
-	colWidth := (availableWidth - border*(colCount+1)) / colCount
-	if colWidth < 60 {
-		colWidth = 60
-	}
-	tableWidth := colCount*colWidth + border*(colCount+1)
-	if tableWidth > availableWidth {
-		tableWidth = availableWidth
-	}
-	tableLeft := r.c.margin
-	tableRight := tableLeft + tableWidth
-
-	borderColor := image.NewUniform(r.c.th.HRule)
-	r.c.addVSpace(int(r.baseSize * 0.3))
-	tableTop := r.c.cursorY
-	draw.Draw(r.c.img, image.Rect(tableLeft, tableTop, tableRight, tableTop+border), borderColor, image.Point{}, draw.Src)
-	y := tableTop + border
-
-	for _, row := range rows {
-		rowTop := y
-		maxCellHeight := 0
-		for col := 0; col < colCount; col++ {
-			cellLeft := tableLeft + border + col*(colWidth+border)
-			cellRight := cellLeft + colWidth
-			contentLeft := cellLeft + cellPadding
-			contentRight := cellRight - cellPadding
-			if contentRight <= contentLeft {
-				contentRight = cellRight - 2
+// renderDefinitionList draws each term in bold, followed by its descriptions
+// indented one list level deeper than level. Descriptions hold any block.
+func (r *renderer) renderDefinitionList(dl *extensionAST.DefinitionList, md []byte, left, right, level int) {
+	st := r.c.th.Style.List
+	termLeft := left + level*r.c.em(st.Indent)
+	descLeft := termLeft + r.c.em(st.Indent)
+	blockSpacing := r.c.em(st.BlockSpacing)
+	block := r.c.beginBlock(RoleDefinitionList, termLeft, right)
+	for child := dl.FirstChild(); child != nil; child = child.NextSibling() {
+		switch c := child.(type) {
+		case *extensionAST.DefinitionTerm:
+			if _, ok := child.PreviousSibling().(*extensionAST.DefinitionDescription); ok {
+				r.c.addVSpace(r.c.em(st.ItemSpacing))
 			}
-			start := rowTop + cellPadding
-			r.c.cursorY = start
 			var tokens []textToken
-			if col < len(row) {
-				tokens = row[col]
-			}
-			metrics := r.c.drawTokens(tokens, contentLeft, contentRight)
-			height := r.c.cursorY - start
-			if len(metrics) == 0 && len(tokens) == 0 {
-				height = int(r.baseSize * 1.1)
-			}
-			if height > maxCellHeight {
-				maxCellHeight = height
+			r.collectInlineTokens(c, md, r.c.fonts.byRole(FontBold), r.baseSize, r.c.th.FG, &tokens)
+			term := r.c.beginBlock(RoleDefinitionTerm, termLeft, right)
+			_ = r.c.drawTokens(tokens, termLeft, right)
+			r.c.endBlock(term)
+		case *extensionAST.DefinitionDescription:
+			r.c.addVSpace(r.c.em(r.c.th.Style.Definition.Gap))
+			desc := r.c.beginBlock(RoleDefinitionDescription, descLeft, right)
+			for n := c.FirstChild(); n != nil; n = n.NextSibling() {
+				switch nd := n.(type) {
+				case *ast.Paragraph, *ast.TextBlock:
+					var tokens []textToken
+					r.collectInlineTokens(nd, md, r.c.fonts.Regular, r.baseSize, r.c.th.FG, &tokens)
+					_ = r.c.drawTokens(tokens, descLeft, right)
+				case *ast.List:
+					r.renderList(nd, md, left, right, level+1)
+				case *extensionAST.DefinitionList:
+					r.renderDefinitionList(nd, md, left, right, level+1)
+				default:
+					r.renderBlock(nd, md, descLeft, right)
+				}
+				if n.NextSibling() != nil {
+					r.c.addVSpace(blockSpacing)
+				}
 			}
-			r.c.cursorY = start
+			r.c.endBlock(desc)
 		}
-		if maxCellHeight < int(r.baseSize*1.1) {
-			maxCellHeight = int(r.baseSize * 1.1)
-		}
-		rowBottom := rowTop + maxCellHeight + 2*cellPadding
-		draw.Draw(r.c.img, image.Rect(tableLeft, rowBottom, tableRight, rowBottom+border), borderColor, image.Point{}, draw.Src)
-		y = rowBottom + border
-	}
-
-	tableBottom := y - border
-	for col := 0; col <= colCount; col++ {
-		x := tableLeft + col*(colWidth+border)
-		draw.Draw(r.c.img, image.Rect(x, tableTop, x+border, tableBottom+border), borderColor, image.Point{}, draw.Src)
 	}
-	r.c.cursorY = tableBottom + int(r.baseSize*0.7)
+	r.c.endBlock(block)
+	r.c.addVSpace(r.c.em(st.SpaceAfter))
 }
 
-func (r *renderer) renderUnsupported(node ast.Node) {
+func (r *renderer) renderUnsupported(node ast.Node, left, right int) {
 	if node.Type() != ast.TypeBlock {
 		return
 	}
-	msg := fmt.Sprintf("⚠ Unsupported: %s", node.Kind().String())
-	tokens := []textToken{{text: msg, font: r.c.fonts.Regular, size: r.baseSize * 0.9, color: warningColor}}
-	_ = r.c.drawTokens(tokens, r.c.margin, r.c.w-r.c.margin)
-	r.c.addVSpace(int(r.baseSize * 0.6))
+	r.warnUnsupported(node.Kind().String(), left, right)
+}
+
+// warnUnsupported draws a warning line naming what could not be rendered.
+func (r *renderer) warnUnsupported(what string, left, right int) {
+	msg := fmt.Sprintf("⚠ Unsupported: %s", what)
+	tokens := []textToken{{text: msg, font: r.c.fonts.Regular, size: r.baseSize * 0.9, color: r.c.th.Warning}}
+	block := r.c.beginBlock(RoleUnsupported, left, right)
+	_ = r.c.drawTokens(tokens, left, right)
+	r.c.endBlock(block)
+	r.c.addVSpace(r.c.em(r.c.th.Style.Warning.SpaceAfter))
 }
 
-func (r *renderer) drawFootnotes() {
+// drawFootnotes draws the footnote list. Each entry hangs from its number:
+// link footnotes show their destination, and Markdown footnotes lay out
+// their definition's blocks, paragraphs, lists and code alike, at the note
+// size.
+func (r *renderer) drawFootnotes(md []byte) {
 	if len(r.footnotes) == 0 {
 		return
 	}
-	r.c.addVSpace(int(r.baseSize * 0.4))
+	r.c.addVSpace(r.c.em(r.c.th.Style.Footnotes.SpaceBefore))
 	noteSize := r.baseSize * 0.85
 	if noteSize <= 0 {
 		noteSize = r.baseSize
 	}
-	for i, note := range r.footnotes {
-		label := fmt.Sprintf("[%d] %s", i+1, note)
-		tokens := []textToken{{text: label, font: r.c.fonts.Regular, size: noteSize, color: r.c.th.FG}}
-		_ = r.c.drawTokens(tokens, r.c.margin, r.c.w-r.c.margin)
+	base := r.baseSize
+	r.baseSize = noteSize
+	defer func() { r.baseSize = base }()
+
+	left, right := r.c.margin, r.c.pageW-r.c.margin
+	block := r.c.beginBlock(RoleFootnotes, left, right)
+	indent := 0
+	// Footnote text may reference further footnotes, which are appended as
+	// the list is drawn.
+	for i := 0; i < len(r.footnotes); i++ {
+		note := r.footnotes[i]
+		label := fmt.Sprintf("[%d]", i+1)
+		indent = max(indent, int(math.Ceil(measureWidth(r.c.fonts.Regular, noteSize, label+" "))))
+		startY := r.c.cursorY
+		entry := r.c.beginBlock(RoleFootnote, left, right)
+		if note.note != nil {
+			r.renderBlocks(note.note, md, left+indent, right)
+			// Drop the spacing after the last block; entries sit close.
+			r.c.cursorY = contentBottom(entry, startY)
+		} else {
+			tokens := []textToken{{text: note.text, font: r.c.fonts.Regular, size: noteSize, color: r.c.th.FG}}
+			_ = r.c.drawTokens(tokens, left+indent, right)
+		}
+		baseline, ok := firstBaseline(entry.Children)
+		if !ok {
+			baseline = startY + int(noteSize)
+		}
+		r.c.add(r.c.glyphRun(GlyphRun{Text: label, Font: r.c.fonts.Regular, Size: noteSize, Color: r.c.th.FG, Baseline: baseline}, left))
+		r.c.endBlock(entry)
 	}
+	r.c.endBlock(block)
 }
 
-func (r *renderer) render(md []byte) error {
+// parseMarkdown parses md with the extensions the renderer understands.
+func parseMarkdown(md []byte) ast.Node {
 	mdParser := goldmark.New(
-		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithExtensions(extension.GFM, extension.Footnote, extension.DefinitionList, mathExtension{}, alertExtension{}, imageSizeExtension{}),
 		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
 	)
-	doc := mdParser.Parser().Parse(text.NewReader(md))
-	if err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		if !entering {
-			return ast.WalkContinue, nil
-		}
-		switch nd := n.(type) {
-		case *ast.Heading:
-			lvl := nd.Level
-			var size float64
-			switch lvl { // simple scale
-			case 1:
-				size = r.baseSize * 1.9
-			case 2:
-				size = r.baseSize * 1.6
-			case 3:
-				size = r.baseSize * 1.4
-			case 4:
-				size = r.baseSize * 1.25
-			default:
-				size = r.baseSize * 1.15
-			}
-			var tokens []textToken
-			r.collectInlineTokens(n, md, r.c.fonts.Regular, size, r.c.th.FG, &tokens)
-			r.c.addVSpace(int(r.baseSize * 0.75))
-			_ = r.c.drawTokens(tokens, r.c.margin, r.c.w-r.c.margin)
-			r.c.addVSpace(int(r.baseSize * 0.5))
-			return ast.WalkSkipChildren, nil
-		case *ast.Paragraph:
-			var tokens []textToken
-			r.collectInlineTokens(n, md, r.c.fonts.Regular, r.baseSize, r.c.th.FG, &tokens)
-			if len(tokens) > 0 {
-				_ = r.c.drawTokens(tokens, r.c.margin, r.c.w-r.c.margin)
-				r.c.addVSpace(int(r.baseSize * 0.9))
-			}
-			return ast.WalkSkipChildren, nil
-		case *ast.List:
-			r.renderList(nd, md, 0)
-			return ast.WalkSkipChildren, nil
-		case *extensionAST.Table:
-			r.renderTable(nd, md)
-			return ast.WalkSkipChildren, nil
-		case *ast.CodeBlock, *ast.FencedCodeBlock:
-			text := strings.TrimRight(getNodeText(n, md), "\n")
-			r.c.addVSpace(4)
-			r.c.drawCodeBlock(text, r.c.margin, r.c.w-r.c.margin, r.baseSize*0.95)
-			return ast.WalkSkipChildren, nil
-		case *ast.Blockquote:
-			startY := r.c.cursorY
-			var tokens []textToken
-			r.collectInlineTokens(n, md, r.c.fonts.Regular, r.baseSize*1.0, r.c.th.FG, &tokens)
-			if len(tokens) > 0 {
-				r.c.addVSpace(2)
-				_ = r.c.drawTokens(tokens, r.c.margin+10, r.c.w-r.c.margin)
-				r.c.addVSpace(6)
-				r.c.drawBlockquoteBar(startY+2, r.c.cursorY-startY-2)
-			}
-			return ast.WalkSkipChildren, nil
-		case *ast.ThematicBreak:
-			r.c.drawHRule()
-			return ast.WalkSkipChildren, nil
-		case *ast.Text:
-			// Handled by parents (Paragraph/List/Heading)
-			return ast.WalkContinue, nil
-		default:
-			switch nd.(type) {
-			case *ast.Document, *ast.ListItem:
-				return ast.WalkContinue, nil
-			case *extensionAST.TableHeader, *extensionAST.TableRow, *extensionAST.TableCell:
-				return ast.WalkContinue, nil
-			}
-			r.renderUnsupported(nd)
-			return ast.WalkSkipChildren, nil
-		}
-	}); err != nil {
-		return err
+	return mdParser.Parser().Parse(text.NewReader(md))
+}
+
+func (r *renderer) render(md []byte) error {
+	return r.renderDocument(parseMarkdown(md), md)
+}
+
+// renderDocument lays out an already parsed document whose segments refer to md.
+func (r *renderer) renderDocument(doc ast.Node, md []byte) error {
+	if r.noteDefs == nil {
+		r.noteDefs = make(map[int]*extensionAST.Footnote)
 	}
-	r.drawFootnotes()
+	for idx, note := range footnoteDefinitions(doc) {
+		r.noteDefs[idx] = note
+	}
+	r.renderBlocks(doc, md, r.c.margin, r.c.w-r.c.margin)
+	r.drawFootnotes(md)
 	return nil
 }
 
+// renderBlocks draws the block children of parent between left and right.
+func (r *renderer) renderBlocks(parent ast.Node, md []byte, left, right int) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		r.renderBlock(n, md, left, right)
+	}
+}
+
+// renderBlock draws one block between left and right.
+func (r *renderer) renderBlock(n ast.Node, md []byte, left, right int) {
+	switch nd := n.(type) {
+	case *ast.Heading:
+		st := r.c.th.Style.Headings[min(max(nd.Level, 1), 6)-1]
+		size := r.baseSize * st.Scale
+		var tokens []textToken
+		r.collectInlineTokens(n, md, r.c.fonts.byRole(st.Font), size, r.c.th.FG, &tokens)
+		r.alignTokens(tokens)
+		r.c.addVSpace(r.c.em(st.SpaceBefore))
+		block := r.c.beginBlock(RoleHeading, left, right)
+		_ = r.c.drawTokens(tokens, left, right)
+		r.c.endBlock(block)
+		r.c.addVSpace(r.c.em(st.SpaceAfter))
+	case *ast.Paragraph, *ast.TextBlock:
+		var tokens []textToken
+		r.collectInlineTokens(n, md, r.c.fonts.Regular, r.baseSize, r.c.th.FG, &tokens)
+		r.alignTokens(tokens)
+		if len(tokens) > 0 {
+			block := r.c.beginBlock(RoleParagraph, left, right)
+			_ = r.c.drawTokens(tokens, left, right)
+			r.c.endBlock(block)
+			r.c.addVSpace(r.c.em(r.c.th.Style.Paragraph.SpaceAfter))
+		}
+	case *ast.List:
+		r.renderList(nd, md, left, right, 0)
+	case *extensionAST.Table:
+		r.renderTable(nd, md, left, right)
+	case *extensionAST.DefinitionList:
+		r.renderDefinitionList(nd, md, left, right, 0)
+	case *mathBlock:
+		r.drawMathBlock(nd.tex, left, right)
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		text := strings.TrimRight(getNodeText(n, md), "\n")
+		var lang string
+		if fenced, ok := nd.(*ast.FencedCodeBlock); ok {
+			lang = string(fenced.Language(md))
+		}
+		r.c.addVSpace(r.c.em(r.c.th.Style.Code.SpaceBefore))
+		r.c.drawCodeBlock(text, lang, left, right, r.baseSize*r.c.th.Style.Code.Size)
+	case *ast.Blockquote:
+		r.renderBlockquote(nd, md, left, right)
+	case *ast.ThematicBreak:
+		r.c.drawHRule(left, right)
+	case *ast.HTMLBlock:
+		r.renderHTMLBlock(nd, md, left, right)
+	case *alertBlock:
+		r.renderAlert(nd, md, left, right)
+	default:
+		r.renderUnsupported(nd, left, right)
+	}
+}
+
+// renderBlockquote draws a quote's blocks indented past a bar at left.
+// Quotes inside it indent further and draw their own bar, so each level of
+// nesting adds one.
+func (r *renderer) renderBlockquote(q *ast.Blockquote, md []byte, left, right int) {
+	st := r.c.th.Style.Blockquote
+	block := r.c.beginBlock(RoleBlockquote, left, right)
+	r.c.addVSpace(r.c.em(st.PaddingTop))
+	top := r.c.cursorY
+	r.renderBlocks(q, md, left+r.c.em(st.Indent), right)
+	r.c.cursorY = contentBottom(block, top) + r.c.em(st.PaddingBottom)
+	r.c.drawBlockquoteBar(left, top, r.c.cursorY-top)
+	r.c.endBlock(block)
+	r.c.addVSpace(r.c.em(r.c.th.Style.Paragraph.SpaceAfter))
+}
+
 // ---- Library entry points ----
 
 // LightTheme and DarkTheme expose the built-in themes for convenience.
@@ -1239,7 +1560,8 @@ var (
 	DarkTheme  = darkTheme
 )
 
-// ThemeByName returns a built-in theme by name ("light" or "dark").
+// ThemeByName returns a built-in theme by name ("light" or "dark"). Use
+// LoadTheme for themes stored in files.
 func ThemeByName(name string) (Theme, error) {
 	switch strings.ToLower(name) {
 	case "light", "":
@@ -1267,12 +1589,17 @@ type RenderOptions struct {
 	LinkFootnotes  *bool
 	ImageFootnotes *bool
 	BaseDir        string
+	PageHeight     int // page height in pixels for RenderPages; 0 disables paging
+	TableOverflow  TableOverflow
+	MaxImageHeight int  // pixels; images are scaled down to fit, 0 for no limit
+	UpscaleImages  bool // scale block images narrower than the text up to its width
+	// Diagnostics, when set, is called for each problem met while laying
+	// out, as it is found.
+	Diagnostics func(Diagnostic)
 }
 
-// Render converts the provided Markdown document into a raster image using the
-// supplied options. Zero values enable sensible defaults (1024px width,
-// 48px margin, 16pt base font, light theme, bundled fonts).
-func Render(data []byte, opts RenderOptions) (*image.RGBA, error) {
+// withDefaults fills in zero-valued options and loads any missing fonts.
+func (opts RenderOptions) withDefaults() (RenderOptions, error) {
 	if opts.Width <= 0 {
 		opts.Width = 1024
 	}
@@ -1285,12 +1612,19 @@ func Render(data []byte, opts RenderOptions) (*image.RGBA, error) {
 	if (opts.Theme == Theme{}) {
 		opts.Theme = lightTheme
 	}
+	if opts.Theme.Link == nil {
+		opts.Theme.Link = linkColor
+	}
+	if opts.Theme.Warning == nil {
+		opts.Theme.Warning = warningColor
+	}
 
 	// Fill in missing fonts using the bundled defaults.
-	if opts.Fonts.Regular == nil || opts.Fonts.Bold == nil || opts.Fonts.Mono == nil {
+	if opts.Fonts.Regular == nil || opts.Fonts.Bold == nil || opts.Fonts.Italic == nil ||
+		opts.Fonts.BoldItalic == nil || opts.Fonts.Mono == nil {
 		fallback, err := LoadFonts(FontConfig{SizeBase: opts.BaseFontSize})
 		if err != nil {
-			return nil, err
+			return opts, err
 		}
 		if opts.Fonts.Regular == nil {
 			opts.Fonts.Regular = fallback.Regular
@@ -1298,22 +1632,19 @@ func Render(data []byte, opts RenderOptions) (*image.RGBA, error) {
 		if opts.Fonts.Bold == nil {
 			opts.Fonts.Bold = fallback.Bold
 		}
+		if opts.Fonts.Italic == nil {
+			opts.Fonts.Italic = fallback.Italic
+		}
+		if opts.Fonts.BoldItalic == nil {
+			opts.Fonts.BoldItalic = fallback.BoldItalic
+		}
 		if opts.Fonts.Mono == nil {
 			opts.Fonts.Mono = fallback.Mono
 		}
 	}
 
 	if opts.Fonts.Regular == nil || opts.Fonts.Bold == nil || opts.Fonts.Mono == nil {
-		return nil, errors.New("md2png: incomplete font configuration")
-	}
-
-	linkFootnotes := true
-	if opts.LinkFootnotes != nil {
-		linkFootnotes = *opts.LinkFootnotes
-	}
-	imageFootnotes := false
-	if opts.ImageFootnotes != nil {
-		imageFootnotes = *opts.ImageFootnotes
+		return opts, errors.New("md2png: incomplete font configuration")
 	}
 
 	baseDir := strings.TrimSpace(opts.BaseDir)
@@ -1326,26 +1657,96 @@ func Render(data []byte, opts RenderOptions) (*image.RGBA, error) {
 			baseDir = abs
 		}
 	}
+	opts.BaseDir = baseDir
+	return opts, nil
+}
+
+// LayoutDocument parses the Markdown document and lays it out as a tree of
+// positioned boxes without painting anything. The result can be inspected,
+// hit-tested, or handed to a painting backend such as PaintRaster.
+func LayoutDocument(data []byte, opts RenderOptions) (*Layout, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRenderer(opts)
+	if err := r.render(data); err != nil {
+		return nil, err
+	}
+	l := r.c.layout()
+	l.Diagnostics = r.diagnostics
+	return l, nil
+}
+
+// diagnose records a problem with node n of the source md.
+func (r *renderer) diagnose(n ast.Node, md []byte, format string, args ...any) {
+	d := Diagnostic{Line: sourceLine(n, md), Message: fmt.Sprintf(format, args...)}
+	r.diagnostics = append(r.diagnostics, d)
+	if r.onDiagnostic != nil {
+		r.onDiagnostic(d)
+	}
+}
+
+// sourceLine returns the 1-based line of md that n starts on, or 0 if n has
+// no source position.
+func sourceLine(n ast.Node, md []byte) int {
+	start := -1
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch {
+		case !entering:
+		case n.Type() == ast.TypeBlock && n.Lines().Len() > 0:
+			start = n.Lines().At(0).Start
+		default:
+			if t, ok := n.(*ast.Text); ok {
+				start = t.Segment.Start
+			}
+		}
+		if start >= 0 {
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if start < 0 || start > len(md) {
+		return 0
+	}
+	return bytes.Count(md[:start], []byte("\n")) + 1
+}
+
+// newRenderer prepares a renderer with a fresh canvas for options that have
+// already had their defaults applied.
+func newRenderer(opts RenderOptions) *renderer {
+	linkFootnotes := true
+	if opts.LinkFootnotes != nil {
+		linkFootnotes = *opts.LinkFootnotes
+	}
+	imageFootnotes := false
+	if opts.ImageFootnotes != nil {
+		imageFootnotes = *opts.ImageFootnotes
+	}
 
 	c := newCanvas(opts.Width, opts.Margin, opts.Theme, opts.Fonts, opts.BaseFontSize)
+	c.maxImageHeight, c.upscaleImages = opts.MaxImageHeight, opts.UpscaleImages
 	r := &renderer{
 		c:              c,
 		baseSize:       opts.BaseFontSize,
 		linkFootnotes:  linkFootnotes,
 		imageFootnotes: imageFootnotes,
-		baseDir:        baseDir,
+		baseDir:        opts.BaseDir,
+		tableOverflow:  opts.TableOverflow,
+		onDiagnostic:   opts.Diagnostics,
 	}
 	r.ensureImageResolvers()
-	if err := r.render(data); err != nil {
-		return nil, err
-	}
+	return r
+}
 
-	used := c.cursorY + opts.Margin
-	if used < opts.Margin+50 {
-		used = opts.Margin + 50
+// Render converts the provided Markdown document into a raster image using the
+// supplied options. Zero values enable sensible defaults (1024px width,
+// 48px margin, 16pt base font, light theme, bundled fonts).
+func Render(data []byte, opts RenderOptions) (*image.RGBA, error) {
+	l, err := LayoutDocument(data, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	img := image.NewRGBA(image.Rect(0, 0, opts.Width, used))
-	draw.Draw(img, img.Bounds(), c.img, image.Point{}, draw.Src)
-	return img, nil
+	return PaintRaster(l), nil
 }
@@ -253,3 +253,330 @@ func TestRenderEmbedsRemoteImage(t *testing.T) {
 		t.Fatalf("expected rendered output to include remote image pixels")
 	}
 }
+
+func TestRenderLongDocumentIsNotClipped(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&b, "Paragraph %d keeps the document growing well past the old canvas limit.\n\n", i)
+	}
+	b.WriteString("---\n")
+	rendered, err := Render([]byte(b.String()), RenderOptions{Width: 400, Margin: 24})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	bounds := rendered.Bounds()
+	if bounds.Dy() <= 8192 {
+		t.Fatalf("expected long document to exceed 8192px, got %d", bounds.Dy())
+	}
+	// The trailing rule must be drawn near the bottom of the output.
+	found := false
+	for y := bounds.Max.Y - 24 - 20; y < bounds.Max.Y && !found; y++ {
+		r, g, b, _ := rendered.At(200, y).RGBA()
+		if uint8(r>>8) == 0xDD && uint8(g>>8) == 0xDD && uint8(b>>8) == 0xDD {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected trailing horizontal rule near the bottom of a long document")
+	}
+}
+
+func TestEmphasisComposesFaces(t *testing.T) {
+	markdown := "plain *italic **bolditalic*** **bold *bolditalic2***\n"
+	opts, err := RenderOptions{}.withDefaults()
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	l, err := LayoutDocument([]byte(markdown), opts)
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	want := map[string]*FontAndFace{
+		"plain":       opts.Fonts.Regular,
+		"italic":      opts.Fonts.Italic,
+		"bolditalic":  opts.Fonts.BoldItalic,
+		"bold":        opts.Fonts.Bold,
+		"bolditalic2": opts.Fonts.BoldItalic,
+	}
+	l.Walk(func(b *Box) bool {
+		if b.Kind != GlyphRunBox {
+			return true
+		}
+		for _, word := range strings.Fields(b.Run.Text) {
+			if face, ok := want[word]; ok {
+				if b.Run.Font != face {
+					t.Fatalf("unexpected face for %q", word)
+				}
+				delete(want, word)
+			}
+		}
+		return true
+	})
+	if len(want) != 0 {
+		t.Fatalf("words not found in layout: %v", want)
+	}
+}
+
+func TestRenderStrikethroughAndTaskLists(t *testing.T) {
+	markdown := "- [x] done\n- [ ] ~~gone~~ todo\n- plain\n\nSee www.example.com\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var paths, bullets int
+	var struck, linked bool
+	l.Walk(func(b *Box) bool {
+		switch b.Kind {
+		case PathBox:
+			paths++
+		case GlyphRunBox:
+			switch {
+			case b.Run.Text == "•":
+				bullets++
+			case strings.Contains(b.Run.Text, "gone"):
+				struck = b.Run.Strike
+			case strings.Contains(b.Run.Text, "todo") && b.Run.Strike:
+				t.Fatalf("expected strikethrough to end after the struck text")
+			case b.Run.Text == "www.example.com":
+				linked = b.Run.Underline && b.Run.Color == LightTheme.Link
+			}
+		}
+		return true
+	})
+	if !struck {
+		t.Fatalf("expected struck text to carry a strikethrough")
+	}
+	// A checked box adds a check mark path on top of the box itself.
+	if paths != 3 {
+		t.Fatalf("expected 3 checkbox paths, got %d", paths)
+	}
+	if bullets != 1 {
+		t.Fatalf("expected only the plain item to keep its bullet, got %d", bullets)
+	}
+	if !linked {
+		t.Fatalf("expected a bare URL to be linkified")
+	}
+}
+
+func TestRenderMarkdownFootnotes(t *testing.T) {
+	markdown := "Note[^a] then [link](https://go.dev) and again[^a].\n\n" +
+		"[^a]: First *note*, see[^b].\n[^b]: Nested.\n[^c]: Unused.\n"
+	opts, err := RenderOptions{Width: 640}.withDefaults()
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	r := newRenderer(opts)
+	if err := r.render([]byte(markdown)); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if len(r.footnotes) != 3 {
+		t.Fatalf("expected note, link and nested note footnotes, got %d", len(r.footnotes))
+	}
+	if r.footnotes[0].note == nil || r.footnotes[1].text != "https://go.dev" || r.footnotes[2].note == nil {
+		t.Fatalf("expected footnotes numbered in reference order, got %+v", r.footnotes)
+	}
+
+	l := r.c.layout()
+	var lines []string
+	var markers int
+	var walk func(b *Box, role string, line *strings.Builder)
+	walk = func(b *Box, role string, line *strings.Builder) {
+		if b.Kind == BlockBox {
+			role = b.Role
+		}
+		if b.Kind == GlyphRunBox {
+			if line != nil {
+				line.WriteString(b.Run.Text)
+			}
+			if line == nil && role == RoleParagraph && strings.HasPrefix(b.Run.Text, "[") {
+				markers++
+				if b.Run.Baseline >= b.Rect.Min.Y+int(b.Run.Size/0.75) {
+					t.Fatalf("expected footnote marker %q to be raised", b.Run.Text)
+				}
+			}
+		}
+		for _, c := range b.Children {
+			walk(c, role, line)
+		}
+	}
+	l.Walk(func(b *Box) bool {
+		if b.Role != RoleFootnote {
+			if b.Role == RoleParagraph {
+				walk(b, "", nil)
+				return false
+			}
+			return true
+		}
+		// The number is added last, after the definition it hangs from.
+		number := b.Children[len(b.Children)-1]
+		var line strings.Builder
+		line.WriteString(number.Run.Text + " ")
+		for _, c := range b.Children[:len(b.Children)-1] {
+			walk(c, RoleFootnote, &line)
+		}
+		lines = append(lines, line.String())
+		return false
+	})
+	if markers != 3 {
+		t.Fatalf("expected three superscript markers, got %d", markers)
+	}
+	want := []string{"[1] First note, see[3].", "[2] https://go.dev", "[3] Nested."}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected footnote list:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestRenderBlockFootnotes(t *testing.T) {
+	markdown := "Text[^a].\n\n[^a]: First paragraph.\n\n    Second paragraph.\n\n    ```\n    code\n    ```\n\n    - item\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var entry *Box
+	l.Walk(func(b *Box) bool {
+		if b.Role == RoleFootnote {
+			entry = b
+		}
+		return true
+	})
+	if entry == nil {
+		t.Fatalf("expected a footnote entry")
+	}
+	roles := map[string]int{}
+	for _, c := range entry.Children {
+		if c.Kind == BlockBox {
+			roles[c.Role]++
+			if c.Rect.Min.X <= l.Margin {
+				t.Fatalf("expected the %s indented past the number, got x=%d", c.Role, c.Rect.Min.X)
+			}
+		}
+	}
+	if roles[RoleParagraph] != 2 || roles[RoleCode] != 1 || roles[RoleList] != 1 {
+		t.Fatalf("expected two paragraphs, a code block and a list in the footnote, got %v", roles)
+	}
+	number := entry.Children[len(entry.Children)-1]
+	if number.Run == nil || number.Run.Text != "[1]" || number.Rect.Min.X != l.Margin {
+		t.Fatalf("expected the number hanging at the margin")
+	}
+}
+
+func TestRenderDefinitionLists(t *testing.T) {
+	markdown := "Term\n: Description text.\n\n  - nested item\n\nAfter.\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := map[string]*Box{}
+	roles := map[string]bool{}
+	l.Walk(func(b *Box) bool {
+		switch b.Kind {
+		case BlockBox:
+			roles[b.Role] = true
+		case GlyphRunBox:
+			runs[b.Run.Text] = b
+		}
+		return true
+	})
+	if roles[RoleUnsupported] {
+		t.Fatalf("expected definition lists to be supported")
+	}
+	if !roles[RoleDefinitionTerm] || !roles[RoleDefinitionDescription] || !roles[RoleList] {
+		t.Fatalf("expected term, description and nested list blocks, got %v", roles)
+	}
+	term, desc, item := runs["Term"], runs["Description text."], runs["nested item"]
+	if term == nil || desc == nil || item == nil {
+		t.Fatalf("expected term, description and item runs")
+	}
+	if term.Run.Font == desc.Run.Font {
+		t.Fatalf("expected the term to be bold")
+	}
+	if desc.Rect.Min.X <= term.Rect.Min.X || item.Rect.Min.X <= desc.Rect.Min.X {
+		t.Fatalf("expected descriptions indented past terms and lists past descriptions")
+	}
+}
+
+func TestRenderNestedBlockquotes(t *testing.T) {
+	markdown := "> Outer\n>\n> - item\n>\n> ```\n> code\n> ```\n>\n> > Inner\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var quotes []*Box
+	roles := map[string]bool{}
+	l.Walk(func(b *Box) bool {
+		if b.Role == RoleBlockquote {
+			quotes = append(quotes, b)
+		}
+		if len(quotes) > 0 && b.Kind == BlockBox {
+			roles[b.Role] = true
+		}
+		return true
+	})
+	if len(quotes) != 2 {
+		t.Fatalf("expected an outer and an inner quote, got %d", len(quotes))
+	}
+	if !roles[RoleList] || !roles[RoleCode] || !roles[RoleParagraph] {
+		t.Fatalf("expected the quote's blocks to keep their roles, got %v", roles)
+	}
+	var bars []*Box
+	for _, q := range quotes {
+		for _, b := range q.Children {
+			if b.Kind == RuleBox {
+				bars = append(bars, b)
+			}
+		}
+	}
+	if len(bars) != 2 || bars[1].Rect.Min.X <= bars[0].Rect.Min.X {
+		t.Fatalf("expected one bar per level, each further right")
+	}
+	if !quotes[1].Rect.In(quotes[0].Rect) {
+		t.Fatalf("expected the inner quote inside the outer one")
+	}
+}
+
+func TestRenderListItemBlocks(t *testing.T) {
+	markdown := "1. ## Title\n2. | a | b |\n   |---|---|\n   | 1 | 2 |\n3. <div>html</div>\n4. ***\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var items []*Box
+	l.Walk(func(b *Box) bool {
+		if b.Role == RoleListItem {
+			items = append(items, b)
+		}
+		return true
+	})
+	if len(items) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(items))
+	}
+	runs := map[string]*Box{}
+	roles := map[string]bool{}
+	var rules int
+	for _, item := range items {
+		walkBoxes(item, func(b *Box) bool {
+			switch b.Kind {
+			case BlockBox:
+				roles[b.Role] = true
+			case GlyphRunBox:
+				runs[b.Run.Text] = b
+			case RuleBox:
+				rules++
+			}
+			return true
+		})
+	}
+	if !roles[RoleHeading] || !roles[RoleTable] || roles[RoleUnsupported] {
+		t.Fatalf("expected a heading and a table inside the items, got %v", roles)
+	}
+	title, marker := runs["Title"], runs["1."]
+	if title == nil || marker == nil || runs["html"] == nil || runs["a"] == nil {
+		t.Fatalf("expected the heading, marker, HTML and table text")
+	}
+	if marker.Run.Baseline != title.Run.Baseline {
+		t.Fatalf("expected the marker on the heading's baseline")
+	}
+	if rules == 0 {
+		t.Fatalf("expected the thematic break drawn inside its item")
+	}
+}
@@ -0,0 +1,1207 @@
+package md2png
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ---- Mermaid diagrams ----
+
+// Fenced code blocks tagged mermaid are drawn as diagrams when they hold a
+// flowchart (graph/flowchart TD, TB, BT, LR or RL) or a sequence diagram.
+// Styling statements such as classDef and style are accepted and ignored;
+// anything else falls back to a plain code block.
+
+// diagram is a parsed Mermaid diagram that can lay itself out.
+type diagram interface {
+	draw(s *sketch)
+}
+
+func parseDiagram(src string) (diagram, error) {
+	lines := mermaidLines(src)
+	if len(lines) == 0 {
+		return nil, errors.New("md2png: mermaid: empty diagram")
+	}
+	header := strings.Fields(lines[0])
+	switch header[0] {
+	case "graph", "flowchart":
+		dir := "TD"
+		if len(header) > 1 {
+			dir = strings.ToUpper(header[1])
+		}
+		return parseFlowchart(lines[1:], dir)
+	case "sequenceDiagram":
+		return parseSequence(lines[1:])
+	}
+	return nil, fmt.Errorf("md2png: mermaid: unsupported diagram type %q", header[0])
+}
+
+// mermaidLines splits src into trimmed statements, dropping blank lines
+// and %% comments. Flowchart statements may also be separated by ';'.
+func mermaidLines(src string) []string {
+	var out []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "%%"); i >= 0 {
+			line = line[:i]
+		}
+		for _, stmt := range strings.Split(line, ";") {
+			if stmt = strings.TrimSpace(stmt); stmt != "" {
+				out = append(out, stmt)
+			}
+		}
+	}
+	return out
+}
+
+// mermaidLabel unquotes a label and turns <br> into line breaks.
+func mermaidLabel(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for _, br := range []string{"<br/>", "<br />", "<br>"} {
+		s = strings.ReplaceAll(s, br, "\n")
+	}
+	return strings.Split(s, "\n")
+}
+
+// ---- Mermaid: flowcharts ----
+
+type flowShape int
+
+const (
+	shapeRect flowShape = iota
+	shapeRound
+	shapeStadium
+	shapeCircle
+	shapeDiamond
+	shapeHexagon
+)
+
+type flowNode struct {
+	id    string
+	label []string
+	shape flowShape
+}
+
+type edgeStyle int
+
+const (
+	edgeSolid edgeStyle = iota
+	edgeDotted
+	edgeThick
+)
+
+type flowEdge struct {
+	from, to *flowNode
+	label    []string
+	style    edgeStyle
+	arrow    bool
+}
+
+type flowchart struct {
+	dir   string
+	nodes []*flowNode
+	byID  map[string]*flowNode
+	edges []*flowEdge
+}
+
+// flowShapes lists node shape delimiters, longest first so "((" wins
+// over "(".
+var flowShapes = []struct {
+	open, close string
+	shape       flowShape
+}{
+	{"((", "))", shapeCircle}, {"([", "])", shapeStadium}, {"[[", "]]", shapeRect}, {"[(", ")]", shapeRound},
+	{"{{", "}}", shapeHexagon}, {"[", "]", shapeRect}, {"(", ")", shapeRound}, {"{", "}", shapeDiamond},
+	{">", "]", shapeRect},
+}
+
+var (
+	flowIDRe = regexp.MustCompile(`^[\p{L}\p{N}_]+`)
+	// A link, optionally with its label written inside it ("-- yes -->")
+	// or after it ("-->|yes|").
+	flowLinkRe = regexp.MustCompile(`^(?:(--|==|-\.)\s*([^>|]*?)\s*)?(-{2,}>|-{3,}|={2,}>|={3,}|-\.+->|-\.+-|\.-+>|\.-+|--[xo]|==[xo])(?:\s*\|([^|]*)\|)?`)
+)
+
+var flowIgnored = []string{"classDef ", "class ", "style ", "linkStyle ", "click ", "subgraph", "end", "direction "}
+
+func parseFlowchart(lines []string, dir string) (*flowchart, error) {
+	switch dir {
+	case "TB":
+		dir = "TD"
+	case "TD", "BT", "LR", "RL":
+	default:
+		return nil, fmt.Errorf("md2png: mermaid: unknown direction %q", dir)
+	}
+	f := &flowchart{dir: dir, byID: map[string]*flowNode{}}
+	for _, line := range lines {
+		if ignoredStatement(line) {
+			continue
+		}
+		if err := f.statement(line); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.nodes) == 0 {
+		return nil, errors.New("md2png: mermaid: flowchart has no nodes")
+	}
+	return f, nil
+}
+
+func ignoredStatement(line string) bool {
+	for _, prefix := range flowIgnored {
+		if line == strings.TrimSpace(prefix) || strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// statement parses "A & B --> C -->|label| D" style chains.
+func (f *flowchart) statement(s string) error {
+	prev, s, err := f.nodeGroup(s)
+	if err != nil {
+		return err
+	}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		m := flowLinkRe.FindStringSubmatch(s)
+		if m == nil {
+			return fmt.Errorf("md2png: mermaid: cannot parse %q", s)
+		}
+		s = s[len(m[0]):]
+		op := m[1] + m[3]
+		label := m[2]
+		if m[4] != "" {
+			label = m[4]
+		}
+		var next []*flowNode
+		if next, s, err = f.nodeGroup(s); err != nil {
+			return err
+		}
+		style := edgeSolid
+		switch {
+		case strings.Contains(op, "."):
+			style = edgeDotted
+		case strings.Contains(op, "="):
+			style = edgeThick
+		}
+		arrow := strings.HasSuffix(op, ">") || strings.HasSuffix(op, "x") || strings.HasSuffix(op, "o")
+		for _, from := range prev {
+			for _, to := range next {
+				e := &flowEdge{from: from, to: to, style: style, arrow: arrow}
+				if label = strings.TrimSpace(label); label != "" {
+					e.label = mermaidLabel(label)
+				}
+				f.edges = append(f.edges, e)
+			}
+		}
+		prev = next
+	}
+	return nil
+}
+
+// nodeGroup parses one or more nodes joined by '&'.
+func (f *flowchart) nodeGroup(s string) ([]*flowNode, string, error) {
+	var nodes []*flowNode
+	for {
+		n, rest, err := f.node(strings.TrimSpace(s))
+		if err != nil {
+			return nil, "", err
+		}
+		nodes = append(nodes, n)
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "&") {
+			return nodes, rest, nil
+		}
+		s = rest[1:]
+	}
+}
+
+// node parses a node reference with an optional shape and label, creating
+// the node on first use.
+func (f *flowchart) node(s string) (*flowNode, string, error) {
+	id := flowIDRe.FindString(s)
+	if id == "" {
+		return nil, "", fmt.Errorf("md2png: mermaid: expected a node at %q", s)
+	}
+	s = s[len(id):]
+	n := f.byID[id]
+	if n == nil {
+		n = &flowNode{id: id, label: []string{id}}
+		f.byID[id] = n
+		f.nodes = append(f.nodes, n)
+	}
+	for _, sh := range flowShapes {
+		if !strings.HasPrefix(s, sh.open) {
+			continue
+		}
+		end := strings.Index(s[len(sh.open):], sh.close)
+		if end < 0 {
+			return nil, "", fmt.Errorf("md2png: mermaid: unclosed %q in node %s", sh.open, id)
+		}
+		n.label = mermaidLabel(s[len(sh.open) : len(sh.open)+end])
+		n.shape = sh.shape
+		s = s[len(sh.open)+end+len(sh.close):]
+		break
+	}
+	if strings.HasPrefix(s, ":::") {
+		s = strings.TrimLeft(s[3:], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-")
+	}
+	return n, s, nil
+}
+
+// flowVertex is a node, or a dummy point that routes an edge spanning
+// several ranks around the nodes in between.
+type flowVertex struct {
+	node        *flowNode
+	rank, order int
+	main, cross float64 // center: along the flow and across it
+	mainSize    float64
+	crossSize   float64
+	w, h        float64 // node size on the page
+	preds, succ []*flowVertex
+}
+
+func (f *flowchart) draw(s *sketch) {
+	size := s.size
+	horizontal := f.dir == "LR" || f.dir == "RL"
+	vertices := map[*flowNode]*flowVertex{}
+	var all []*flowVertex
+	for _, n := range f.nodes {
+		w, h := s.nodeSize(n)
+		v := &flowVertex{node: n, w: w, h: h, mainSize: h, crossSize: w}
+		if horizontal {
+			v.mainSize, v.crossSize = w, h
+		}
+		vertices[n] = v
+		all = append(all, v)
+	}
+
+	reversed := f.backEdges()
+	rankNodes(f, vertices, reversed)
+
+	// Route edges through a dummy vertex on every rank they cross.
+	type route struct {
+		edge *flowEdge
+		path []*flowVertex
+	}
+	var routes []route
+	for _, e := range f.edges {
+		from, to := vertices[e.from], vertices[e.to]
+		if reversed[e] {
+			from, to = to, from
+		}
+		path := []*flowVertex{from}
+		for r := from.rank + 1; r < to.rank; r++ {
+			d := &flowVertex{rank: r, mainSize: 0, crossSize: size * 0.5}
+			all = append(all, d)
+			path = append(path, d)
+		}
+		path = append(path, to)
+		for i := 1; i < len(path); i++ {
+			path[i-1].succ = append(path[i-1].succ, path[i])
+			path[i].preds = append(path[i].preds, path[i-1])
+		}
+		routes = append(routes, route{e, path})
+	}
+
+	ranks := orderRanks(all)
+	gapMain := size * 2.5
+	for _, e := range f.edges {
+		if e.label != nil {
+			gapMain = size * 3.5
+			break
+		}
+	}
+	placeRanks(ranks, gapMain, size*1.5)
+
+	// Map to page coordinates.
+	for _, v := range all {
+		x, y := v.cross, v.main
+		if horizontal {
+			x, y = v.main, v.cross
+		}
+		switch f.dir {
+		case "BT":
+			y = -y
+		case "RL":
+			x = -x
+		}
+		v.main, v.cross = x, y // reused as x and y from here on
+	}
+
+	// Edges directly joining the same two nodes, such as a back edge
+	// answering a forward one, take lanes beside the first so their lines
+	// and labels stay apart.
+	type pair struct{ a, b *flowNode }
+	lanes := map[pair]int{}
+	laneGap := size
+	for _, e := range f.edges {
+		if e.label != nil {
+			w, h := s.textSize(e.label, size*0.9)
+			if horizontal {
+				w = h
+			}
+			laneGap = max(laneGap, size+w)
+		}
+	}
+
+	stroke := max(size/14, 1)
+	for _, rt := range routes {
+		e := rt.edge
+		pts := make([]PathPoint, len(rt.path))
+		for i, v := range rt.path {
+			pts[i] = PathPoint{v.main, v.cross}
+		}
+		if reversed[e] {
+			for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+				pts[i], pts[j] = pts[j], pts[i]
+			}
+		}
+		if e.from == e.to {
+			pts = s.selfLoop(vertices[e.from])
+		} else {
+			lane := lanes[pair{e.from, e.to}]
+			lanes[pair{e.from, e.to}]++
+			lanes[pair{e.to, e.from}]++
+			if lane > 0 && len(pts) == 2 {
+				pts = s.lane(vertices[e.from], vertices[e.to], lane, laneGap, horizontal)
+			}
+			src, dst := vertices[e.from], vertices[e.to]
+			pts[0] = s.clip(src, pts[1])
+			pts[len(pts)-1] = s.clip(dst, pts[len(pts)-2])
+		}
+		width := stroke
+		if e.style == edgeThick {
+			width *= 2.5
+		}
+		if e.arrow {
+			pts = s.arrowHead(pts, width, s.th.FG)
+		}
+		s.line(pts, width, s.th.FG, e.style == edgeDotted)
+		if e.label != nil {
+			mid := polylineMidpoint(pts)
+			s.label(e.label, mid.X, mid.Y, size*0.9, s.th.BG)
+		}
+	}
+	for _, n := range f.nodes {
+		v := vertices[n]
+		s.node(n, v.main, v.cross, v.w, v.h, stroke)
+	}
+}
+
+// backEdges finds the edges that close cycles, in a depth-first walk from
+// the nodes in order of appearance. Ranking treats them as reversed.
+func (f *flowchart) backEdges() map[*flowEdge]bool {
+	out := map[*flowNode][]*flowEdge{}
+	for _, e := range f.edges {
+		out[e.from] = append(out[e.from], e)
+	}
+	const (
+		unseen = iota
+		active
+		done
+	)
+	state := map[*flowNode]int{}
+	back := map[*flowEdge]bool{}
+	var visit func(n *flowNode)
+	visit = func(n *flowNode) {
+		state[n] = active
+		for _, e := range out[n] {
+			switch state[e.to] {
+			case unseen:
+				visit(e.to)
+			case active:
+				back[e] = true
+			}
+		}
+		state[n] = done
+	}
+	for _, n := range f.nodes {
+		if state[n] == unseen {
+			visit(n)
+		}
+	}
+	return back
+}
+
+// rankNodes gives every node the length of the longest path reaching it.
+func rankNodes(f *flowchart, vertices map[*flowNode]*flowVertex, reversed map[*flowEdge]bool) {
+	// Nodes are few, so relax until nothing changes; the graph is acyclic
+	// once back edges are reversed, so this settles.
+	for changed, rounds := true, 0; changed && rounds <= len(f.nodes); rounds++ {
+		changed = false
+		for _, e := range f.edges {
+			if e.from == e.to {
+				continue
+			}
+			from, to := vertices[e.from], vertices[e.to]
+			if reversed[e] {
+				from, to = to, from
+			}
+			if to.rank < from.rank+1 {
+				to.rank = from.rank + 1
+				changed = true
+			}
+		}
+	}
+}
+
+// orderRanks groups vertices by rank and orders each rank to reduce edge
+// crossings, sweeping down and up by the mean position of neighbors.
+func orderRanks(all []*flowVertex) [][]*flowVertex {
+	var ranks [][]*flowVertex
+	for _, v := range all {
+		for len(ranks) <= v.rank {
+			ranks = append(ranks, nil)
+		}
+		v.order = len(ranks[v.rank])
+		ranks[v.rank] = append(ranks[v.rank], v)
+	}
+	barycenter := func(v *flowVertex, neighbors []*flowVertex) float64 {
+		if len(neighbors) == 0 {
+			return float64(v.order)
+		}
+		sum := 0.0
+		for _, n := range neighbors {
+			sum += float64(n.order)
+		}
+		return sum / float64(len(neighbors))
+	}
+	for sweep := 0; sweep < 4; sweep++ {
+		down := sweep%2 == 0
+		for i := range ranks {
+			r := i
+			if !down {
+				r = len(ranks) - 1 - i
+			}
+			layer := ranks[r]
+			keys := make(map[*flowVertex]float64, len(layer))
+			for _, v := range layer {
+				if down {
+					keys[v] = barycenter(v, v.preds)
+				} else {
+					keys[v] = barycenter(v, v.succ)
+				}
+			}
+			sort.SliceStable(layer, func(a, b int) bool { return keys[layer[a]] < keys[layer[b]] })
+			for j, v := range layer {
+				v.order = j
+			}
+		}
+	}
+	return ranks
+}
+
+// placeRanks positions ranks along the flow and vertices across it, pulling
+// each vertex toward its neighbors while keeping at least gap between
+// vertices of the same rank.
+func placeRanks(ranks [][]*flowVertex, gapMain, gap float64) {
+	pos := 0.0
+	for _, layer := range ranks {
+		thickness := 0.0
+		for _, v := range layer {
+			thickness = max(thickness, v.mainSize)
+		}
+		x := 0.0
+		for _, v := range layer {
+			v.main = pos + thickness/2
+			v.cross = x + v.crossSize/2
+			x += v.crossSize + gap
+		}
+		pos += thickness + gapMain
+	}
+	for iter := 0; iter < 8; iter++ {
+		for i := range ranks {
+			r := i
+			if iter%2 == 1 {
+				r = len(ranks) - 1 - i
+			}
+			layer := ranks[r]
+			desired := make([]float64, len(layer))
+			for j, v := range layer {
+				desired[j] = v.cross
+				neighbors := append(append([]*flowVertex{}, v.preds...), v.succ...)
+				if len(neighbors) > 0 {
+					sum := 0.0
+					for _, n := range neighbors {
+						sum += n.cross
+					}
+					desired[j] = sum / float64(len(neighbors))
+				}
+			}
+			// Keep order and spacing, then shift the rank so it sits on
+			// average where its vertices want to be.
+			placed := make([]float64, len(layer))
+			for j, v := range layer {
+				placed[j] = desired[j]
+				if j > 0 {
+					minimum := placed[j-1] + layer[j-1].crossSize/2 + gap + v.crossSize/2
+					placed[j] = max(placed[j], minimum)
+				}
+			}
+			shift := 0.0
+			for j := range layer {
+				shift += desired[j] - placed[j]
+			}
+			shift /= float64(len(layer))
+			for j, v := range layer {
+				v.cross = placed[j] + shift
+			}
+		}
+	}
+}
+
+func polylineMidpoint(pts []PathPoint) PathPoint {
+	total := 0.0
+	for i := 1; i < len(pts); i++ {
+		total += math.Hypot(pts[i].X-pts[i-1].X, pts[i].Y-pts[i-1].Y)
+	}
+	half := total / 2
+	for i := 1; i < len(pts); i++ {
+		seg := math.Hypot(pts[i].X-pts[i-1].X, pts[i].Y-pts[i-1].Y)
+		if seg >= half && seg > 0 {
+			t := half / seg
+			return PathPoint{pts[i-1].X + (pts[i].X-pts[i-1].X)*t, pts[i-1].Y + (pts[i].Y-pts[i-1].Y)*t}
+		}
+		half -= seg
+	}
+	return pts[0]
+}
+
+// ---- Mermaid: sequence diagrams ----
+
+type seqArrow int
+
+const (
+	seqArrowFilled seqArrow = iota // ->>
+	seqArrowNone                   // ->
+	seqArrowCross                  // -x
+	seqArrowOpen                   // -)
+)
+
+type seqParticipant struct {
+	id    string
+	label []string
+	index int
+}
+
+type seqEventKind int
+
+const (
+	seqMessage seqEventKind = iota
+	seqNote
+	seqFrameStart
+	seqFrameElse
+	seqFrameEnd
+)
+
+type seqEvent struct {
+	kind     seqEventKind
+	from, to *seqParticipant // message ends, or the span of a note
+	text     []string
+	dashed   bool
+	arrow    seqArrow
+	side     string // note placement: "left", "right" or "over"
+	frame    string // loop, alt, opt ...
+}
+
+type sequence struct {
+	participants []*seqParticipant
+	byID         map[string]*seqParticipant
+	events       []seqEvent
+	autonumber   bool
+}
+
+var (
+	seqParticipantRe = regexp.MustCompile(`^(participant|actor)\s+(.+?)(?:\s+as\s+(.+))?$`)
+	seqMessageRe     = regexp.MustCompile(`^([^-+>:]+?)\s*(-->>|->>|-->|->|--x|-x|--\)|-\))\s*[+-]?\s*([^:]+?)\s*:(.*)$`)
+	seqNoteRe        = regexp.MustCompile(`^[Nn]ote\s+(left of|right of|over)\s+([^:]+):(.*)$`)
+	seqFrameRe       = regexp.MustCompile(`^(loop|alt|opt|par|critical|break|rect)\b\s*(.*)$`)
+	seqElseRe        = regexp.MustCompile(`^(else|and|option)\b\s*(.*)$`)
+)
+
+func parseSequence(lines []string) (*sequence, error) {
+	q := &sequence{byID: map[string]*seqParticipant{}}
+	depth := 0
+	for _, line := range lines {
+		switch {
+		case line == "autonumber":
+			q.autonumber = true
+		case strings.HasPrefix(line, "activate "), strings.HasPrefix(line, "deactivate "),
+			strings.HasPrefix(line, "title "), strings.HasPrefix(line, "title:"):
+		case seqParticipantRe.MatchString(line):
+			m := seqParticipantRe.FindStringSubmatch(line)
+			p := q.participant(m[2])
+			if m[3] != "" {
+				p.label = mermaidLabel(m[3])
+			}
+		case seqNoteRe.MatchString(line):
+			m := seqNoteRe.FindStringSubmatch(line)
+			ids := strings.Split(m[2], ",")
+			from := q.participant(ids[0])
+			to := from
+			if len(ids) > 1 {
+				to = q.participant(ids[1])
+			}
+			side := strings.Fields(m[1])[0]
+			q.events = append(q.events, seqEvent{kind: seqNote, from: from, to: to, side: side, text: mermaidLabel(m[3])})
+		case seqMessageRe.MatchString(line):
+			m := seqMessageRe.FindStringSubmatch(line)
+			e := seqEvent{kind: seqMessage, from: q.participant(m[1]), to: q.participant(m[3]), text: mermaidLabel(m[4])}
+			e.dashed = strings.HasPrefix(m[2], "--")
+			switch strings.TrimLeft(m[2], "-") {
+			case ">":
+				e.arrow = seqArrowNone
+			case "x":
+				e.arrow = seqArrowCross
+			case ")":
+				e.arrow = seqArrowOpen
+			}
+			q.events = append(q.events, e)
+		case seqFrameRe.MatchString(line):
+			m := seqFrameRe.FindStringSubmatch(line)
+			depth++
+			q.events = append(q.events, seqEvent{kind: seqFrameStart, frame: m[1], text: mermaidLabel(m[2])})
+		case seqElseRe.MatchString(line) && depth > 0:
+			m := seqElseRe.FindStringSubmatch(line)
+			q.events = append(q.events, seqEvent{kind: seqFrameElse, frame: m[1], text: mermaidLabel(m[2])})
+		case line == "end" && depth > 0:
+			depth--
+			q.events = append(q.events, seqEvent{kind: seqFrameEnd})
+		default:
+			return nil, fmt.Errorf("md2png: mermaid: cannot parse %q", line)
+		}
+	}
+	if len(q.participants) == 0 {
+		return nil, errors.New("md2png: mermaid: sequence diagram has no participants")
+	}
+	for ; depth > 0; depth-- {
+		q.events = append(q.events, seqEvent{kind: seqFrameEnd})
+	}
+	return q, nil
+}
+
+func (q *sequence) participant(id string) *seqParticipant {
+	id = strings.TrimSpace(id)
+	if p, ok := q.byID[id]; ok {
+		return p
+	}
+	p := &seqParticipant{id: id, label: []string{id}, index: len(q.participants)}
+	q.byID[id] = p
+	q.participants = append(q.participants, p)
+	return p
+}
+
+func (q *sequence) draw(s *sketch) {
+	size := s.size
+	textSize := size * 0.9
+	pad := size * 0.8
+	stroke := max(size/14, 1)
+
+	// Participant boxes and the spacing between their lifelines.
+	n := len(q.participants)
+	widths := make([]float64, n)
+	boxHeight := 0.0
+	for i, p := range q.participants {
+		w, h := s.textSize(p.label, size)
+		widths[i] = max(w+2*pad, size*5)
+		boxHeight = max(boxHeight, h+pad)
+	}
+	xs := make([]float64, n)
+	for i := 1; i < n; i++ {
+		xs[i] = xs[i-1] + (widths[i-1]+widths[i])/2 + size*2
+	}
+	number := 0
+	labels := make([][]string, len(q.events))
+	for i, e := range q.events {
+		labels[i] = e.text
+		if e.kind == seqMessage && q.autonumber {
+			number++
+			labels[i] = append([]string{fmt.Sprintf("%d. %s", number, e.text[0])}, e.text[1:]...)
+		}
+	}
+	// Widen gaps so every message label fits between its ends.
+	for i, e := range q.events {
+		if e.kind != seqMessage {
+			continue
+		}
+		w, _ := s.textSize(labels[i], textSize)
+		a, b := min(e.from.index, e.to.index), max(e.from.index, e.to.index)
+		need := w + size*2
+		if a == b {
+			// Self messages loop out to the right.
+			b = a + 1
+			need = w + size*3
+			if b >= n {
+				continue
+			}
+		}
+		if short := need - (xs[b] - xs[a]); short > 0 {
+			for j := b; j < n; j++ {
+				xs[j] += short
+			}
+		}
+	}
+
+	top := 0.0
+	y := top + boxHeight + size
+	lineHeight := textSize * 1.3
+	type openFrame struct {
+		kind, label string
+		top         float64
+		lo, hi      int
+		dividers    []float64
+		elseLabels  [][]string
+	}
+	var frames []*openFrame
+	widen := func(lo, hi int) {
+		for _, f := range frames {
+			f.lo, f.hi = min(f.lo, lo), max(f.hi, hi)
+		}
+	}
+	type pending func()
+	var late []pending // frames are drawn under messages
+	for i, e := range q.events {
+		switch e.kind {
+		case seqMessage:
+			_, h := s.textSize(labels[i], textSize)
+			y += h
+			x1, x2 := xs[e.from.index], xs[e.to.index]
+			var pts []PathPoint
+			if e.from == e.to {
+				loop := size * 2
+				pts = []PathPoint{{x1, y}, {x1 + loop, y}, {x1 + loop, y + size}, {x1, y + size}}
+				s.label(labels[i], x1+loop/2+s.textWidth(labels[i], textSize)/2+size*0.3, y-h/2-size*0.2, textSize, nil)
+				y += size
+			} else {
+				pts = []PathPoint{{x1, y}, {x2, y}}
+				s.label(labels[i], (x1+x2)/2, y-h/2-size*0.25, textSize, nil)
+			}
+			switch e.arrow {
+			case seqArrowFilled:
+				pts = s.arrowHead(pts, stroke, s.th.FG)
+			case seqArrowOpen:
+				s.openArrowHead(pts, stroke, s.th.FG)
+			case seqArrowCross:
+				s.cross(pts[len(pts)-1], size*0.35, stroke, s.th.FG)
+			}
+			s.line(pts, stroke, s.th.FG, e.dashed)
+			widen(min(e.from.index, e.to.index), max(e.from.index, e.to.index))
+			y += size * 1.2
+		case seqNote:
+			w, h := s.textSize(e.text, textSize)
+			w += pad
+			h += pad * 0.6
+			a, b := xs[min(e.from.index, e.to.index)], xs[max(e.from.index, e.to.index)]
+			var left float64
+			switch e.side {
+			case "left":
+				left = a - size*0.5 - w
+			case "right":
+				left = a + size*0.5
+			default:
+				w = max(w, b-a+size*2)
+				left = (a+b)/2 - w/2
+			}
+			s.box(left, y, w, h, s.th.CodeBG, s.th.QuoteBar, stroke, 0)
+			s.label(e.text, left+w/2, y+h/2, textSize, nil)
+			widen(e.from.index, e.to.index)
+			y += h + size
+		case seqFrameStart:
+			frames = append(frames, &openFrame{kind: e.frame, label: strings.Join(e.text, " "), top: y, lo: n, hi: -1})
+			y += lineHeight + size*0.8
+		case seqFrameElse:
+			if len(frames) > 0 {
+				f := frames[len(frames)-1]
+				f.dividers = append(f.dividers, y)
+				f.elseLabels = append(f.elseLabels, e.text)
+				y += lineHeight + size
+			}
+		case seqFrameEnd:
+			if len(frames) == 0 {
+				continue
+			}
+			f := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			if f.hi < 0 {
+				f.lo, f.hi = 0, n-1
+			}
+			inset := float64(len(frames)) * size * 0.4
+			left := xs[f.lo] - widths[f.lo]/2 - size*0.5 + inset
+			right := xs[f.hi] + widths[f.hi]/2 + size*0.5 - inset
+			bottom := y
+			y += size * 0.6
+			late = append(late, func() {
+				s.box(left, f.top, right-left, bottom-f.top, nil, s.th.QuoteBar, stroke, 0)
+				tag := []string{f.kind}
+				tw, th := s.textSize(tag, textSize)
+				s.box(left, f.top, tw+pad, th+pad*0.4, s.th.CodeBG, s.th.QuoteBar, stroke, 0)
+				s.text(f.kind, left+(tw+pad)/2, f.top+(th+pad*0.4)/2, textSize, s.fonts.byRole(FontBold), s.th.FG)
+				if f.label != "" {
+					s.text("["+f.label+"]", left+tw+pad+size*0.5+s.textWidth([]string{"[" + f.label + "]"}, textSize)/2,
+						f.top+(th+pad*0.4)/2, textSize, nil, s.th.FG)
+				}
+				for j, dy := range f.dividers {
+					s.line([]PathPoint{{left, dy}, {right, dy}}, stroke, s.th.QuoteBar, true)
+					if label := strings.Join(f.elseLabels[j], " "); label != "" {
+						s.text("["+label+"]", (left+right)/2, dy+lineHeight/2+size*0.2, textSize, nil, s.th.FG)
+					}
+				}
+			})
+			widen(f.lo, f.hi)
+		}
+	}
+
+	bottomTop := y + size*0.5
+	for i, p := range q.participants {
+		s.line([]PathPoint{{xs[i], top + boxHeight}, {xs[i], bottomTop}}, stroke, s.th.QuoteBar, true)
+		for _, boxTop := range []float64{top, bottomTop} {
+			s.box(xs[i]-widths[i]/2, boxTop, widths[i], boxHeight, s.th.CodeBG, s.th.FG, stroke, size*0.2)
+			s.label(p.label, xs[i], boxTop+boxHeight/2, size, nil)
+		}
+	}
+	for _, f := range late {
+		f()
+	}
+}
+
+// ---- Mermaid: drawing ----
+
+// sketch collects the boxes of a diagram in its own coordinate space; the
+// canvas moves them into place once the diagram's extent is known.
+type sketch struct {
+	fonts Fonts
+	th    Theme
+	size  float64
+	boxes []*Box
+	under []*Box // drawn first: frames and lifelines go under messages
+}
+
+// drawDiagram draws a Mermaid diagram centered between left and right and
+// reports whether src was a diagram it could draw. Diagrams wider than the
+// space available are drawn at a smaller size, down to half.
+func (c *canvas) drawDiagram(src string, left, right int) bool {
+	d, err := parseDiagram(src)
+	if err != nil {
+		return false
+	}
+	avail := right - left
+	s := &sketch{fonts: c.fonts, th: c.th, size: c.ptSize}
+	d.draw(s)
+	bounds := s.bounds()
+	if bounds.Dx() > avail {
+		s = &sketch{fonts: c.fonts, th: c.th, size: c.ptSize * max(float64(avail)/float64(bounds.Dx()), 0.5)}
+		d.draw(s)
+		bounds = s.bounds()
+	}
+	pad := int(c.ptSize * 0.5)
+	block := c.beginBlock(RoleDiagram, left, right)
+	c.addVSpace(pad)
+	offset := image.Pt(left+max((avail-bounds.Dx())/2, 0)-bounds.Min.X, c.cursorY-bounds.Min.Y)
+	for _, b := range append(s.under, s.boxes...) {
+		shiftBox(b, offset)
+		c.add(b)
+	}
+	c.cursorY += bounds.Dy() + pad
+	c.endBlock(block)
+	return true
+}
+
+// shiftBox moves b and its children by d.
+func shiftBox(b *Box, d image.Point) {
+	b.Rect = b.Rect.Add(d)
+	if b.Run != nil {
+		b.Run.Baseline += d.Y
+	}
+	for _, poly := range b.Path {
+		for i := range poly {
+			poly[i].X += float64(d.X)
+			poly[i].Y += float64(d.Y)
+		}
+	}
+	for _, child := range b.Children {
+		shiftBox(child, d)
+	}
+}
+
+func (s *sketch) bounds() image.Rectangle {
+	var r image.Rectangle
+	for _, b := range append(s.under, s.boxes...) {
+		if r.Empty() {
+			r = b.Rect
+		} else {
+			r = r.Union(b.Rect)
+		}
+	}
+	return r
+}
+
+func (s *sketch) textWidth(lines []string, size float64) float64 {
+	w, _ := s.textSize(lines, size)
+	return w
+}
+
+func (s *sketch) textSize(lines []string, size float64) (w, h float64) {
+	for _, line := range lines {
+		w = max(w, measureWidth(s.fonts.Regular, size, line))
+	}
+	return w, float64(len(lines)) * size * 1.3
+}
+
+// text draws one line centered on (cx, cy).
+func (s *sketch) text(line string, cx, cy, size float64, f *FontAndFace, col color.Color) {
+	if f == nil {
+		f = s.fonts.Regular
+	}
+	if f == nil || line == "" {
+		return
+	}
+	w := measureWidth(f, size, line)
+	run := GlyphRun{Text: line, Font: f, Size: size, Color: col, Baseline: int(math.Round(cy + size*0.35))}
+	ascent, descent := fontExtents(f, size)
+	x := int(math.Round(cx - w/2))
+	s.boxes = append(s.boxes, &Box{
+		Kind: GlyphRunBox,
+		Rect: image.Rect(x, run.Baseline-ascent, x+int(w), run.Baseline+descent),
+		Run:  &run,
+	})
+}
+
+// label draws lines centered on (cx, cy), over a patch of bg when set so
+// the text stays readable on top of edges.
+func (s *sketch) label(lines []string, cx, cy, size float64, bg color.Color) {
+	w, h := s.textSize(lines, size)
+	if bg != nil {
+		pad := size * 0.25
+		s.fill(Path{rectPolygon(floatRect(cx-w/2-pad, cy-h/2, w+2*pad, h), false)}, bg)
+	}
+	for i, line := range lines {
+		s.text(line, cx, cy-h/2+(float64(i)+0.5)*size*1.3, size, nil, s.th.FG)
+	}
+}
+
+func floatRect(x, y, w, h float64) image.Rectangle {
+	return image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+}
+
+// fill adds a filled path.
+func (s *sketch) fill(path Path, col color.Color) {
+	if col == nil || len(path) == 0 {
+		return
+	}
+	var r image.Rectangle
+	for _, poly := range path {
+		for _, p := range poly {
+			pt := image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Ceil(p.X))+1, int(math.Ceil(p.Y))+1)
+			if r.Empty() {
+				r = pt
+			} else {
+				r = r.Union(pt)
+			}
+		}
+	}
+	s.boxes = append(s.boxes, &Box{Kind: PathBox, Rect: r, Fill: col, Path: path})
+}
+
+// line strokes a polyline, solid or dashed.
+func (s *sketch) line(pts []PathPoint, width float64, col color.Color, dashed bool) {
+	if !dashed {
+		s.fill(strokePolyline(pts, width), col)
+		return
+	}
+	dash, gap := s.size*0.35, s.size*0.25
+	var path Path
+	on, left := true, dash
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		for pos := 0.0; pos < length; {
+			step := min(left, length-pos)
+			if on {
+				t0, t1 := pos/length, (pos+step)/length
+				p0 := PathPoint{a.X + (b.X-a.X)*t0, a.Y + (b.Y-a.Y)*t0}
+				p1 := PathPoint{a.X + (b.X-a.X)*t1, a.Y + (b.Y-a.Y)*t1}
+				if seg := strokeSegment(p0, p1, width); seg != nil {
+					path = append(path, seg)
+				}
+			}
+			pos += step
+			left -= step
+			if left <= 0 {
+				on = !on
+				left = dash
+				if !on {
+					left = gap
+				}
+			}
+		}
+	}
+	s.fill(path, col)
+}
+
+// arrowHead draws a filled arrowhead at the end of pts and returns pts
+// shortened so the line stops at the head's base.
+func (s *sketch) arrowHead(pts []PathPoint, width float64, col color.Color) []PathPoint {
+	n := len(pts)
+	tip, from := pts[n-1], pts[n-2]
+	dx, dy := tip.X-from.X, tip.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return pts
+	}
+	ux, uy := dx/length, dy/length
+	headLength := max(s.size*0.55, width*4)
+	headWidth := headLength * 0.8
+	base := PathPoint{tip.X - ux*headLength, tip.Y - uy*headLength}
+	s.fill(Path{{
+		tip,
+		{base.X - uy*headWidth/2, base.Y + ux*headWidth/2},
+		{base.X + uy*headWidth/2, base.Y - ux*headWidth/2},
+	}}, col)
+	out := append([]PathPoint{}, pts...)
+	out[n-1] = PathPoint{tip.X - ux*headLength*0.8, tip.Y - uy*headLength*0.8}
+	return out
+}
+
+// openArrowHead draws the two barbs of an open arrowhead at the end of pts.
+func (s *sketch) openArrowHead(pts []PathPoint, width float64, col color.Color) {
+	n := len(pts)
+	tip, from := pts[n-1], pts[n-2]
+	dx, dy := tip.X-from.X, tip.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return
+	}
+	ux, uy := dx/length, dy/length
+	l := s.size * 0.5
+	for _, side := range []float64{-1, 1} {
+		end := PathPoint{tip.X - ux*l + side*uy*l*0.5, tip.Y - uy*l - side*ux*l*0.5}
+		s.fill(strokePolyline([]PathPoint{end, tip}, width), col)
+	}
+}
+
+// cross draws an X centered on p.
+func (s *sketch) cross(p PathPoint, size, width float64, col color.Color) {
+	h := size / 2
+	s.fill(Path{
+		strokeSegment(PathPoint{p.X - h, p.Y - h}, PathPoint{p.X + h, p.Y + h}, width),
+		strokeSegment(PathPoint{p.X - h, p.Y + h}, PathPoint{p.X + h, p.Y - h}, width),
+	}, col)
+}
+
+// box draws a rectangle with optional fill and border, with rounded
+// corners when radius is set. Boxes go under everything else.
+func (s *sketch) box(x, y, w, h float64, fill, border color.Color, width, radius float64) {
+	poly := roundedRectPolygon(floatRect(x, y, w, h), radius)
+	boxes := s.boxes
+	s.boxes = nil
+	s.fill(Path{poly}, fill)
+	if border != nil {
+		s.fill(strokePolyline(append(poly, poly[0], poly[1]), width), border)
+	}
+	s.under = append(s.under, s.boxes...)
+	s.boxes = boxes
+}
+
+// nodeSize returns the size of a flowchart node drawn around its label.
+func (s *sketch) nodeSize(n *flowNode) (w, h float64) {
+	tw, th := s.textSize(n.label, s.size)
+	padX, padY := s.size, s.size*0.6
+	switch n.shape {
+	case shapeCircle:
+		d := math.Hypot(tw, th) + padY
+		return d, d
+	case shapeDiamond:
+		return tw*1.5 + padX*2, th*2 + padY*2
+	case shapeHexagon:
+		return tw + padX*2 + th, th + padY*2
+	}
+	return tw + padX*2, th + padY*2
+}
+
+// nodePolygon returns the outline of a node centered on (cx, cy).
+func nodePolygon(n *flowNode, cx, cy, w, h float64) []PathPoint {
+	r := floatRect(cx-w/2, cy-h/2, w, h)
+	switch n.shape {
+	case shapeRound:
+		return roundedRectPolygon(r, h*0.25)
+	case shapeStadium, shapeCircle:
+		return roundedRectPolygon(r, h/2)
+	case shapeDiamond:
+		return []PathPoint{{cx, cy - h/2}, {cx + w/2, cy}, {cx, cy + h/2}, {cx - w/2, cy}}
+	case shapeHexagon:
+		in := h / 2
+		return []PathPoint{{cx - w/2 + in, cy - h/2}, {cx + w/2 - in, cy - h/2}, {cx + w/2, cy},
+			{cx + w/2 - in, cy + h/2}, {cx - w/2 + in, cy + h/2}, {cx - w/2, cy}}
+	}
+	return rectPolygon(r, false)
+}
+
+func (s *sketch) node(n *flowNode, cx, cy, w, h, width float64) {
+	poly := nodePolygon(n, cx, cy, w, h)
+	s.fill(Path{poly}, s.th.CodeBG)
+	s.fill(strokePolyline(append(poly, poly[0], poly[1]), width), s.th.FG)
+	s.label(n.label, cx, cy, s.size, nil)
+}
+
+// clip returns where the line from v's center toward p leaves v's shape.
+func (s *sketch) clip(v *flowVertex, p PathPoint) PathPoint {
+	cx, cy := v.main, v.cross
+	dx, dy := p.X-cx, p.Y-cy
+	if dx == 0 && dy == 0 {
+		return p
+	}
+	hw, hh := v.w/2, v.h/2
+	var t float64
+	switch v.node.shape {
+	case shapeDiamond:
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	case shapeCircle:
+		t = hw / math.Hypot(dx, dy)
+	default:
+		t = math.Inf(1)
+		if dx != 0 {
+			t = hw / math.Abs(dx)
+		}
+		if dy != 0 {
+			t = min(t, hh/math.Abs(dy))
+		}
+	}
+	return PathPoint{cx + dx*t, cy + dy*t}
+}
+
+// lane returns the path of the nth extra edge between from and to: it bends
+// out across the flow, alternating sides, and runs beside the direct line.
+func (s *sketch) lane(from, to *flowVertex, n int, gap float64, horizontal bool) []PathPoint {
+	off := gap * float64((n+1)/2)
+	if n%2 == 0 {
+		off = -off
+	}
+	var dx, dy float64
+	if horizontal {
+		dy = off
+	} else {
+		dx = off
+	}
+	a := s.clip(from, PathPoint{to.main, to.cross})
+	b := s.clip(to, PathPoint{from.main, from.cross})
+	bend := func(t float64) PathPoint {
+		return PathPoint{a.X + (b.X-a.X)*t + dx, a.Y + (b.Y-a.Y)*t + dy}
+	}
+	return []PathPoint{{from.main, from.cross}, bend(0.25), bend(0.75), {to.main, to.cross}}
+}
+
+// selfLoop returns a path leaving v's right side and coming back to it.
+func (s *sketch) selfLoop(v *flowVertex) []PathPoint {
+	x, y := v.main+v.w/2, v.cross
+	l := s.size * 1.2
+	return []PathPoint{{x, y - v.h/4}, {x + l, y - v.h/4}, {x + l, y + v.h/4}, {x, y + v.h/4}}
+}
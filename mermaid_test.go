@@ -0,0 +1,122 @@
+package md2png
+
+import "testing"
+
+func TestParseFlowchart(t *testing.T) {
+	d, err := parseDiagram("graph LR\n  A[Start] -->|go| B{Check}; B -- no --> A\n  B & A -.-> C((Done)) %% comment\n  classDef hot fill:#f00\n")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	f := d.(*flowchart)
+	if f.dir != "LR" || len(f.nodes) != 3 || len(f.edges) != 4 {
+		t.Fatalf("expected 3 nodes and 4 edges, got %d and %d", len(f.nodes), len(f.edges))
+	}
+	if a := f.byID["A"]; a.label[0] != "Start" || a.shape != shapeRect {
+		t.Fatalf("unexpected node A: %+v", a)
+	}
+	if f.byID["B"].shape != shapeDiamond || f.byID["C"].shape != shapeCircle {
+		t.Fatalf("expected a diamond and a circle")
+	}
+	if e := f.edges[0]; e.label[0] != "go" || !e.arrow || e.style != edgeSolid {
+		t.Fatalf("unexpected first edge: %+v", e)
+	}
+	if e := f.edges[1]; e.label[0] != "no" || e.from != f.byID["B"] || e.to != f.byID["A"] {
+		t.Fatalf("unexpected inline-labelled edge: %+v", e)
+	}
+	if e := f.edges[3]; e.style != edgeDotted || e.from != f.byID["A"] {
+		t.Fatalf("expected the & group to fan out dotted edges, got %+v", e)
+	}
+	if back := f.backEdges(); len(back) != 1 || !back[f.edges[1]] {
+		t.Fatalf("expected B --> A to be the only back edge")
+	}
+}
+
+func TestParseSequence(t *testing.T) {
+	src := "sequenceDiagram\n  participant A as Alice\n  A->>+B: Hi\n  loop Daily\n    B-->>A: Hello\n  end\n  Note over A,B: both\n"
+	d, err := parseDiagram(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	q := d.(*sequence)
+	if len(q.participants) != 2 || q.participants[0].label[0] != "Alice" || q.participants[1].id != "B" {
+		t.Fatalf("unexpected participants: %+v", q.participants)
+	}
+	kinds := []seqEventKind{seqMessage, seqFrameStart, seqMessage, seqFrameEnd, seqNote}
+	if len(q.events) != len(kinds) {
+		t.Fatalf("expected %d events, got %d", len(kinds), len(q.events))
+	}
+	for i, k := range kinds {
+		if q.events[i].kind != k {
+			t.Fatalf("event %d: expected kind %d, got %d", i, k, q.events[i].kind)
+		}
+	}
+	if e := q.events[2]; !e.dashed || e.from.id != "B" || e.text[0] != "Hello" {
+		t.Fatalf("unexpected reply: %+v", e)
+	}
+	if _, err := parseDiagram("pie title Pets\n"); err == nil {
+		t.Fatalf("expected unsupported diagram types to fail")
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	markdown := "```mermaid\ngraph TD\n  A --> B\n  A --> C\n```\n\n```mermaid\nsequenceDiagram\n  A->>B: ping\n```\n\n```mermaid\ngantt\n```\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var diagrams, code []*Box
+	l.Walk(func(b *Box) bool {
+		switch b.Role {
+		case RoleDiagram:
+			diagrams = append(diagrams, b)
+			return false
+		case RoleCode:
+			code = append(code, b)
+		}
+		return true
+	})
+	if len(diagrams) != 2 || len(code) != 1 {
+		t.Fatalf("expected two diagrams and one code block fallback, got %d and %d", len(diagrams), len(code))
+	}
+
+	texts := map[string]*Box{}
+	for _, b := range diagrams[0].Children {
+		if b.Kind == GlyphRunBox {
+			texts[b.Run.Text] = b
+		}
+		if !b.Rect.In(diagrams[0].Rect) {
+			t.Fatalf("diagram part %v outside its block %v", b.Rect, diagrams[0].Rect)
+		}
+	}
+	a, b, c := texts["A"], texts["B"], texts["C"]
+	if a == nil || b == nil || c == nil {
+		t.Fatalf("expected labels for every node")
+	}
+	if b.Run.Baseline <= a.Run.Baseline || b.Run.Baseline != c.Run.Baseline || b.Rect.Min.X == c.Rect.Min.X {
+		t.Fatalf("expected B and C side by side below A")
+	}
+}
+
+func TestRenderMermaidBackEdges(t *testing.T) {
+	for _, dir := range []string{"TD", "LR"} {
+		markdown := "```mermaid\ngraph " + dir + "\n  A -->|yes| B\n  B -->|no| A\n```\n"
+		l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		texts := map[string]*Box{}
+		l.Walk(func(b *Box) bool {
+			if b.Kind == GlyphRunBox {
+				texts[b.Run.Text] = b
+			}
+			return true
+		})
+		yes, no := texts["yes"], texts["no"]
+		if yes == nil || no == nil {
+			t.Fatalf("%s: expected both edge labels", dir)
+		}
+		if yes.Rect.Overlaps(no.Rect) {
+			t.Fatalf("%s: expected the labels apart, got %v and %v", dir, yes.Rect, no.Rect)
+		}
+	}
+}
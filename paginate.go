@@ -0,0 +1,121 @@
+package md2png
+
+import (
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// ---- Pagination ----
+
+// pageSlice is the band of a layout, in document pixels, shown on one page.
+type pageSlice struct {
+	top, bottom int
+}
+
+// unbreakableSpans returns the vertical extents page breaks must not cut
+// through: lines of text (including code lines), images, shapes, display
+// formulas, diagrams and table rows.
+// Overlapping extents are merged and the result is sorted by top.
+func (l *Layout) unbreakableSpans() []pageSlice {
+	var spans []pageSlice
+	l.Walk(func(b *Box) bool {
+		switch {
+		case b.Kind == LineBox, b.Kind == ImageBox, b.Kind == GlyphRunBox, b.Kind == PathBox:
+			spans = append(spans, pageSlice{b.Rect.Min.Y, b.Rect.Max.Y})
+			return false
+		case b.Kind == BlockBox && (b.Role == RoleTableRow || b.Role == RoleMath || b.Role == RoleDiagram):
+			spans = append(spans, pageSlice{b.Rect.Min.Y, b.Rect.Max.Y})
+			return false
+		}
+		return true
+	})
+	sort.Slice(spans, func(i, j int) bool { return spans[i].top < spans[j].top })
+	var merged []pageSlice
+	for _, s := range spans {
+		if s.bottom <= s.top {
+			continue
+		}
+		if n := len(merged); n > 0 && s.top < merged[n-1].bottom {
+			if s.bottom > merged[n-1].bottom {
+				merged[n-1].bottom = s.bottom
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// paginate splits the content area of the layout (everything between the top
+// and bottom margins) into slices no taller than height. Breaks are placed
+// between unbreakable spans; a span taller than a whole page is cut where it
+// overflows.
+func (l *Layout) paginate(height int) []pageSlice {
+	top, bottom := l.Margin, l.Height-l.Margin
+	if bottom <= top || height <= 0 {
+		return []pageSlice{{top, bottom}}
+	}
+	spans := l.unbreakableSpans()
+	var pages []pageSlice
+	for top < bottom {
+		limit := top + height
+		if limit >= bottom {
+			pages = append(pages, pageSlice{top, bottom})
+			break
+		}
+		cut := limit
+		for _, s := range spans {
+			if s.top >= limit {
+				break
+			}
+			if s.top < limit && s.bottom > limit && s.top > top {
+				cut = s.top
+				break
+			}
+		}
+		pages = append(pages, pageSlice{top, cut})
+		top = cut
+	}
+	return pages
+}
+
+// RenderPages renders the Markdown document as a series of images, each
+// opts.PageHeight pixels tall. Breaks fall between lines, images and table
+// rows, so content that does not fit moves to the next page. When PageHeight
+// is zero the whole document is returned as a single page.
+func RenderPages(data []byte, opts RenderOptions) ([]*image.RGBA, error) {
+	l, err := LayoutDocument(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PageHeight <= 0 {
+		return []*image.RGBA{PaintRaster(l)}, nil
+	}
+	return PaintPages(l, opts.PageHeight), nil
+}
+
+// PaintPages paints a layout as fixed-height pages. The layout's margin is
+// kept at the top and bottom of every page.
+func PaintPages(l *Layout, pageHeight int) []*image.RGBA {
+	top, contentHeight := pageContent(l, pageHeight)
+	var pages []*image.RGBA
+	for _, slice := range l.paginate(contentHeight) {
+		band := paintRaster(l, image.Rect(0, slice.top, l.Width, slice.bottom))
+		page := newBackground(l.Width, pageHeight, l.Background)
+		draw.Draw(page, band.Bounds().Add(image.Pt(0, top)), band, image.Point{}, draw.Src)
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// pageContent returns where content starts on a page of the given height and
+// how tall the content band is, falling back to the full page when the
+// layout's margins leave no room.
+func pageContent(l *Layout, pageHeight int) (top, height int) {
+	top, height = l.Margin, pageHeight-2*l.Margin
+	if height <= 0 {
+		return 0, pageHeight
+	}
+	return top, height
+}
@@ -0,0 +1,82 @@
+package md2png
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPaginateNeverSplitsLinesOrRows(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "Paragraph %d wraps across a few lines so that page breaks have to pick a gap between lines of text.\n\n", i)
+	}
+	b.WriteString("```\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "code line %d\n", i)
+	}
+	b.WriteString("```\n\n| A | B |\n| --- | --- |\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "| row %d | value |\n", i)
+	}
+	l, err := LayoutDocument([]byte(b.String()), RenderOptions{Width: 360, Margin: 20})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	const height = 300
+	pages := l.paginate(height)
+	if len(pages) < 3 {
+		t.Fatalf("expected several pages, got %d", len(pages))
+	}
+	if pages[0].top != l.Margin || pages[len(pages)-1].bottom != l.Height-l.Margin {
+		t.Fatalf("expected pages to cover the content area, got %v", pages)
+	}
+	for i, p := range pages {
+		if p.bottom-p.top > height {
+			t.Fatalf("page %d is %dpx tall, limit %d", i, p.bottom-p.top, height)
+		}
+		if i > 0 && p.top != pages[i-1].bottom {
+			t.Fatalf("expected page %d to start where the previous one ended", i)
+		}
+		l.Walk(func(box *Box) bool {
+			atomic := box.Kind == LineBox || (box.Kind == BlockBox && box.Role == RoleTableRow)
+			if atomic && box.Rect.Min.Y < p.bottom && box.Rect.Max.Y > p.bottom {
+				t.Fatalf("page break at %d splits %s box %v", p.bottom, box.Kind, box.Rect)
+			}
+			return !atomic
+		})
+	}
+}
+
+func TestRenderPages(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "Line %d of a document split into fixed-height pages.\n\n", i)
+	}
+	opts := RenderOptions{Width: 400, Margin: 20, PageHeight: 240}
+	pages, err := RenderPages([]byte(b.String()), opts)
+	if err != nil {
+		t.Fatalf("render pages failed: %v", err)
+	}
+	if len(pages) < 2 {
+		t.Fatalf("expected several pages, got %d", len(pages))
+	}
+	for i, page := range pages {
+		if page.Bounds().Dx() != 400 || page.Bounds().Dy() != 240 {
+			t.Fatalf("page %d has bounds %v", i, page.Bounds())
+		}
+	}
+
+	opts.PageHeight = 0
+	single, err := RenderPages([]byte(b.String()), opts)
+	if err != nil {
+		t.Fatalf("render without paging failed: %v", err)
+	}
+	full, err := Render([]byte(b.String()), opts)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if len(single) != 1 || single[0].Bounds() != full.Bounds() {
+		t.Fatalf("expected a single full-length page without PageHeight")
+	}
+}
@@ -0,0 +1,470 @@
+package md2png
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// ---- PDF backend ----
+
+// PageSize is a page size in PDF points (1/72 inch).
+type PageSize struct {
+	Width  float64
+	Height float64
+}
+
+// Common page sizes.
+var (
+	PageA4     = PageSize{Width: 595.28, Height: 841.89}
+	PageLetter = PageSize{Width: 612, Height: 792}
+)
+
+// PageSizeByName returns a built-in page size by name ("a4" or "letter").
+func PageSizeByName(name string) (PageSize, error) {
+	switch strings.ToLower(name) {
+	case "a4", "":
+		return PageA4, nil
+	case "letter":
+		return PageLetter, nil
+	default:
+		return PageSize{}, errors.New("unknown page size: " + name)
+	}
+}
+
+// PDFOptions configure PDF output. Zero values select A4 pages with a half
+// inch margin.
+type PDFOptions struct {
+	PageSize PageSize
+	Margin   float64 // page margin in points
+}
+
+func (p PDFOptions) withDefaults() PDFOptions {
+	if p.PageSize.Width <= 0 || p.PageSize.Height <= 0 {
+		p.PageSize = PageA4
+	}
+	if p.Margin <= 0 {
+		p.Margin = 36
+	}
+	return p
+}
+
+// pointsPerPixel converts layout pixels (96 DPI) to PDF points.
+const pointsPerPixel = 72.0 / 96.0
+
+// RenderPDF lays out the Markdown document to fit the configured page and
+// writes it to w as a multi-page PDF. The page size and margin replace the
+// Width and Margin of opts; every other option applies as usual.
+func RenderPDF(w io.Writer, data []byte, opts RenderOptions, popts PDFOptions) error {
+	popts = popts.withDefaults()
+	opts.Width = int(popts.PageSize.Width / pointsPerPixel)
+	opts.Margin = int(popts.Margin / pointsPerPixel)
+	if opts.Margin <= 0 {
+		opts.Margin = 1
+	}
+	l, err := LayoutDocument(data, opts)
+	if err != nil {
+		return err
+	}
+	return WritePDF(w, l, popts)
+}
+
+// WritePDF paints a layout as a PDF, scaling it to the page width and
+// breaking it into pages between lines, images and table rows. The layout's
+// own margin is repeated at the top and bottom of every page. Fonts are
+// embedded from the font files the layout was built with.
+func WritePDF(w io.Writer, l *Layout, popts PDFOptions) error {
+	popts = popts.withDefaults()
+	if l.Width <= 0 {
+		return errors.New("md2png: empty layout")
+	}
+	page := popts.PageSize
+	scale := page.Width / float64(l.Width)
+	pageHeight := int(page.Height / scale)
+	top, contentHeight := pageContent(l, pageHeight)
+
+	doc := &pdfDoc{}
+	catalogID := doc.reserve()
+	pagesID := doc.reserve()
+	resourcesID := doc.reserve()
+	p := &pdfPainter{
+		doc:    doc,
+		fonts:  map[*FontAndFace]*pdfFont{},
+		images: map[any]string{},
+		alphas: map[uint8]string{},
+	}
+
+	var kids []string
+	for _, slice := range l.paginate(contentHeight) {
+		var cs bytes.Buffer
+		p.out = &cs
+		// Map layout pixels onto the page: origin top-left, y growing down.
+		fmt.Fprintf(&cs, "q %s 0 0 %s 0 %s cm\n", pdfNum(scale), pdfNum(-scale), pdfNum(page.Height))
+		bg := l.Background
+		if bg == nil {
+			bg = color.White
+		}
+		p.fillRect(image.Rect(0, 0, l.Width, pageHeight), bg)
+		fmt.Fprintf(&cs, "q 0 %d %d %d re W n\n", top, l.Width, slice.bottom-slice.top)
+		fmt.Fprintf(&cs, "1 0 0 1 0 %d cm\n", top-slice.top)
+		area := image.Rect(0, slice.top, l.Width, slice.bottom)
+		if err := p.paint(l, area); err != nil {
+			return err
+		}
+		cs.WriteString("Q Q\n")
+
+		contentID := doc.add(pdfStream("", cs.Bytes()))
+		pageID := doc.add([]byte(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R >>",
+			pagesID, pdfNum(page.Width), pdfNum(page.Height), resourcesID, contentID)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+
+	var res strings.Builder
+	res.WriteString("<< /ProcSet [/PDF /Text /ImageC]")
+	if len(p.fontOrder) > 0 {
+		res.WriteString(" /Font <<")
+		for _, f := range p.fontOrder {
+			id, err := f.write(doc)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&res, " /%s %d 0 R", f.name, id)
+		}
+		res.WriteString(" >>")
+	}
+	if len(p.imageRefs) > 0 {
+		res.WriteString(" /XObject <<" + strings.Join(p.imageRefs, "") + " >>")
+	}
+	if len(p.alphas) > 0 {
+		res.WriteString(" /ExtGState <<")
+		alphas := make([]int, 0, len(p.alphas))
+		for a := range p.alphas {
+			alphas = append(alphas, int(a))
+		}
+		sort.Ints(alphas)
+		for _, a := range alphas {
+			fmt.Fprintf(&res, " /%s << /ca %s /CA %s >>", p.alphas[uint8(a)], pdfNum(float64(a)/255), pdfNum(float64(a)/255))
+		}
+		res.WriteString(" >>")
+	}
+	res.WriteString(" >>")
+	doc.set(resourcesID, []byte(res.String()))
+	doc.set(pagesID, []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))))
+	doc.set(catalogID, []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID)))
+	return doc.writeTo(w, catalogID)
+}
+
+type pdfPainter struct {
+	doc       *pdfDoc
+	out       *bytes.Buffer
+	fonts     map[*FontAndFace]*pdfFont
+	fontOrder []*pdfFont
+	images    map[any]string // XObject names by image, or by box for images that cannot be map keys
+	imageRefs []string
+	alphas    map[uint8]string
+}
+
+func (p *pdfPainter) paint(l *Layout, area image.Rectangle) error {
+	var err error
+	l.Walk(func(b *Box) bool {
+		if err != nil {
+			return false
+		}
+		visible := b.Rect.Inset(-8).Overlaps(area)
+		switch b.Kind {
+		case BlockBox, RuleBox:
+			if b.Fill != nil && visible {
+				p.fillRect(b.Rect, b.Fill)
+			}
+		case ImageBox:
+			if b.Image != nil && visible {
+				p.image(b)
+			}
+		case GlyphRunBox:
+			if visible {
+				err = p.text(b)
+			}
+		case PathBox:
+			if b.Fill != nil && visible {
+				p.fillPath(b.Path, b.Fill)
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// setFill selects c as the fill color, returning the operator that restores
+// the graphics state when c is translucent.
+func (p *pdfPainter) setFill(c color.Color) (restore string) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A != 0xFF {
+		name, ok := p.alphas[n.A]
+		if !ok {
+			name = fmt.Sprintf("GS%d", len(p.alphas))
+			p.alphas[n.A] = name
+		}
+		fmt.Fprintf(p.out, "q /%s gs ", name)
+		restore = "Q\n"
+	}
+	fmt.Fprintf(p.out, "%s %s %s rg\n", pdfNum(float64(n.R)/255), pdfNum(float64(n.G)/255), pdfNum(float64(n.B)/255))
+	return restore
+}
+
+func (p *pdfPainter) fillRect(r image.Rectangle, c color.Color) {
+	if r.Empty() {
+		return
+	}
+	restore := p.setFill(c)
+	fmt.Fprintf(p.out, "%d %d %d %d re f\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	p.out.WriteString(restore)
+}
+
+func (p *pdfPainter) fillPath(path Path, c color.Color) {
+	restore := p.setFill(c)
+	for _, poly := range path {
+		for i, pt := range poly {
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(p.out, "%s %s %s ", pdfNum(pt.X), pdfNum(pt.Y), op)
+		}
+		p.out.WriteString("h ")
+	}
+	p.out.WriteString("f\n")
+	p.out.WriteString(restore)
+}
+
+func (p *pdfPainter) text(b *Box) error {
+	run := b.Run
+	if run == nil || run.Text == "" || run.Font == nil {
+		return nil
+	}
+	f, ok := p.fonts[run.Font]
+	if !ok {
+		if len(run.Font.ttf) == 0 {
+			return errors.New("md2png: PDF output needs fonts loaded from font files")
+		}
+		f = &pdfFont{
+			name:   fmt.Sprintf("F%d", len(p.fontOrder)),
+			src:    run.Font,
+			glyphs: map[truetype.Index]rune{},
+		}
+		p.fonts[run.Font] = f
+		p.fontOrder = append(p.fontOrder, f)
+	}
+	restore := p.setFill(run.Color)
+	// Text space is flipped back upright inside the y-down page space.
+	fmt.Fprintf(p.out, "BT /%s %s Tf 1 0 0 -1 %d %d Tm <%s> Tj ET\n",
+		f.name, pdfNum(run.Size*96/72), b.Rect.Min.X, run.Baseline, f.encode(run.Text))
+	p.out.WriteString(restore)
+	for _, bar := range run.decorations(b.Rect) {
+		p.fillRect(bar, run.Color)
+	}
+	return nil
+}
+
+// image draws an image box. Boxes showing the same image, such as a badge
+// used several times, share one embedded copy.
+func (p *pdfPainter) image(b *Box) {
+	var key any = b
+	if reflect.TypeOf(b.Image).Comparable() {
+		key = b.Image
+	}
+	name, ok := p.images[key]
+	if !ok {
+		name = fmt.Sprintf("Im%d", len(p.images))
+		p.images[key] = name
+		id := p.doc.addImage(b.Image)
+		p.imageRefs = append(p.imageRefs, fmt.Sprintf(" /%s %d 0 R", name, id))
+	}
+	r := b.Rect
+	fmt.Fprintf(p.out, "q %d 0 0 %d %d %d cm /%s Do Q\n", r.Dx(), -r.Dy(), r.Min.X, r.Max.Y, name)
+}
+
+// pdfFont embeds a TrueType font as a CID-keyed font addressed by glyph index.
+type pdfFont struct {
+	name   string
+	src    *FontAndFace
+	glyphs map[truetype.Index]rune
+}
+
+func (f *pdfFont) encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		idx := f.src.Font.Index(r)
+		if _, ok := f.glyphs[idx]; !ok {
+			f.glyphs[idx] = r
+		}
+		fmt.Fprintf(&b, "%04X", uint16(idx))
+	}
+	return b.String()
+}
+
+func (f *pdfFont) write(doc *pdfDoc) (int, error) {
+	ft := f.src.Font
+	base := pdfName(ft.Name(truetype.NameIDPostscriptName))
+	if base == "" {
+		base = "MD2PNG" + f.name
+	}
+	gids := make([]int, 0, len(f.glyphs))
+	for g := range f.glyphs {
+		gids = append(gids, int(g))
+	}
+	sort.Ints(gids)
+
+	var widths strings.Builder
+	for _, g := range gids {
+		adv := ft.HMetric(1000, truetype.Index(g)).AdvanceWidth
+		fmt.Fprintf(&widths, "%d [%d] ", g, int(adv))
+	}
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", g)
+			for _, u := range utf16.Encode([]rune{f.glyphs[truetype.Index(g)]}) {
+				fmt.Fprintf(&cmap, "%04X", u)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	bounds := ft.Bounds(1000)
+	fileID := doc.add(pdfStream(fmt.Sprintf("/Length1 %d", len(f.src.ttf)), f.src.ttf))
+	descID := doc.add([]byte(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		base, int(bounds.Min.X), int(bounds.Min.Y), int(bounds.Max.X), int(bounds.Max.Y), int(bounds.Max.Y), int(bounds.Min.Y), int(bounds.Max.Y), fileID)))
+	cidID := doc.add([]byte(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		base, descID, strings.TrimSpace(widths.String()))))
+	toUnicodeID := doc.add(pdfStream("", []byte(cmap.String())))
+	return doc.add([]byte(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		base, cidID, toUnicodeID))), nil
+}
+
+// pdfDoc collects numbered objects and serialises them with a cross-reference
+// table. Object numbers start at 1.
+type pdfDoc struct {
+	objs [][]byte
+}
+
+func (d *pdfDoc) reserve() int {
+	d.objs = append(d.objs, nil)
+	return len(d.objs)
+}
+
+func (d *pdfDoc) set(id int, body []byte) {
+	d.objs[id-1] = body
+}
+
+func (d *pdfDoc) add(body []byte) int {
+	id := d.reserve()
+	d.set(id, body)
+	return id
+}
+
+// addImage embeds img as an RGB image XObject, with a soft mask when it has
+// any transparency.
+func (d *pdfDoc) addImage(img image.Image) int {
+	b := img.Bounds()
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			n := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, n.R, n.G, n.B)
+			alpha = append(alpha, n.A)
+			if n.A != 0xFF {
+				opaque = false
+			}
+		}
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8", b.Dx(), b.Dy())
+	if !opaque {
+		maskID := d.add(pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8", b.Dx(), b.Dy()), alpha))
+		dict += fmt.Sprintf(" /SMask %d 0 R", maskID)
+	}
+	return d.add(pdfStream(dict, rgb))
+}
+
+func (d *pdfDoc) writeTo(w io.Writer, rootID int) error {
+	bw := bufio.NewWriter(w)
+	offset := 0
+	write := func(s string) {
+		n, _ := bw.WriteString(s)
+		offset += n
+	}
+	write("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objs))
+	for i, body := range d.objs {
+		offsets[i] = offset
+		write(fmt.Sprintf("%d 0 obj\n", i+1))
+		write(string(body))
+		write("\nendobj\n")
+	}
+	xref := offset
+	write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(d.objs)+1))
+	for _, off := range offsets {
+		write(fmt.Sprintf("%010d 00000 n \n", off))
+	}
+	write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objs)+1, rootID, xref))
+	return bw.Flush()
+}
+
+// pdfStream builds a Flate-compressed stream object with extra dictionary
+// entries.
+func pdfStream(dict string, data []byte) []byte {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	var b bytes.Buffer
+	b.WriteString("<< ")
+	if dict != "" {
+		b.WriteString(dict + " ")
+	}
+	fmt.Fprintf(&b, "/Filter /FlateDecode /Length %d >>\nstream\n", z.Len())
+	b.Write(z.Bytes())
+	b.WriteString("\nendstream")
+	return b.Bytes()
+}
+
+func pdfNum(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-" || s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdfName keeps only the characters that are safe in a PDF name unescaped.
+func pdfName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x7F && r > 0x20 && !strings.ContainsRune("()<>[]{}/%#", r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package md2png
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRenderPDFPaginates(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("# Long document\n\n")
+	for i := 0; i < 120; i++ {
+		fmt.Fprintf(&b, "Paragraph %d with enough text to take up a line or two on the page.\n\n", i)
+	}
+	var out bytes.Buffer
+	if err := RenderPDF(&out, []byte(b.String()), RenderOptions{}, PDFOptions{PageSize: PageLetter}); err != nil {
+		t.Fatalf("render pdf failed: %v", err)
+	}
+	pdf := out.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.7")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("expected PDF header and trailer")
+	}
+	count := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(pdf)
+	if count == nil {
+		t.Fatalf("expected a page tree")
+	}
+	if n, _ := strconv.Atoi(string(count[1])); n < 2 {
+		t.Fatalf("expected the document to span several pages, got %d", n)
+	}
+	if !bytes.Contains(pdf, []byte("/MediaBox [0 0 612 792]")) {
+		t.Fatalf("expected letter-sized pages")
+	}
+	if !bytes.Contains(pdf, []byte("/FontFile2")) || !bytes.Contains(pdf, []byte("/ToUnicode")) {
+		t.Fatalf("expected embedded fonts with a ToUnicode map")
+	}
+
+	// Every xref entry must point at the start of its object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatalf("expected startxref")
+	}
+	off, _ := strconv.Atoi(string(startxref[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[off:], -1)
+	if len(entries) == 0 {
+		t.Fatalf("expected xref entries")
+	}
+	for i, e := range entries {
+		pos, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(pdf[pos:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, pdf[pos:pos+12])
+		}
+	}
+}
+
+func TestRenderPDFSharesRepeatedImages(t *testing.T) {
+	dir := t.TempDir()
+	writeTestImage(t, dir, "badge.png", 90, 20)
+	markdown := []byte("![a](badge.png) ![b](badge.png)\n\n![c](badge.png)\n")
+	var out bytes.Buffer
+	if err := RenderPDF(&out, markdown, RenderOptions{BaseDir: dir}, PDFOptions{PageSize: PageLetter}); err != nil {
+		t.Fatalf("render pdf failed: %v", err)
+	}
+	if n := bytes.Count(out.Bytes(), []byte("/ColorSpace /DeviceRGB")); n != 1 {
+		t.Fatalf("expected the badge embedded once, got %d copies", n)
+	}
+	if !regexp.MustCompile(`/XObject << /Im0 \d+ 0 R >>`).Match(out.Bytes()) {
+		t.Fatalf("expected one image resource shared by every use")
+	}
+}
@@ -0,0 +1,108 @@
+package md2png
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/golang/freetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/vector"
+)
+
+// ---- Raster backend ----
+
+// PaintRaster paints a layout onto a new RGBA image covering the whole
+// document.
+func PaintRaster(l *Layout) *image.RGBA {
+	return paintRaster(l, image.Rect(0, 0, l.Width, l.Height))
+}
+
+// paintRaster paints the part of the layout that falls inside area. The
+// returned image's origin corresponds to area.Min.
+func paintRaster(l *Layout, area image.Rectangle) *image.RGBA {
+	img := newBackground(area.Dx(), area.Dy(), l.Background)
+
+	dc := freetype.NewContext()
+	dc.SetDPI(96)
+	dc.SetDst(img)
+	dc.SetClip(img.Bounds())
+	// Hint like the faces text is measured with, so runs fill their boxes.
+	dc.SetHinting(font.HintingFull)
+
+	off := area.Min
+	l.Walk(func(b *Box) bool {
+		// Glyphs may overhang their measured box slightly; leave some slack.
+		visible := b.Rect.Inset(-8).Overlaps(area)
+		switch b.Kind {
+		case BlockBox, RuleBox:
+			if b.Fill != nil && visible {
+				draw.Draw(img, b.Rect.Sub(off), image.NewUniform(b.Fill), image.Point{}, draw.Over)
+			}
+		case ImageBox:
+			if b.Image != nil && visible {
+				scaled := scaleImage(b.Image, b.Rect.Dx(), b.Rect.Dy())
+				draw.Draw(img, b.Rect.Sub(off), scaled, scaled.Bounds().Min, draw.Over)
+			}
+		case GlyphRunBox:
+			if visible {
+				paintGlyphRun(dc, img, b, off)
+			}
+		case PathBox:
+			if b.Fill != nil && visible {
+				paintPath(img, b, off)
+			}
+		}
+		return true
+	})
+	return img
+}
+
+// newBackground returns a width x height image filled with bg, or white when
+// bg is nil.
+func newBackground(width, height int, bg color.Color) *image.RGBA {
+	if bg == nil {
+		bg = color.White
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	return img
+}
+
+func paintGlyphRun(dc *freetype.Context, img *image.RGBA, b *Box, off image.Point) {
+	run := b.Run
+	if run == nil || run.Font == nil {
+		return
+	}
+	dc.SetFontSize(run.Size)
+	dc.SetSrc(image.NewUniform(run.Color))
+	dc.SetFont(run.Font.Font)
+	x := b.Rect.Min.X - off.X
+	baseline := run.Baseline - off.Y
+	_, _ = dc.DrawString(run.Text, freetype.Pt(x, baseline))
+	for _, bar := range run.decorations(b.Rect) {
+		draw.Draw(img, bar.Sub(off), image.NewUniform(run.Color), image.Point{}, draw.Over)
+	}
+}
+
+// paintPath fills a path box with anti-aliasing.
+func paintPath(img *image.RGBA, b *Box, off image.Point) {
+	r := b.Rect
+	if r.Empty() {
+		return
+	}
+	z := vector.NewRasterizer(r.Dx(), r.Dy())
+	for _, poly := range b.Path {
+		if len(poly) < 3 {
+			continue
+		}
+		z.MoveTo(float32(poly[0].X)-float32(r.Min.X), float32(poly[0].Y)-float32(r.Min.Y))
+		for _, pt := range poly[1:] {
+			z.LineTo(float32(pt.X)-float32(r.Min.X), float32(pt.Y)-float32(r.Min.Y))
+		}
+		z.ClosePath()
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, r.Dx(), r.Dy()))
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	draw.DrawMask(img, r.Sub(off), image.NewUniform(b.Fill), image.Point{}, mask, image.Point{}, draw.Over)
+}
@@ -0,0 +1,153 @@
+package md2png
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/yuin/goldmark/ast"
+	xdraw "golang.org/x/image/draw"
+)
+
+// ---- Slide decks ----
+
+// SlideSplit selects what starts a new slide.
+type SlideSplit int
+
+const (
+	// SplitBreaksAndHeadings starts a slide at every thematic break (---)
+	// and at every top-level H1 or H2.
+	SplitBreaksAndHeadings SlideSplit = iota
+	// SplitBreaks starts a slide only at thematic breaks.
+	SplitBreaks
+)
+
+// SlideOptions configure slide deck rendering. Zero values give 1920x1080
+// frames with text at twice the base font size, split on breaks and headings.
+type SlideOptions struct {
+	Width  int
+	Height int
+	Scale  float64 // multiplier applied to RenderOptions.BaseFontSize
+	Split  SlideSplit
+}
+
+func (s SlideOptions) withDefaults() SlideOptions {
+	if s.Width <= 0 {
+		s.Width = 1920
+	}
+	if s.Height <= 0 {
+		s.Height = 1080
+	}
+	if s.Scale <= 0 {
+		s.Scale = 2
+	}
+	return s
+}
+
+// RenderSlides renders the Markdown document as a deck of fixed-size frames,
+// one per slide. Each slide's content is vertically centered; content taller
+// than the frame is scaled down to fit. The frame size replaces opts.Width,
+// and opts.Margin defaults to 6% of the frame width.
+func RenderSlides(data []byte, opts RenderOptions, sopts SlideOptions) ([]*image.RGBA, error) {
+	sopts = sopts.withDefaults()
+	if opts.BaseFontSize <= 0 {
+		opts.BaseFontSize = 16
+	}
+	opts.BaseFontSize *= sopts.Scale
+	opts.Width = sopts.Width
+	if opts.TableOverflow == TableOverflowWiden {
+		// Every frame is the same size, so shrink what cannot widen.
+		opts.TableOverflow = TableOverflowShrink
+	}
+	if opts.Margin <= 0 {
+		opts.Margin = sopts.Width * 6 / 100
+	}
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := parseMarkdown(data)
+	// Footnotes are listed on the slides that reference them, so take the
+	// definitions out before splitting.
+	notes := footnoteDefinitions(doc)
+	var frames []*image.RGBA
+	for _, slide := range splitSlides(doc, sopts.Split) {
+		r := newRenderer(opts)
+		r.noteDefs = notes
+		if err := r.renderDocument(slide, data); err != nil {
+			return nil, err
+		}
+		frames = append(frames, paintSlide(r.c.layout(), sopts.Height))
+	}
+	return frames, nil
+}
+
+// splitSlides moves the top-level blocks of doc into one document per slide.
+// Thematic breaks only separate slides and are dropped; empty slides are
+// skipped.
+func splitSlides(doc ast.Node, split SlideSplit) []*ast.Document {
+	var slides []*ast.Document
+	current := ast.NewDocument()
+	flush := func() {
+		if current.HasChildren() {
+			slides = append(slides, current)
+		}
+		current = ast.NewDocument()
+	}
+	for child := doc.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		switch n := child.(type) {
+		case *ast.ThematicBreak:
+			flush()
+			child = next
+			continue
+		case *ast.Heading:
+			if split == SplitBreaksAndHeadings && n.Level <= 2 {
+				flush()
+			}
+		}
+		doc.RemoveChild(doc, child)
+		current.AppendChild(current, child)
+		child = next
+	}
+	flush()
+	return slides
+}
+
+// paintSlide paints a slide layout centered in a frame of the given height.
+func paintSlide(l *Layout, height int) *image.RGBA {
+	frame := newBackground(l.Width, height, l.Background)
+	content := contentBounds(l)
+	if content.Empty() {
+		return frame
+	}
+	band := paintRaster(l, image.Rect(0, content.Min.Y, l.Width, content.Max.Y))
+	room := height - 2*l.Margin
+	if room <= 0 {
+		room = height
+	}
+	if band.Bounds().Dy() <= room {
+		top := (height - band.Bounds().Dy()) / 2
+		draw.Draw(frame, band.Bounds().Add(image.Pt(0, top)), band, image.Point{}, draw.Src)
+		return frame
+	}
+	// Too tall: shrink the whole band to fit, keeping it centered.
+	scale := float64(room) / float64(band.Bounds().Dy())
+	w := int(float64(l.Width) * scale)
+	dst := image.Rect(0, 0, w, room).Add(image.Pt((l.Width-w)/2, (height-room)/2))
+	xdraw.CatmullRom.Scale(frame, dst, band, band.Bounds(), xdraw.Src, nil)
+	return frame
+}
+
+// contentBounds returns the union of every box drawn in the layout,
+// excluding the document root.
+func contentBounds(l *Layout) image.Rectangle {
+	var r image.Rectangle
+	l.Walk(func(b *Box) bool {
+		if b != l.Root && !b.Rect.Empty() {
+			r = r.Union(b.Rect)
+		}
+		return true
+	})
+	return r
+}
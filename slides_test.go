@@ -0,0 +1,62 @@
+package md2png
+
+import (
+	"image"
+	"testing"
+)
+
+func TestRenderSlidesSplitsAndCenters(t *testing.T) {
+	markdown := "# Title\n\nIntro\n\n## Second\n\n- point\n\n---\n\nAfter a break\n\n### Still the same slide\n"
+	frames, err := RenderSlides([]byte(markdown), RenderOptions{}, SlideOptions{Width: 640, Height: 360})
+	if err != nil {
+		t.Fatalf("render slides failed: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 slides, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		if frame.Bounds() != image.Rect(0, 0, 640, 360) {
+			t.Fatalf("slide %d has bounds %v", i, frame.Bounds())
+		}
+	}
+
+	// Content should sit in the middle of the frame.
+	top, bottom := -1, -1
+	frame := frames[2]
+	for y := 0; y < 360; y++ {
+		for x := 0; x < 640; x++ {
+			if r, _, _, _ := frame.At(x, y).RGBA(); r>>8 != 0xFF {
+				if top < 0 {
+					top = y
+				}
+				bottom = y
+				break
+			}
+		}
+	}
+	if top < 0 {
+		t.Fatalf("expected content on the slide")
+	}
+	if diff := top - (359 - bottom); diff > 40 || diff < -40 {
+		t.Fatalf("expected vertically centered content, got top gap %d and bottom gap %d", top, 359-bottom)
+	}
+
+	breaksOnly, err := RenderSlides([]byte(markdown), RenderOptions{}, SlideOptions{Width: 640, Height: 360, Split: SplitBreaks})
+	if err != nil {
+		t.Fatalf("render slides failed: %v", err)
+	}
+	if len(breaksOnly) != 2 {
+		t.Fatalf("expected 2 slides when splitting on breaks only, got %d", len(breaksOnly))
+	}
+}
+
+func TestRenderSlidesScalesOverflowingContent(t *testing.T) {
+	markdown := "# Tall\n\n" + "Line\n\n" + "Line\n\n" + "Line\n\n" + "Line\n\n" + "Line\n\n" + "Line\n\n"
+	frames, err := RenderSlides([]byte(markdown), RenderOptions{}, SlideOptions{Width: 400, Height: 200})
+	if err != nil {
+		t.Fatalf("render slides failed: %v", err)
+	}
+	if len(frames) != 1 || frames[0].Bounds().Dy() != 200 {
+		t.Fatalf("expected one 200px frame, got %d frames", len(frames))
+	}
+}
@@ -0,0 +1,206 @@
+package md2png
+
+// ---- Style sheet ----
+
+// FontRole selects one of the faces in a Fonts set.
+type FontRole int
+
+const (
+	FontRegular FontRole = iota
+	FontBold
+	FontMono
+	FontItalic
+	FontBoldItalic
+)
+
+// byRole returns the face for role, falling back to Regular.
+func (f Fonts) byRole(role FontRole) *FontAndFace {
+	switch role {
+	case FontBold:
+		if f.Bold != nil {
+			return f.Bold
+		}
+	case FontMono:
+		if f.Mono != nil {
+			return f.Mono
+		}
+	case FontItalic:
+		if f.Italic != nil {
+			return f.Italic
+		}
+	case FontBoldItalic:
+		if f.BoldItalic != nil {
+			return f.BoldItalic
+		}
+	}
+	return f.Regular
+}
+
+// StyleSheet sets the typographic rhythm of a render. Sizes and spacings are
+// multiples of the base font size (ems) unless marked as pixels, so they
+// scale with RenderOptions.BaseFontSize. A zero value takes the default from
+// DefaultStyleSheet; use a negative spacing for none.
+type StyleSheet struct {
+	Headings   [6]HeadingStyle // H1 through H6
+	Paragraph  ParagraphStyle
+	List       ListStyle
+	Table      TableStyle
+	Code       CodeStyle
+	Blockquote BlockquoteStyle
+	Definition DefinitionStyle
+	Footnotes  FootnoteStyle
+	Warning    WarningStyle
+	Alert      AlertStyle
+}
+
+// HeadingStyle styles one heading level.
+type HeadingStyle struct {
+	Scale       float64 // font size relative to the base size
+	Font        FontRole
+	SpaceBefore float64
+	SpaceAfter  float64
+}
+
+// ParagraphStyle styles body paragraphs.
+type ParagraphStyle struct {
+	SpaceAfter float64
+}
+
+// ListStyle styles ordered and unordered lists. Each nesting level is
+// indented by Indent; markers are right-aligned in a MarkerWidth column,
+// MarkerGap before the item text.
+type ListStyle struct {
+	Indent       float64
+	MarkerWidth  float64
+	MarkerGap    float64
+	MarkerSize   float64 // marker font size relative to the base size
+	ItemSpacing  float64
+	BlockSpacing float64 // between the blocks of one item or description
+	NestedGap    float64 // above a list nested in an item
+	SpaceAfter   float64
+}
+
+// TableStyle styles tables.
+type TableStyle struct {
+	CellPadding    float64
+	MinColumnWidth int // pixels
+	SpaceBefore    float64
+	SpaceAfter     float64
+}
+
+// CodeStyle styles code blocks.
+type CodeStyle struct {
+	Size        float64 // font size relative to the base size
+	Padding     float64
+	LineHeight  float64 // line height relative to the code font size
+	SpaceBefore float64
+	SpaceAfter  float64
+}
+
+// BlockquoteStyle styles block quotes, and the bar and padding of alerts.
+type BlockquoteStyle struct {
+	Indent        float64 // text inset from the quote bar's left edge
+	BarWidth      int     // pixels
+	PaddingTop    float64 // above the first block, where the bar starts
+	PaddingBottom float64 // below the last block, where the bar ends
+}
+
+// DefinitionStyle styles definition lists. Terms and descriptions are
+// indented as list levels, and description blocks spaced as list items'.
+type DefinitionStyle struct {
+	Gap float64 // between a term and its description
+}
+
+// FootnoteStyle styles the footnote list at the end of the document.
+type FootnoteStyle struct {
+	SpaceBefore float64
+}
+
+// AlertStyle styles alerts, which are otherwise padded and indented as
+// block quotes.
+type AlertStyle struct {
+	TitleGap float64 // between the title line and the body
+}
+
+// WarningStyle styles the warnings drawn in place of unsupported content.
+type WarningStyle struct {
+	SpaceAfter float64
+}
+
+// DefaultStyleSheet holds the spacing used when a StyleSheet field is zero.
+var DefaultStyleSheet = StyleSheet{
+	Headings: [6]HeadingStyle{
+		{Scale: 1.9, SpaceBefore: 0.75, SpaceAfter: 0.5},
+		{Scale: 1.6, SpaceBefore: 0.75, SpaceAfter: 0.5},
+		{Scale: 1.4, SpaceBefore: 0.75, SpaceAfter: 0.5},
+		{Scale: 1.25, SpaceBefore: 0.75, SpaceAfter: 0.5},
+		{Scale: 1.15, SpaceBefore: 0.75, SpaceAfter: 0.5},
+		{Scale: 1.15, SpaceBefore: 0.75, SpaceAfter: 0.5},
+	},
+	Paragraph:  ParagraphStyle{SpaceAfter: 0.9},
+	List:       ListStyle{Indent: 2, MarkerWidth: 1.75, MarkerGap: 0.5, MarkerSize: 1, ItemSpacing: 0.6, BlockSpacing: 0.5, NestedGap: 0.3, SpaceAfter: 0.7},
+	Table:      TableStyle{CellPadding: 0.6, MinColumnWidth: 60, SpaceBefore: 0.3, SpaceAfter: 0.7},
+	Code:       CodeStyle{Size: 0.95, Padding: 0.625, LineHeight: 1.4, SpaceBefore: 0.25, SpaceAfter: 0.375},
+	Blockquote: BlockquoteStyle{Indent: 0.625, BarWidth: 4, PaddingTop: 0.125, PaddingBottom: 0.375},
+	Definition: DefinitionStyle{Gap: 0.2},
+	Footnotes:  FootnoteStyle{SpaceBefore: 0.4},
+	Warning:    WarningStyle{SpaceAfter: 0.6},
+	Alert:      AlertStyle{TitleGap: 0.3},
+}
+
+// withDefaults fills zero fields from DefaultStyleSheet.
+func (s StyleSheet) withDefaults() StyleSheet {
+	d := DefaultStyleSheet
+	for i := range s.Headings {
+		h, dh := &s.Headings[i], d.Headings[i]
+		orFloat(&h.Scale, dh.Scale)
+		orFloat(&h.SpaceBefore, dh.SpaceBefore)
+		orFloat(&h.SpaceAfter, dh.SpaceAfter)
+	}
+	orFloat(&s.Paragraph.SpaceAfter, d.Paragraph.SpaceAfter)
+	orFloat(&s.List.Indent, d.List.Indent)
+	orFloat(&s.List.MarkerWidth, d.List.MarkerWidth)
+	orFloat(&s.List.MarkerGap, d.List.MarkerGap)
+	orFloat(&s.List.MarkerSize, d.List.MarkerSize)
+	orFloat(&s.List.ItemSpacing, d.List.ItemSpacing)
+	orFloat(&s.List.BlockSpacing, d.List.BlockSpacing)
+	orFloat(&s.List.NestedGap, d.List.NestedGap)
+	orFloat(&s.List.SpaceAfter, d.List.SpaceAfter)
+	orFloat(&s.Table.CellPadding, d.Table.CellPadding)
+	if s.Table.MinColumnWidth == 0 {
+		s.Table.MinColumnWidth = d.Table.MinColumnWidth
+	}
+	orFloat(&s.Table.SpaceBefore, d.Table.SpaceBefore)
+	orFloat(&s.Table.SpaceAfter, d.Table.SpaceAfter)
+	orFloat(&s.Code.Size, d.Code.Size)
+	orFloat(&s.Code.Padding, d.Code.Padding)
+	orFloat(&s.Code.LineHeight, d.Code.LineHeight)
+	orFloat(&s.Code.SpaceBefore, d.Code.SpaceBefore)
+	orFloat(&s.Code.SpaceAfter, d.Code.SpaceAfter)
+	orFloat(&s.Blockquote.Indent, d.Blockquote.Indent)
+	if s.Blockquote.BarWidth == 0 {
+		s.Blockquote.BarWidth = d.Blockquote.BarWidth
+	}
+	orFloat(&s.Blockquote.PaddingTop, d.Blockquote.PaddingTop)
+	orFloat(&s.Blockquote.PaddingBottom, d.Blockquote.PaddingBottom)
+	orFloat(&s.Definition.Gap, d.Definition.Gap)
+	orFloat(&s.Footnotes.SpaceBefore, d.Footnotes.SpaceBefore)
+	orFloat(&s.Warning.SpaceAfter, d.Warning.SpaceAfter)
+	orFloat(&s.Alert.TitleGap, d.Alert.TitleGap)
+	return s
+}
+
+func orFloat(v *float64, def float64) {
+	if *v == 0 {
+		*v = def
+	}
+}
+
+// em converts a style sheet length to pixels at the canvas's base size.
+// Negative lengths mean none.
+func (c *canvas) em(v float64) int {
+	if v <= 0 {
+		return 0
+	}
+	return int(c.ptSize * v)
+}
@@ -0,0 +1,105 @@
+package md2png
+
+import "testing"
+
+func TestStyleSheetDefaults(t *testing.T) {
+	if got := (StyleSheet{}).withDefaults(); got != DefaultStyleSheet {
+		t.Fatalf("expected an empty style sheet to take every default, got %+v", got)
+	}
+	s := StyleSheet{Paragraph: ParagraphStyle{SpaceAfter: -1}}
+	s.Headings[2].Scale = 3
+	s = s.withDefaults()
+	if s.Headings[2].Scale != 3 || s.Headings[2].SpaceAfter != DefaultStyleSheet.Headings[2].SpaceAfter {
+		t.Fatalf("expected set fields to be kept and the rest defaulted, got %+v", s.Headings[2])
+	}
+	c := newCanvas(640, 48, Theme{Style: s}, Fonts{}, 16)
+	if got := c.em(s.Paragraph.SpaceAfter); got != 0 {
+		t.Fatalf("expected negative spacing to mean none, got %d", got)
+	}
+}
+
+func TestStyleSheetOverridesLayout(t *testing.T) {
+	markdown := "# Title\n\n- item\n"
+	find := func(style StyleSheet) (heading, item *Box) {
+		th := LightTheme
+		th.Style = style
+		l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640, Theme: th})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		var role string
+		l.Walk(func(b *Box) bool {
+			if b.Kind == BlockBox {
+				role = b.Role
+			}
+			if b.Kind == GlyphRunBox && b.Run.Text != "•" {
+				switch {
+				case role == RoleHeading && heading == nil:
+					heading = b
+				case role == RoleListItem && item == nil:
+					item = b
+				}
+			}
+			return true
+		})
+		if heading == nil || item == nil {
+			t.Fatalf("expected heading and list item runs")
+		}
+		return heading, item
+	}
+
+	defHeading, defItem := find(StyleSheet{})
+	var custom StyleSheet
+	custom.Headings[0] = HeadingStyle{Scale: 2.5, Font: FontBold}
+	custom.List.Indent = 4
+	custom.List.MarkerWidth = 3
+	heading, item := find(custom)
+
+	if heading.Run.Size != 16*2.5 || defHeading.Run.Size != 16*1.9 {
+		t.Fatalf("expected heading sizes 40 and 30.4, got %v and %v", heading.Run.Size, defHeading.Run.Size)
+	}
+	if heading.Run.Font == defHeading.Run.Font {
+		t.Fatalf("expected the H1 font override to switch faces")
+	}
+	// Top-level lists are not indented, so only the marker width moves the text.
+	if want := defItem.Rect.Min.X + 16*(3-1.75); item.Rect.Min.X != want {
+		t.Fatalf("expected list text at x=%v, got %d", want, item.Rect.Min.X)
+	}
+}
+
+func TestStyleSheetSpacing(t *testing.T) {
+	markdown := "> quoted\n\n- first\n\n  second\n"
+	layout := func(style StyleSheet) (quote *Box, second int) {
+		th := LightTheme
+		th.Style = style
+		l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640, Theme: th})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		var first int
+		l.Walk(func(b *Box) bool {
+			switch {
+			case b.Kind == BlockBox && b.Role == RoleBlockquote:
+				quote = b
+			case b.Kind == GlyphRunBox && b.Run.Text == "first":
+				first = b.Run.Baseline
+			case b.Kind == GlyphRunBox && b.Run.Text == "second":
+				second = b.Run.Baseline - first
+			}
+			return true
+		})
+		return quote, second
+	}
+
+	defQuote, defGap := layout(StyleSheet{})
+	var custom StyleSheet
+	custom.Blockquote.PaddingBottom = 2
+	custom.List.BlockSpacing = 2
+	quote, gap := layout(custom)
+	if got, want := quote.Rect.Dy()-defQuote.Rect.Dy(), 32-6; got != want {
+		t.Fatalf("expected the quote %dpx taller, got %d", want, got)
+	}
+	if got, want := gap-defGap, 32-8; got != want {
+		t.Fatalf("expected the item's blocks %dpx further apart, got %d", want, got)
+	}
+}
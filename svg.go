@@ -0,0 +1,202 @@
+package md2png
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ---- SVG backend ----
+
+// RenderSVG lays out the Markdown document and writes it to w as SVG.
+func RenderSVG(w io.Writer, data []byte, opts RenderOptions) error {
+	l, err := LayoutDocument(data, opts)
+	if err != nil {
+		return err
+	}
+	return WriteSVG(w, l)
+}
+
+// WriteSVG paints a layout as an SVG document. Text stays selectable as
+// <text> elements using the layout's fonts, which are embedded as data URIs
+// when their font files are available; images are embedded as PNG data URIs.
+func WriteSVG(w io.Writer, l *Layout) error {
+	bw := bufio.NewWriter(w)
+	p := &svgPainter{w: bw, families: map[*FontAndFace]string{}}
+	p.collectFonts(l)
+
+	p.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" xml:space="preserve">`+"\n",
+		l.Width, l.Height, l.Width, l.Height)
+	if len(p.order) > 0 {
+		p.printf("<style>\n")
+		for _, f := range p.order {
+			p.printf("@font-face{font-family:%q;src:url(data:font/ttf;base64,%s) format(\"truetype\");}\n",
+				p.families[f], base64.StdEncoding.EncodeToString(f.ttf))
+		}
+		p.printf("</style>\n")
+	}
+	bg := l.Background
+	if bg == nil {
+		bg = color.White
+	}
+	p.rect(image.Rect(0, 0, l.Width, l.Height), bg)
+	if l.Root != nil {
+		if err := p.box(l.Root); err != nil {
+			return err
+		}
+	}
+	p.printf("</svg>\n")
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+type svgPainter struct {
+	w        *bufio.Writer
+	families map[*FontAndFace]string
+	order    []*FontAndFace
+	err      error
+}
+
+// printf writes formatted output, remembering the first write error.
+func (p *svgPainter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *svgPainter) collectFonts(l *Layout) {
+	l.Walk(func(b *Box) bool {
+		if b.Run == nil || b.Run.Font == nil {
+			return true
+		}
+		f := b.Run.Font
+		if _, ok := p.families[f]; ok {
+			return true
+		}
+		if len(f.ttf) == 0 {
+			p.families[f] = ""
+			return true
+		}
+		p.families[f] = fmt.Sprintf("md2png-%d", len(p.order))
+		p.order = append(p.order, f)
+		return true
+	})
+}
+
+func (p *svgPainter) box(b *Box) error {
+	switch b.Kind {
+	case BlockBox:
+		if b.Role != "" {
+			p.printf(`<g class="md2png-%s">`+"\n", b.Role)
+		} else {
+			p.printf("<g>\n")
+		}
+		if b.Fill != nil {
+			p.rect(b.Rect, b.Fill)
+		}
+		for _, child := range b.Children {
+			if err := p.box(child); err != nil {
+				return err
+			}
+		}
+		p.printf("</g>\n")
+	case LineBox:
+		for _, child := range b.Children {
+			if err := p.box(child); err != nil {
+				return err
+			}
+		}
+	case RuleBox:
+		if b.Fill != nil {
+			p.rect(b.Rect, b.Fill)
+		}
+	case GlyphRunBox:
+		p.text(b)
+	case ImageBox:
+		return p.image(b)
+	case PathBox:
+		if b.Fill != nil {
+			p.path(b.Path, b.Fill)
+		}
+	}
+	return nil
+}
+
+func (p *svgPainter) path(path Path, c color.Color) {
+	var d strings.Builder
+	for _, poly := range path {
+		for i, pt := range poly {
+			op := "L"
+			if i == 0 {
+				op = "M"
+			}
+			fmt.Fprintf(&d, "%s%s %s ", op, strconv.FormatFloat(pt.X, 'f', -1, 64), strconv.FormatFloat(pt.Y, 'f', -1, 64))
+		}
+		d.WriteString("Z ")
+	}
+	p.printf(`<path d="%s"%s/>`+"\n", strings.TrimSpace(d.String()), svgPaint("fill", c))
+}
+
+func (p *svgPainter) rect(r image.Rectangle, c color.Color) {
+	if r.Empty() {
+		return
+	}
+	p.printf(`<rect x="%d" y="%d" width="%d" height="%d"%s/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgPaint("fill", c))
+}
+
+func (p *svgPainter) text(b *Box) {
+	run := b.Run
+	if run == nil || run.Text == "" {
+		return
+	}
+	family := "sans-serif"
+	if name := p.families[run.Font]; name != "" {
+		family = name + ", sans-serif"
+	}
+	// Font sizes are in points at 96 DPI, as in the raster backend.
+	px := run.Size * 96 / 72
+	p.printf(`<text x="%d" y="%d" font-family="%s" font-size="%s"%s>`,
+		b.Rect.Min.X, run.Baseline, family, strconv.FormatFloat(px, 'f', 2, 64), svgPaint("fill", run.Color))
+	if p.err == nil {
+		p.err = xml.EscapeText(p.w, []byte(run.Text))
+	}
+	p.printf("</text>\n")
+	for _, bar := range run.decorations(b.Rect) {
+		p.rect(bar, run.Color)
+	}
+}
+
+func (p *svgPainter) image(b *Box) error {
+	if b.Image == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, b.Image); err != nil {
+		return err
+	}
+	p.printf(`<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" href="data:image/png;base64,%s"/>`+"\n",
+		b.Rect.Min.X, b.Rect.Min.Y, b.Rect.Dx(), b.Rect.Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return nil
+}
+
+// svgPaint formats c as a fill or stroke attribute, adding an opacity
+// attribute for translucent colors.
+func svgPaint(attr string, c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	s := fmt.Sprintf(` %s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	if n.A != 0xFF {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, strconv.FormatFloat(float64(n.A)/255, 'f', 3, 64))
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package md2png
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderSVG(t *testing.T) {
+	tmpDir := t.TempDir()
+	block := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(block, block.Bounds(), image.NewUniform(color.RGBA{R: 0xCC, A: 0xFF}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, block); err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "dot.png"), buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	markdown := fmt.Sprintf("# Hello & \"welcome\"\n\n```\ncode\n```\n\n> quoted\n\n---\n\n![dot](%s)\n", "dot.png")
+	var out bytes.Buffer
+	if err := RenderSVG(&out, []byte(markdown), RenderOptions{Width: 640, Margin: 16, BaseDir: tmpDir}); err != nil {
+		t.Fatalf("render svg failed: %v", err)
+	}
+	svg := out.String()
+
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("expected well-formed XML, got %v", err)
+		}
+	}
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="640"`,
+		"Hello &amp; &#34;welcome&#34;",
+		">code</text>",
+		`class="md2png-code"`,
+		"@font-face",
+		`href="data:image/png;base64,`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("expected SVG to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,1532 @@
+package md2png
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// ---- SVG images ----
+
+// SVG image sources are rasterized in Go, at the size layout draws them, so
+// they stay sharp at any scale. The subset understood covers what badges,
+// icons and simple diagrams use:
+//
+//   - path, rect (with rounded corners), circle, ellipse, line, polyline,
+//     polygon, text and tspan, g, use (of elements and symbols) and nested
+//     svg elements
+//   - fill, stroke, stroke-width, stroke-linecap, opacity, fill-opacity,
+//     stroke-opacity and font properties, as attributes or in style=""
+//   - transforms, viewBox and preserveAspectRatio
+//   - linear and radial gradients, and clip paths
+//
+// Fills use the nonzero rule, group opacity is applied to each shape in the
+// group, and text is drawn upright with the document's fonts. Filters, masks,
+// patterns, markers, dashes and CSS style sheets are ignored.
+
+// svgMaxSize caps each side of a rasterization, in pixels, whatever size a
+// document declares or is drawn at. Larger images are scaled up when drawn.
+const svgMaxSize = 4096
+
+// svgImage is a parsed SVG document. As an image.Image it has the document's
+// intrinsic size; drawnImage rasterizes it at the size it is drawn instead.
+type svgImage struct {
+	root          *svgNode
+	ids           map[string]*svgNode
+	width, height float64    // intrinsic size in pixels
+	viewBox       [4]float64 // min-x, min-y, width, height; zero size when absent
+	fonts         Fonts
+
+	once   sync.Once
+	raster *image.RGBA // at the intrinsic size, for At
+
+	mu    sync.Mutex
+	drawn map[image.Point]*image.RGBA // rasterizations by drawn size
+}
+
+// svgNode is an element of an SVG document, or a run of character data when
+// name is empty.
+type svgNode struct {
+	name     string
+	parent   *svgNode
+	attrs    map[string]string // attributes, overridden by style="" properties
+	children []*svgNode
+	text     string
+}
+
+// isSVG reports whether data looks like an SVG document rather than a
+// raster image.
+func isSVG(data []byte) bool {
+	head := data[:min(len(data), 4096)]
+	head = bytes.TrimPrefix(bytes.TrimSpace(head), []byte("\xEF\xBB\xBF"))
+	return len(head) > 0 && head[0] == '<' && bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
+
+// decodeImage decodes a raster image, or parses an SVG document to be
+// rasterized once its drawn size is known.
+func (r *renderer) decodeImage(rd io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if isSVG(data) {
+		return parseSVG(data, r.c.fonts)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// drawnImage returns img ready to be drawn width x height pixels big: SVG
+// images are rasterized at that size, others are returned as they are. An
+// SVG drawn several times at one size, such as a repeated badge, is
+// rasterized once and shared.
+func drawnImage(img image.Image, width, height int) image.Image {
+	s, ok := img.(*svgImage)
+	if !ok {
+		return img
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := image.Pt(width, height)
+	if s.drawn[size] == nil {
+		if s.drawn == nil {
+			s.drawn = map[image.Point]*image.RGBA{}
+		}
+		s.drawn[size] = s.rasterize(width, height)
+	}
+	return s.drawn[size]
+}
+
+// parseSVG parses an SVG document whose text is drawn with fonts.
+func parseSVG(data []byte, fonts Fonts) (*svgImage, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	s := &svgImage{ids: map[string]*svgNode{}, fonts: fonts}
+	var stack []*svgNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("md2png: svg: " + err.Error())
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &svgNode{name: t.Name.Local, attrs: map[string]string{}}
+			if len(stack) > 0 {
+				n.parent = stack[len(stack)-1]
+			}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+			}
+			for _, decl := range strings.Split(n.attrs["style"], ";") {
+				if k, v, ok := strings.Cut(decl, ":"); ok {
+					n.attrs[strings.TrimSpace(k)] = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "!important"))
+				}
+			}
+			if id := n.attrs["id"]; id != "" {
+				s.ids[id] = n
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if s.root == nil {
+				s.root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &svgNode{text: string(t)})
+			}
+		}
+	}
+	if s.root == nil || s.root.name != "svg" {
+		return nil, errors.New("md2png: svg: no <svg> element")
+	}
+
+	if vb := svgNumbers(s.root.attrs["viewBox"]); len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+		copy(s.viewBox[:], vb)
+	}
+	s.width, s.height = 300, 150 // the CSS default for replaced elements
+	if s.viewBox[2] > 0 {
+		s.width, s.height = s.viewBox[2], s.viewBox[3]
+	}
+	w, wok := svgAbsoluteLength(s.root.attrs["width"])
+	h, hok := svgAbsoluteLength(s.root.attrs["height"])
+	switch {
+	case wok && hok:
+		s.width, s.height = w, h
+	case wok:
+		s.width, s.height = w, s.height*w/s.width
+	case hok:
+		s.width, s.height = s.width*h/s.height, h
+	}
+	if scale := svgMaxSize / max(s.width, s.height); scale < 1 {
+		s.width, s.height = s.width*scale, s.height*scale
+	}
+	return s, nil
+}
+
+func (s *svgImage) ColorModel() color.Model { return color.RGBAModel }
+
+func (s *svgImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, max(int(math.Round(s.width)), 1), max(int(math.Round(s.height)), 1))
+}
+
+func (s *svgImage) At(x, y int) color.Color {
+	s.once.Do(func() {
+		b := s.Bounds()
+		s.raster = s.rasterize(b.Dx(), b.Dy())
+	})
+	return s.raster.At(x, y)
+}
+
+// rasterize draws the document onto a transparent width x height image.
+func (s *svgImage) rasterize(width, height int) *image.RGBA {
+	if scale := float64(svgMaxSize) / float64(max(width, height)); scale < 1 {
+		width, height = max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	r := &svgRenderer{img: s, dst: dst, vw: s.width, vh: s.height}
+	m := svgScale(float64(width)/s.width, float64(height)/s.height)
+	if s.viewBox[2] > 0 {
+		r.vw, r.vh = s.viewBox[2], s.viewBox[3]
+		m = viewBoxMatrix(s.viewBox, s.root.attrs["preserveAspectRatio"], float64(width), float64(height))
+	}
+	r.render(s.root, svgState{m: m, props: map[string]string{}, opacity: 1}, 0)
+	return dst
+}
+
+// viewBoxMatrix maps the view box onto a width x height viewport as
+// preserveAspectRatio asks.
+func viewBoxMatrix(vb [4]float64, preserve string, width, height float64) svgMatrix {
+	sx, sy := width/vb[2], height/vb[3]
+	fields := strings.Fields(preserve)
+	align := "xMidYMid"
+	if len(fields) > 0 {
+		align = fields[0]
+	}
+	if align == "none" {
+		return svgScale(sx, sy).mul(svgTranslate(-vb[0], -vb[1]))
+	}
+	scale := min(sx, sy)
+	if len(fields) > 1 && fields[1] == "slice" {
+		scale = max(sx, sy)
+	}
+	dx, dy := width-vb[2]*scale, height-vb[3]*scale
+	switch {
+	case strings.HasPrefix(align, "xMin"):
+		dx = 0
+	case strings.HasPrefix(align, "xMid"):
+		dx /= 2
+	}
+	switch {
+	case strings.HasSuffix(align, "YMin"):
+		dy = 0
+	case strings.HasSuffix(align, "YMid"):
+		dy /= 2
+	}
+	return svgTranslate(dx, dy).mul(svgScale(scale, scale)).mul(svgTranslate(-vb[0], -vb[1]))
+}
+
+// ---- SVG images: drawing ----
+
+// svgInherited lists the properties children inherit from their parents.
+var svgInherited = []string{
+	"fill", "fill-opacity", "stroke", "stroke-width", "stroke-opacity", "stroke-linecap",
+	"font-size", "font-weight", "font-style", "font-family", "text-anchor", "color", "visibility",
+}
+
+// svgState is what an element inherits from its ancestors.
+type svgState struct {
+	m       svgMatrix         // user space to device pixels
+	props   map[string]string // inherited properties
+	opacity float64
+	clip    *image.Alpha // nil when unclipped
+}
+
+// svgNodeBudget caps the elements one rasterization draws, so that <use>
+// elements repeating each other cannot multiply into billions of draws.
+const svgNodeBudget = 10000
+
+type svgRenderer struct {
+	img    *svgImage
+	dst    *image.RGBA
+	vw, vh float64 // viewport size in user units, for percentages
+	nodes  int     // elements rendered so far, up to svgNodeBudget
+}
+
+// enter returns the state of n's content: its transform, inherited
+// properties, opacity and clip path applied to the parent's state.
+func (r *svgRenderer) enter(n *svgNode, parent svgState) svgState {
+	st := parent
+	st.props = make(map[string]string, len(parent.props))
+	for k, v := range parent.props {
+		st.props[k] = v
+	}
+	for _, k := range svgInherited {
+		if v, ok := n.attrs[k]; ok && v != "inherit" {
+			st.props[k] = v
+		}
+	}
+	if v, ok := n.attrs["font-size"]; ok {
+		st.props["font-size"] = strconv.FormatFloat(svgFontSize(v, svgFontSize(parent.props["font-size"], 16)), 'f', -1, 64)
+	}
+	if t, ok := n.attrs["transform"]; ok {
+		st.m = st.m.mul(parseSVGTransform(t))
+	}
+	if v, err := strconv.ParseFloat(n.attrs["opacity"], 64); err == nil {
+		st.opacity *= math.Max(0, math.Min(v, 1))
+	}
+	if id := svgURL(n.attrs["clip-path"]); id != "" {
+		if cp := r.img.ids[id]; cp != nil && cp.name == "clipPath" {
+			st.clip = r.clipMask(cp, st)
+		}
+	}
+	return st
+}
+
+// render draws n and its children. depth and the node budget guard against
+// <use> cycles and blow-ups.
+func (r *svgRenderer) render(n *svgNode, parent svgState, depth int) {
+	if n.name == "" || depth > 32 || n.attrs["display"] == "none" || r.nodes >= svgNodeBudget {
+		return
+	}
+	r.nodes++
+	switch n.name {
+	case "svg", "g", "a", "switch":
+		st := r.enter(n, parent)
+		if n.name == "svg" && depth > 0 {
+			st.m = st.m.mul(svgTranslate(r.length(n.attrs["x"], r.vw), r.length(n.attrs["y"], r.vh)))
+		}
+		for _, child := range n.children {
+			r.render(child, st, depth+1)
+		}
+	case "use":
+		href := n.attrs["href"]
+		target := r.img.ids[strings.TrimPrefix(href, "#")]
+		if target == nil || !strings.HasPrefix(href, "#") {
+			return
+		}
+		for a := n; a != nil; a = a.parent {
+			if a == target {
+				return // the <use> would draw itself
+			}
+		}
+		st := r.enter(n, parent)
+		st.m = st.m.mul(svgTranslate(r.length(n.attrs["x"], r.vw), r.length(n.attrs["y"], r.vh)))
+		if target.name == "symbol" {
+			r.renderSymbol(n, target, st, depth+1)
+			return
+		}
+		r.render(target, st, depth+1)
+	case "text":
+		st := r.enter(n, parent)
+		if st.props["visibility"] != "hidden" {
+			r.drawText(n, st)
+		}
+	default:
+		st := r.enter(n, parent)
+		if subpaths := r.shape(n, st.m.scale()); subpaths != nil && st.props["visibility"] != "hidden" {
+			r.drawShape(subpaths, st)
+		}
+	}
+}
+
+// renderSymbol draws a symbol that use instantiates: a viewport as big as
+// the <use> asks, 100% by default, onto which the symbol's view box is
+// mapped.
+func (r *svgRenderer) renderSymbol(use, symbol *svgNode, st svgState, depth int) {
+	st = r.enter(symbol, st)
+	if vb := svgNumbers(symbol.attrs["viewBox"]); len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+		size := func(k string, ref float64) float64 {
+			if v, ok := use.attrs[k]; ok {
+				return r.length(v, ref)
+			}
+			return ref
+		}
+		w, h := size("width", r.vw), size("height", r.vh)
+		if w <= 0 || h <= 0 {
+			return
+		}
+		st.m = st.m.mul(viewBoxMatrix([4]float64(vb), symbol.attrs["preserveAspectRatio"], w, h))
+	}
+	for _, child := range symbol.children {
+		r.render(child, st, depth+1)
+	}
+}
+
+// length parses a length, resolving percentages against ref.
+func (r *svgRenderer) length(s string, ref float64) float64 {
+	s = strings.TrimSpace(s)
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		f, _ := strconv.ParseFloat(v, 64)
+		return f / 100 * ref
+	}
+	v, _ := svgAbsoluteLength(s)
+	return v
+}
+
+// shape returns the outline of a basic shape or path in user space, or nil
+// for elements that draw nothing. scale is the device pixels per user unit,
+// which sets how finely curves are flattened.
+func (r *svgRenderer) shape(n *svgNode, scale float64) []svgSubpath {
+	a := n.attrs
+	num := func(k string, ref float64) float64 { return r.length(a[k], ref) }
+	diag := math.Hypot(r.vw, r.vh) / math.Sqrt2
+	switch n.name {
+	case "path":
+		return parsePathData(a["d"], scale)
+	case "rect":
+		x, y, w, h := num("x", r.vw), num("y", r.vh), num("width", r.vw), num("height", r.vh)
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		rx, rxok := a["rx"]
+		ry, ryok := a["ry"]
+		if !rxok {
+			rx = ry
+		}
+		if !ryok {
+			ry = rx
+		}
+		return []svgSubpath{{pts: roundedRectPath(x, y, w, h, r.length(rx, r.vw), r.length(ry, r.vh), scale), closed: true}}
+	case "circle":
+		radius := num("r", diag)
+		return ellipsePath(num("cx", r.vw), num("cy", r.vh), radius, radius, scale)
+	case "ellipse":
+		return ellipsePath(num("cx", r.vw), num("cy", r.vh), num("rx", r.vw), num("ry", r.vh), scale)
+	case "line":
+		return []svgSubpath{{pts: []PathPoint{{num("x1", r.vw), num("y1", r.vh)}, {num("x2", r.vw), num("y2", r.vh)}}}}
+	case "polyline", "polygon":
+		nums := svgNumbers(a["points"])
+		var pts []PathPoint
+		for i := 0; i+1 < len(nums); i += 2 {
+			pts = append(pts, PathPoint{nums[i], nums[i+1]})
+		}
+		if len(pts) < 2 {
+			return nil
+		}
+		return []svgSubpath{{pts: pts, closed: n.name == "polygon"}}
+	}
+	return nil
+}
+
+// drawShape fills and strokes subpaths in user space.
+func (r *svgRenderer) drawShape(subpaths []svgSubpath, st svgState) {
+	bbox := svgBounds(subpaths)
+	var device []svgSubpath
+	for _, sp := range subpaths {
+		pts := make([]PathPoint, len(sp.pts))
+		for i, p := range sp.pts {
+			pts[i].X, pts[i].Y = st.m.apply(p.X, p.Y)
+		}
+		device = append(device, svgSubpath{pts: pts, closed: sp.closed})
+	}
+
+	if fill := r.paint(svgProp(st, "fill", "black"), st, bbox); fill != nil {
+		var polys [][]PathPoint
+		for _, sp := range device {
+			if len(sp.pts) >= 3 {
+				polys = append(polys, sp.pts)
+			}
+		}
+		r.fill(polys, fill, st.opacity*svgOpacity(st.props["fill-opacity"]), st.clip)
+	}
+	width := r.length(svgProp(st, "stroke-width", "1"), math.Hypot(r.vw, r.vh)/math.Sqrt2) * st.m.scale()
+	if stroke := r.paint(svgProp(st, "stroke", "none"), st, bbox); stroke != nil && width > 0 {
+		var polys [][]PathPoint
+		for _, sp := range device {
+			polys = append(polys, strokePolygons(sp, width, st.props["stroke-linecap"])...)
+		}
+		r.fill(polys, stroke, st.opacity*svgOpacity(st.props["stroke-opacity"]), st.clip)
+	}
+}
+
+// fill paints polygons in device pixels with src, scaled by alpha and
+// masked by clip.
+func (r *svgRenderer) fill(polys [][]PathPoint, src image.Image, alpha float64, clip *image.Alpha) {
+	polys = clampPolygons(polys)
+	area := polygonBounds(polys).Intersect(r.dst.Bounds())
+	if area.Empty() || alpha <= 0 {
+		return
+	}
+	mask := rasterizePolygons(polys, area)
+	r.drawMask(mask, src, alpha, clip)
+}
+
+// drawMask paints src through mask, scaled by alpha and masked by clip.
+func (r *svgRenderer) drawMask(mask *image.Alpha, src image.Image, alpha float64, clip *image.Alpha) {
+	area := mask.Bounds()
+	if alpha < 1 || clip != nil {
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				i := mask.PixOffset(x, y)
+				a := float64(mask.Pix[i]) * alpha
+				if clip != nil {
+					a *= float64(clip.AlphaAt(x, y).A) / 0xFF
+				}
+				mask.Pix[i] = uint8(math.Round(a))
+			}
+		}
+	}
+	draw.DrawMask(r.dst, area, src, area.Min, mask, area.Min, draw.Over)
+}
+
+// svgMaxCoord bounds device coordinates: far enough out that clamping never
+// moves an edge crossing a drawable image, near enough that the rasterizer's
+// fixed-point arithmetic cannot overflow.
+const svgMaxCoord = 1 << 16
+
+// clampPolygons returns polys in device pixels with points that are not
+// finite dropped and the rest clamped to ±svgMaxCoord.
+func clampPolygons(polys [][]PathPoint) [][]PathPoint {
+	out := make([][]PathPoint, 0, len(polys))
+	for _, poly := range polys {
+		pts := make([]PathPoint, 0, len(poly))
+		for _, p := range poly {
+			if math.IsNaN(p.X) || math.IsNaN(p.Y) || math.IsInf(p.X, 0) || math.IsInf(p.Y, 0) {
+				continue
+			}
+			pts = append(pts, PathPoint{math.Max(-svgMaxCoord, math.Min(p.X, svgMaxCoord)), math.Max(-svgMaxCoord, math.Min(p.Y, svgMaxCoord))})
+		}
+		out = append(out, pts)
+	}
+	return out
+}
+
+// rasterizePolygons returns the coverage of polys within area.
+func rasterizePolygons(polys [][]PathPoint, area image.Rectangle) *image.Alpha {
+	z := vector.NewRasterizer(area.Dx(), area.Dy())
+	for _, poly := range polys {
+		if len(poly) < 3 {
+			continue
+		}
+		ox, oy := float64(area.Min.X), float64(area.Min.Y)
+		z.MoveTo(float32(poly[0].X-ox), float32(poly[0].Y-oy))
+		for _, p := range poly[1:] {
+			z.LineTo(float32(p.X-ox), float32(p.Y-oy))
+		}
+		z.ClosePath()
+	}
+	mask := image.NewAlpha(area)
+	z.Draw(mask, area, image.Opaque, image.Point{})
+	return mask
+}
+
+// clipMask returns the coverage of clip path cp's shapes, intersected with
+// the clip already in force.
+func (r *svgRenderer) clipMask(cp *svgNode, st svgState) *image.Alpha {
+	m := st.m
+	if t, ok := cp.attrs["transform"]; ok {
+		m = m.mul(parseSVGTransform(t))
+	}
+	var polys [][]PathPoint
+	for _, child := range cp.children {
+		if child.name == "" {
+			continue
+		}
+		cm := m
+		if t, ok := child.attrs["transform"]; ok {
+			cm = cm.mul(parseSVGTransform(t))
+		}
+		for _, sp := range r.shape(child, cm.scale()) {
+			pts := make([]PathPoint, len(sp.pts))
+			for i, p := range sp.pts {
+				pts[i].X, pts[i].Y = cm.apply(p.X, p.Y)
+			}
+			polys = append(polys, pts)
+		}
+	}
+	mask := image.NewAlpha(r.dst.Bounds())
+	polys = clampPolygons(polys)
+	if area := polygonBounds(polys).Intersect(r.dst.Bounds()); !area.Empty() {
+		draw.Draw(mask, area, rasterizePolygons(polys, area), area.Min, draw.Src)
+	}
+	if st.clip != nil {
+		for i := range mask.Pix {
+			mask.Pix[i] = uint8(int(mask.Pix[i]) * int(st.clip.Pix[i]) / 0xFF)
+		}
+	}
+	return mask
+}
+
+// paint returns the image a fill or stroke value paints with, or nil for
+// none. bbox is the shape's bounds in user space, for gradients.
+func (r *svgRenderer) paint(value string, st svgState, bbox [4]float64) image.Image {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "url(") {
+		end := strings.Index(value, ")")
+		if end < 0 {
+			return nil
+		}
+		if g := r.gradient(r.img.ids[svgURL(value[:end+1])], st, bbox); g != nil {
+			return g
+		}
+		value = strings.TrimSpace(value[end+1:]) // the fallback color, if any
+	}
+	if value == "currentColor" {
+		value = svgProp(st, "color", "black")
+	}
+	c, ok := parseSVGColor(value)
+	if !ok {
+		return nil
+	}
+	return image.NewUniform(c)
+}
+
+// svgProp returns an inherited property, or def when it is unset.
+func svgProp(st svgState, name, def string) string {
+	if v, ok := st.props[name]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// svgOpacity parses an opacity, which is 1 when unset.
+func svgOpacity(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 1
+	}
+	pct := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 1
+	}
+	if pct {
+		v /= 100
+	}
+	return math.Max(0, math.Min(v, 1))
+}
+
+// ---- SVG images: gradients ----
+
+type svgStop struct {
+	offset float64
+	color  color.NRGBA
+}
+
+// svgGradient is a gradient painted in device pixels.
+type svgGradient struct {
+	inv    svgMatrix // device pixels to gradient space
+	radial bool
+	// Linear gradients run from (x1, y1) to (x2, y2); radial ones are
+	// centered on (x1, y1) with radius x2.
+	x1, y1, x2, y2 float64
+	stops          []svgStop
+}
+
+func (g *svgGradient) ColorModel() color.Model { return color.NRGBAModel }
+
+func (g *svgGradient) Bounds() image.Rectangle {
+	return image.Rect(-1<<30, -1<<30, 1<<30, 1<<30)
+}
+
+func (g *svgGradient) At(x, y int) color.Color {
+	px, py := g.inv.apply(float64(x)+0.5, float64(y)+0.5)
+	var t float64
+	if g.radial {
+		t = math.Hypot(px-g.x1, py-g.y1) / g.x2
+	} else if dx, dy := g.x2-g.x1, g.y2-g.y1; dx != 0 || dy != 0 {
+		t = ((px-g.x1)*dx + (py-g.y1)*dy) / (dx*dx + dy*dy)
+	}
+	stops := g.stops
+	if t <= stops[0].offset {
+		return stops[0].color
+	}
+	for i := 1; i < len(stops); i++ {
+		if t <= stops[i].offset {
+			a, b := stops[i-1], stops[i]
+			f := (t - a.offset) / math.Max(b.offset-a.offset, 1e-9)
+			mix := func(p, q uint8) uint8 { return uint8(math.Round(float64(p) + (float64(q)-float64(p))*f)) }
+			return color.NRGBA{mix(a.color.R, b.color.R), mix(a.color.G, b.color.G), mix(a.color.B, b.color.B), mix(a.color.A, b.color.A)}
+		}
+	}
+	return stops[len(stops)-1].color
+}
+
+// gradient returns the paint of gradient element n for a shape with the
+// given user space bounds, or nil when n is not a usable gradient.
+func (r *svgRenderer) gradient(n *svgNode, st svgState, bbox [4]float64) image.Image {
+	if n == nil || (n.name != "linearGradient" && n.name != "radialGradient") {
+		return nil
+	}
+	// Attributes and stops missing from a gradient come from the one its
+	// href names.
+	chain := []*svgNode{n}
+	for next := n; len(chain) < 8; {
+		next = r.img.ids[strings.TrimPrefix(next.attrs["href"], "#")]
+		if next == nil {
+			break
+		}
+		chain = append(chain, next)
+	}
+	attr := func(k, def string) string {
+		for _, g := range chain {
+			if v, ok := g.attrs[k]; ok {
+				return v
+			}
+		}
+		return def
+	}
+	var stops []svgStop
+	for _, g := range chain {
+		for _, child := range g.children {
+			if child.name != "stop" {
+				continue
+			}
+			c, ok := parseSVGColor(child.attrs["stop-color"])
+			if !ok {
+				c = color.NRGBA{A: 0xFF}
+			}
+			c.A = uint8(math.Round(float64(c.A) * svgOpacity(child.attrs["stop-opacity"])))
+			offset := math.Max(0, math.Min(svgOpacity(child.attrs["offset"]), 1))
+			if len(stops) > 0 {
+				offset = math.Max(offset, stops[len(stops)-1].offset)
+			}
+			stops = append(stops, svgStop{offset, c})
+		}
+		if len(stops) > 0 {
+			break
+		}
+	}
+	switch len(stops) {
+	case 0:
+		return nil
+	case 1:
+		return image.NewUniform(stops[0].color)
+	}
+
+	bboxUnits := attr("gradientUnits", "objectBoundingBox") != "userSpaceOnUse"
+	coord := func(k, def string, ref float64) float64 {
+		v := attr(k, def)
+		if bboxUnits {
+			return svgOpacity(v) // a fraction, or a percentage of the box
+		}
+		return r.length(v, ref)
+	}
+	m := st.m
+	if bboxUnits {
+		if bbox[2] <= bbox[0] || bbox[3] <= bbox[1] {
+			return nil
+		}
+		m = m.mul(svgTranslate(bbox[0], bbox[1])).mul(svgScale(bbox[2]-bbox[0], bbox[3]-bbox[1]))
+	}
+	m = m.mul(parseSVGTransform(attr("gradientTransform", "")))
+	inv, ok := m.invert()
+	if !ok {
+		return nil
+	}
+	g := &svgGradient{inv: inv, stops: stops}
+	if n.name == "radialGradient" {
+		g.radial = true
+		g.x1, g.y1 = coord("cx", "50%", r.vw), coord("cy", "50%", r.vh)
+		g.x2 = coord("r", "50%", math.Hypot(r.vw, r.vh)/math.Sqrt2)
+		if g.x2 <= 0 {
+			return image.NewUniform(stops[len(stops)-1].color)
+		}
+	} else {
+		g.x1, g.y1 = coord("x1", "0%", r.vw), coord("y1", "0%", r.vh)
+		g.x2, g.y2 = coord("x2", "100%", r.vw), coord("y2", "0%", r.vh)
+	}
+	return g
+}
+
+// ---- SVG images: text ----
+
+// svgTextRun is text drawn in one style, optionally starting at a new
+// position.
+type svgTextRun struct {
+	text   string
+	st     svgState
+	x, y   []float64 // absolute position, when given
+	dx, dy float64
+}
+
+// drawText draws a text element and its tspans. Each run placed with x or y
+// starts a chunk that text-anchor aligns as a whole.
+func (r *svgRenderer) drawText(n *svgNode, st svgState) {
+	var runs []svgTextRun
+	var collect func(n *svgNode, st svgState, first bool)
+	collect = func(n *svgNode, st svgState, first bool) {
+		pos := svgTextRun{st: st, x: r.lengths(n.attrs["x"], r.vw), y: r.lengths(n.attrs["y"], r.vh)}
+		if dx := r.lengths(n.attrs["dx"], r.vw); len(dx) > 0 {
+			pos.dx = dx[0]
+		}
+		if dy := r.lengths(n.attrs["dy"], r.vh); len(dy) > 0 {
+			pos.dy = dy[0]
+		}
+		if first && pos.x == nil {
+			pos.x = []float64{0}
+		}
+		if first && pos.y == nil {
+			pos.y = []float64{0}
+		}
+		placed := false
+		for _, child := range n.children {
+			switch {
+			case child.name == "":
+				run := svgTextRun{text: child.text, st: st}
+				if !placed {
+					run.x, run.y, run.dx, run.dy = pos.x, pos.y, pos.dx, pos.dy
+					placed = true
+				}
+				runs = append(runs, run)
+			case child.name == "tspan" && child.attrs["display"] != "none":
+				if !placed {
+					runs = append(runs, svgTextRun{st: st, x: pos.x, y: pos.y, dx: pos.dx, dy: pos.dy})
+					placed = true
+				}
+				collect(child, r.enter(child, st), false)
+			}
+		}
+	}
+	collect(n, st, true)
+
+	// Collapse white space as xml:space="default" does.
+	space := regexp.MustCompile(`\s+`)
+	for i := range runs {
+		runs[i].text = space.ReplaceAllString(runs[i].text, " ")
+	}
+	for i := 0; i < len(runs) && strings.TrimSpace(runs[i].text) == ""; i++ {
+		runs[i].text = ""
+	}
+	if len(runs) > 0 {
+		runs[0].text = strings.TrimLeft(runs[0].text, " ")
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		runs[i].text = strings.TrimRight(runs[i].text, " ")
+		if runs[i].text != "" {
+			break
+		}
+	}
+
+	var x, y float64 // pen position in user space of the text element
+	var chunk []svgTextRun
+	var chunkX, chunkY float64
+	flush := func() {
+		r.drawTextChunk(chunk, chunkX, chunkY, st)
+		chunk = nil
+	}
+	for _, run := range runs {
+		if run.x != nil || run.y != nil {
+			flush()
+			if run.x != nil {
+				x = run.x[0]
+			}
+			if run.y != nil {
+				y = run.y[0]
+			}
+			x, y = x+run.dx, y+run.dy
+			chunkX, chunkY = x, y
+		} else if run.dx != 0 || run.dy != 0 {
+			flush()
+			x, y = x+run.dx, y+run.dy
+			chunkX, chunkY = x, y
+		}
+		if run.text == "" {
+			continue
+		}
+		chunk = append(chunk, run)
+		x += r.textAdvance(run) / math.Max(st.m.scale(), 1e-9)
+	}
+	flush()
+}
+
+// lengths parses a list of lengths, resolving percentages against ref.
+func (r *svgRenderer) lengths(s string, ref float64) []float64 {
+	var out []float64
+	for _, f := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' || c == '\n' }) {
+		out = append(out, r.length(f, ref))
+	}
+	return out
+}
+
+// textFace returns the face a run is drawn with, sized in device pixels.
+func (r *svgRenderer) textFace(run svgTextRun) font.Face {
+	role := FontRegular
+	weight := run.st.props["font-weight"]
+	bold := weight == "bold" || weight == "bolder"
+	if w, err := strconv.Atoi(weight); err == nil && w >= 600 {
+		bold = true
+	}
+	italic := run.st.props["font-style"] == "italic" || run.st.props["font-style"] == "oblique"
+	family := strings.ToLower(run.st.props["font-family"])
+	switch {
+	case strings.Contains(family, "mono") || strings.Contains(family, "courier") || strings.Contains(family, "consol"):
+		role = FontMono
+	case bold && italic:
+		role = FontBoldItalic
+	case bold:
+		role = FontBold
+	case italic:
+		role = FontItalic
+	}
+	f := r.img.fonts.byRole(role)
+	if f == nil || f.Font == nil {
+		return nil
+	}
+	size := svgFontSize(run.st.props["font-size"], 16) * run.st.m.scale()
+	return truetype.NewFace(f.Font, &truetype.Options{Size: size, DPI: 72})
+}
+
+// textAdvance returns the width of a run in device pixels.
+func (r *svgRenderer) textAdvance(run svgTextRun) float64 {
+	face := r.textFace(run)
+	if face == nil {
+		return 0
+	}
+	return float64(font.MeasureString(face, run.text)) / 64
+}
+
+// drawTextChunk draws runs from (x, y) in the text element's user space,
+// aligned by its text-anchor.
+func (r *svgRenderer) drawTextChunk(runs []svgTextRun, x, y float64, st svgState) {
+	if len(runs) == 0 {
+		return
+	}
+	var width float64
+	for _, run := range runs {
+		width += r.textAdvance(run)
+	}
+	px, py := st.m.apply(x, y)
+	switch svgProp(runs[0].st, "text-anchor", "start") {
+	case "middle":
+		px -= width / 2
+	case "end":
+		px -= width
+	}
+	for _, run := range runs {
+		face := r.textFace(run)
+		if face == nil {
+			return
+		}
+		advance := float64(font.MeasureString(face, run.text)) / 64
+		fill := r.paint(svgProp(run.st, "fill", "black"), run.st, [4]float64{x, y - 1, x + advance, y})
+		metrics := face.Metrics()
+		area := image.Rect(int(math.Floor(px))-1, int(math.Floor(py))-metrics.Ascent.Ceil()-1,
+			int(math.Ceil(px+advance))+1, int(math.Ceil(py))+metrics.Descent.Ceil()+1).Intersect(r.dst.Bounds())
+		if fill != nil && !area.Empty() {
+			mask := image.NewAlpha(area)
+			d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face, Dot: fixed.Point26_6{X: fixed.Int26_6(px * 64), Y: fixed.Int26_6(py * 64)}}
+			d.DrawString(run.text)
+			r.drawMask(mask, fill, run.st.opacity*svgOpacity(run.st.props["fill-opacity"]), run.st.clip)
+		}
+		px += advance
+	}
+}
+
+// svgFontSize parses a font size in pixels, relative to the inherited size
+// parent for ems and percentages.
+func svgFontSize(s string, parent float64) float64 {
+	s = strings.TrimSpace(s)
+	if v, ok := strings.CutSuffix(s, "em"); ok && !strings.HasSuffix(v, "r") {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return f * parent
+		}
+	}
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return f / 100 * parent
+		}
+	}
+	if v, ok := svgAbsoluteLength(s); ok && v > 0 {
+		return v
+	}
+	return parent
+}
+
+// ---- SVG images: geometry ----
+
+// svgSubpath is a polyline in user space; closed ones are also stroked
+// from their last point back to their first.
+type svgSubpath struct {
+	pts    []PathPoint
+	closed bool
+}
+
+// svgMatrix is the affine transform x' = a*x + c*y + e, y' = b*x + d*y + f.
+type svgMatrix struct{ a, b, c, d, e, f float64 }
+
+func svgTranslate(x, y float64) svgMatrix { return svgMatrix{1, 0, 0, 1, x, y} }
+func svgScale(x, y float64) svgMatrix     { return svgMatrix{x, 0, 0, y, 0, 0} }
+
+// mul returns the transform applying n, then m.
+func (m svgMatrix) mul(n svgMatrix) svgMatrix {
+	return svgMatrix{
+		m.a*n.a + m.c*n.b, m.b*n.a + m.d*n.b,
+		m.a*n.c + m.c*n.d, m.b*n.c + m.d*n.d,
+		m.a*n.e + m.c*n.f + m.e, m.b*n.e + m.d*n.f + m.f,
+	}
+}
+
+func (m svgMatrix) apply(x, y float64) (float64, float64) {
+	return m.a*x + m.c*y + m.e, m.b*x + m.d*y + m.f
+}
+
+func (m svgMatrix) invert() (svgMatrix, bool) {
+	det := m.a*m.d - m.b*m.c
+	if det == 0 {
+		return svgMatrix{}, false
+	}
+	return svgMatrix{
+		m.d / det, -m.b / det, -m.c / det, m.a / det,
+		(m.c*m.f - m.d*m.e) / det, (m.b*m.e - m.a*m.f) / det,
+	}, true
+}
+
+// scale returns the mean factor by which m scales lengths.
+func (m svgMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m.a*m.d - m.b*m.c))
+}
+
+var svgTransformPattern = regexp.MustCompile(`(matrix|translate|scale|rotate|skewX|skewY)\s*\(([^)]*)\)`)
+
+// parseSVGTransform parses a transform list.
+func parseSVGTransform(s string) svgMatrix {
+	m := svgTranslate(0, 0)
+	for _, t := range svgTransformPattern.FindAllStringSubmatch(s, -1) {
+		v := svgNumbers(t[2])
+		arg := func(i int, def float64) float64 {
+			if i < len(v) {
+				return v[i]
+			}
+			return def
+		}
+		switch t[1] {
+		case "matrix":
+			if len(v) == 6 {
+				m = m.mul(svgMatrix{v[0], v[1], v[2], v[3], v[4], v[5]})
+			}
+		case "translate":
+			m = m.mul(svgTranslate(arg(0, 0), arg(1, 0)))
+		case "scale":
+			m = m.mul(svgScale(arg(0, 1), arg(1, arg(0, 1))))
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			sin, cos := math.Sincos(a)
+			m = m.mul(svgTranslate(cx, cy)).mul(svgMatrix{cos, sin, -sin, cos, 0, 0}).mul(svgTranslate(-cx, -cy))
+		case "skewX":
+			m = m.mul(svgMatrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0})
+		case "skewY":
+			m = m.mul(svgMatrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0})
+		}
+	}
+	return m
+}
+
+// svgSteps returns how many straight segments a curve about length user
+// units long is flattened into at scale device pixels per unit.
+func svgSteps(length, scale float64) int {
+	return max(2, min(int(math.Ceil(length*scale/3)), 96))
+}
+
+// parsePathData flattens path data into subpaths.
+func parsePathData(d string, scale float64) []svgSubpath {
+	sc := svgScanner{s: d}
+	var subpaths []svgSubpath
+	var cur []PathPoint
+	var x, y, startX, startY float64
+	var ctrlX, ctrlY float64 // reflected control point for S and T
+	var cmd, prev byte
+	flush := func(closed bool) {
+		if len(cur) > 1 || closed && len(cur) > 0 {
+			subpaths = append(subpaths, svgSubpath{pts: cur, closed: closed})
+		}
+		cur = nil
+	}
+	lineTo := func(nx, ny float64) {
+		if cur == nil {
+			cur = []PathPoint{{x, y}}
+		}
+		cur = append(cur, PathPoint{nx, ny})
+		x, y = nx, ny
+	}
+	for {
+		if c, ok := sc.command(); ok {
+			cmd = c
+		} else if cmd == 0 || cmd == 'z' || cmd == 'Z' || !sc.more() {
+			break
+		}
+		rel := cmd >= 'a'
+		ox, oy := 0.0, 0.0
+		if rel {
+			ox, oy = x, y
+		}
+		switch cmd | 0x20 {
+		case 'm':
+			v, ok := sc.numbers(2)
+			if !ok {
+				return subpaths
+			}
+			flush(false)
+			x, y = ox+v[0], oy+v[1]
+			startX, startY = x, y
+			cur = []PathPoint{{x, y}}
+			cmd = 'L' | cmd&0x20 // further pairs are lines
+		case 'l':
+			v, ok := sc.numbers(2)
+			if !ok {
+				return subpaths
+			}
+			lineTo(ox+v[0], oy+v[1])
+		case 'h':
+			v, ok := sc.numbers(1)
+			if !ok {
+				return subpaths
+			}
+			lineTo(ox+v[0], y)
+		case 'v':
+			v, ok := sc.numbers(1)
+			if !ok {
+				return subpaths
+			}
+			lineTo(x, oy+v[0])
+		case 'c', 's':
+			var x1, y1 float64
+			var v []float64
+			var ok bool
+			if cmd|0x20 == 'c' {
+				if v, ok = sc.numbers(6); !ok {
+					return subpaths
+				}
+				x1, y1, v = ox+v[0], oy+v[1], v[2:]
+			} else {
+				if v, ok = sc.numbers(4); !ok {
+					return subpaths
+				}
+				x1, y1 = x, y
+				if p := prev | 0x20; p == 'c' || p == 's' {
+					x1, y1 = 2*x-ctrlX, 2*y-ctrlY
+				}
+			}
+			x2, y2, ex, ey := ox+v[0], oy+v[1], ox+v[2], oy+v[3]
+			x0, y0 := x, y
+			n := svgSteps(math.Hypot(x1-x0, y1-y0)+math.Hypot(x2-x1, y2-y1)+math.Hypot(ex-x2, ey-y2), scale)
+			for i := 1; i <= n; i++ {
+				t := float64(i) / float64(n)
+				u := 1 - t
+				lineTo(u*u*u*x0+3*u*u*t*x1+3*u*t*t*x2+t*t*t*ex, u*u*u*y0+3*u*u*t*y1+3*u*t*t*y2+t*t*t*ey)
+			}
+			ctrlX, ctrlY = x2, y2
+		case 'q', 't':
+			var x1, y1 float64
+			var v []float64
+			var ok bool
+			if cmd|0x20 == 'q' {
+				if v, ok = sc.numbers(4); !ok {
+					return subpaths
+				}
+				x1, y1, v = ox+v[0], oy+v[1], v[2:]
+			} else {
+				if v, ok = sc.numbers(2); !ok {
+					return subpaths
+				}
+				x1, y1 = x, y
+				if p := prev | 0x20; p == 'q' || p == 't' {
+					x1, y1 = 2*x-ctrlX, 2*y-ctrlY
+				}
+			}
+			ex, ey := ox+v[0], oy+v[1]
+			x0, y0 := x, y
+			n := svgSteps(math.Hypot(x1-x0, y1-y0)+math.Hypot(ex-x1, ey-y1), scale)
+			for i := 1; i <= n; i++ {
+				t := float64(i) / float64(n)
+				u := 1 - t
+				lineTo(u*u*x0+2*u*t*x1+t*t*ex, u*u*y0+2*u*t*y1+t*t*ey)
+			}
+			ctrlX, ctrlY = x1, y1
+		case 'a':
+			v, ok := sc.numbers(3)
+			large, ok1 := sc.flag()
+			sweep, ok2 := sc.flag()
+			end, ok3 := sc.numbers(2)
+			if !ok || !ok1 || !ok2 || !ok3 {
+				return subpaths
+			}
+			for _, p := range arcPoints(x, y, v[0], v[1], v[2], large, sweep, ox+end[0], oy+end[1], scale) {
+				lineTo(p.X, p.Y)
+			}
+		case 'z':
+			if cur != nil {
+				flush(true)
+			}
+			x, y = startX, startY
+		default:
+			return subpaths
+		}
+		prev = cmd
+	}
+	flush(false)
+	return subpaths
+}
+
+// arcPoints flattens an elliptical arc from (x1, y1) to (x2, y2), returning
+// the points after the first. It follows the endpoint-to-center conversion
+// of SVG 1.1, appendix F.6.
+func arcPoints(x1, y1, rx, ry, phi float64, large, sweep bool, x2, y2, scale float64) []PathPoint {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || (x1 == x2 && y1 == y2) {
+		return []PathPoint{{x2, y2}}
+	}
+	sin, cos := math.Sincos(phi * math.Pi / 180)
+	dx, dy := (x1-x2)/2, (y1-y2)/2
+	px, py := cos*dx+sin*dy, -sin*dx+cos*dy
+	if l := px*px/(rx*rx) + py*py/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*py*py - ry*ry*px*px
+	den := rx*rx*py*py + ry*ry*px*px
+	k := math.Sqrt(math.Max(num/den, 0))
+	if large == sweep {
+		k = -k
+	}
+	cxp, cyp := k*rx*py/ry, -k*ry*px/rx
+	cx, cy := cos*cxp-sin*cyp+(x1+x2)/2, sin*cxp+cos*cyp+(y1+y2)/2
+	angle := func(ux, uy float64) float64 { return math.Atan2(uy, ux) }
+	start := angle((px-cxp)/rx, (py-cyp)/ry)
+	delta := angle((-px-cxp)/rx, (-py-cyp)/ry) - start
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+	n := svgSteps(math.Abs(delta)*math.Max(rx, ry), scale)
+	pts := make([]PathPoint, 0, n)
+	for i := 1; i <= n; i++ {
+		a := start + delta*float64(i)/float64(n)
+		ex, ey := rx*math.Cos(a), ry*math.Sin(a)
+		pts = append(pts, PathPoint{cos*ex - sin*ey + cx, sin*ex + cos*ey + cy})
+	}
+	pts[len(pts)-1] = PathPoint{x2, y2}
+	return pts
+}
+
+// ellipsePath returns an ellipse as a closed subpath, clockwise.
+func ellipsePath(cx, cy, rx, ry, scale float64) []svgSubpath {
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+	n := svgSteps(2*math.Pi*math.Max(rx, ry), scale)
+	pts := make([]PathPoint, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = PathPoint{cx + rx*math.Cos(a), cy + ry*math.Sin(a)}
+	}
+	return []svgSubpath{{pts: pts, closed: true}}
+}
+
+// roundedRectPath returns a rectangle whose corners are rounded by radii
+// rx and ry, clockwise.
+func roundedRectPath(x, y, w, h, rx, ry, scale float64) []PathPoint {
+	rx, ry = math.Min(math.Max(rx, 0), w/2), math.Min(math.Max(ry, 0), h/2)
+	if rx == 0 || ry == 0 {
+		return []PathPoint{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}
+	}
+	n := svgSteps(math.Pi/2*math.Max(rx, ry), scale)
+	corners := []struct{ cx, cy, start float64 }{
+		{x + w - rx, y + ry, -math.Pi / 2},
+		{x + w - rx, y + h - ry, 0},
+		{x + rx, y + h - ry, math.Pi / 2},
+		{x + rx, y + ry, math.Pi},
+	}
+	var pts []PathPoint
+	for _, c := range corners {
+		for i := 0; i <= n; i++ {
+			a := c.start + math.Pi/2*float64(i)/float64(n)
+			pts = append(pts, PathPoint{c.cx + rx*math.Cos(a), c.cy + ry*math.Sin(a)})
+		}
+	}
+	return pts
+}
+
+// strokePolygons returns the polygons covering a stroke of the given width
+// along sp, in device pixels. Joins are round; ends are butt, round or
+// square as linecap asks.
+func strokePolygons(sp svgSubpath, width float64, linecap string) [][]PathPoint {
+	pts := sp.pts
+	if sp.closed && len(pts) > 1 {
+		pts = append(append([]PathPoint(nil), pts...), pts[0])
+	}
+	var polys [][]PathPoint
+	dot := func(p PathPoint) {
+		polys = append(polys, ellipsePath(p.X, p.Y, width/2, width/2, 1)[0].pts)
+	}
+	for i := 0; i+1 < len(pts); i++ {
+		a, b := pts[i], pts[i+1]
+		if !sp.closed && linecap == "square" {
+			dx, dy := b.X-a.X, b.Y-a.Y
+			if l := math.Hypot(dx, dy); l > 0 {
+				ux, uy := dx/l*width/2, dy/l*width/2
+				if i == 0 {
+					a = PathPoint{a.X - ux, a.Y - uy}
+				}
+				if i+2 == len(pts) {
+					b = PathPoint{b.X + ux, b.Y + uy}
+				}
+			}
+		}
+		if quad := strokeSegment(a, b, width); quad != nil {
+			polys = append(polys, quad)
+		}
+		if i > 0 && width > 1.5 {
+			dot(pts[i])
+		}
+	}
+	if sp.closed && len(pts) > 2 && width > 1.5 {
+		dot(pts[0])
+	}
+	if !sp.closed && linecap == "round" && len(pts) > 0 {
+		dot(pts[0])
+		dot(pts[len(pts)-1])
+	}
+	return polys
+}
+
+// svgBounds returns the min-x, min-y, max-x and max-y of subpaths.
+func svgBounds(subpaths []svgSubpath) [4]float64 {
+	b := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, sp := range subpaths {
+		for _, p := range sp.pts {
+			b[0], b[1] = math.Min(b[0], p.X), math.Min(b[1], p.Y)
+			b[2], b[3] = math.Max(b[2], p.X), math.Max(b[3], p.Y)
+		}
+	}
+	return b
+}
+
+// polygonBounds returns the pixels polys touch.
+func polygonBounds(polys [][]PathPoint) image.Rectangle {
+	var r image.Rectangle
+	for _, poly := range polys {
+		for _, p := range poly {
+			pr := image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Ceil(p.X))+1, int(math.Ceil(p.Y))+1)
+			r = r.Union(pr)
+		}
+	}
+	return r
+}
+
+// ---- SVG images: values ----
+
+// svgScanner reads the numbers and commands of path data.
+type svgScanner struct {
+	s string
+	i int
+}
+
+func (sc *svgScanner) skip() {
+	for sc.i < len(sc.s) && strings.IndexByte(" \t\r\n,", sc.s[sc.i]) >= 0 {
+		sc.i++
+	}
+}
+
+func (sc *svgScanner) more() bool {
+	sc.skip()
+	return sc.i < len(sc.s)
+}
+
+// command reads a command letter, if one is next.
+func (sc *svgScanner) command() (byte, bool) {
+	sc.skip()
+	if sc.i < len(sc.s) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", sc.s[sc.i]) >= 0 {
+		sc.i++
+		return sc.s[sc.i-1], true
+	}
+	return 0, false
+}
+
+// number reads a number such as -1.5e3, which may run straight into the
+// next one as in "1.5.5" or "1-2".
+func (sc *svgScanner) number() (float64, bool) {
+	sc.skip()
+	start, i := sc.i, sc.i
+	if i < len(sc.s) && (sc.s[i] == '-' || sc.s[i] == '+') {
+		i++
+	}
+	digits := 0
+	for ; i < len(sc.s) && sc.s[i] >= '0' && sc.s[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(sc.s) && sc.s[i] == '.' {
+		for i++; i < len(sc.s) && sc.s[i] >= '0' && sc.s[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if i < len(sc.s) && (sc.s[i] == 'e' || sc.s[i] == 'E') {
+		j := i + 1
+		if j < len(sc.s) && (sc.s[j] == '-' || sc.s[j] == '+') {
+			j++
+		}
+		if j < len(sc.s) && sc.s[j] >= '0' && sc.s[j] <= '9' {
+			for i = j; i < len(sc.s) && sc.s[i] >= '0' && sc.s[i] <= '9'; i++ {
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(sc.s[start:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	sc.i = i
+	return v, true
+}
+
+func (sc *svgScanner) numbers(n int) ([]float64, bool) {
+	v := make([]float64, n)
+	for i := range v {
+		var ok bool
+		if v[i], ok = sc.number(); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// flag reads an arc flag, a single 0 or 1 that need not be separated from
+// what follows.
+func (sc *svgScanner) flag() (bool, bool) {
+	sc.skip()
+	if sc.i < len(sc.s) && (sc.s[sc.i] == '0' || sc.s[sc.i] == '1') {
+		sc.i++
+		return sc.s[sc.i-1] == '1', true
+	}
+	return false, false
+}
+
+// svgNumbers parses a list of numbers separated by spaces or commas.
+func svgNumbers(s string) []float64 {
+	sc := svgScanner{s: s}
+	var out []float64
+	for {
+		v, ok := sc.number()
+		if !ok {
+			return out
+		}
+		out = append(out, v)
+	}
+}
+
+// svgAbsoluteLength parses a length in pixels, converting absolute units.
+// Percentages and unknown units are rejected.
+func svgAbsoluteLength(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	units := map[string]float64{"px": 1, "pt": 4.0 / 3, "pc": 16, "mm": 96 / 25.4, "cm": 96 / 2.54, "in": 96, "em": 16, "ex": 8}
+	factor := 1.0
+	if len(s) > 2 {
+		if f, ok := units[s[len(s)-2:]]; ok {
+			s, factor = s[:len(s)-2], f
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) > 1e9 {
+		return 0, false
+	}
+	return v * factor, true
+}
+
+// svgURL returns the id named by a url(#id) reference, or "".
+func svgURL(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "url(") || !strings.HasSuffix(s, ")") {
+		return ""
+	}
+	ref := strings.Trim(strings.TrimSpace(s[4:len(s)-1]), `"'`)
+	return strings.TrimPrefix(ref, "#")
+}
+
+// svgColors holds the named colors SVG files commonly use.
+var svgColors = map[string]color.NRGBA{
+	"black": {0, 0, 0, 255}, "white": {255, 255, 255, 255}, "red": {255, 0, 0, 255},
+	"green": {0, 128, 0, 255}, "blue": {0, 0, 255, 255}, "yellow": {255, 255, 0, 255},
+	"orange": {255, 165, 0, 255}, "purple": {128, 0, 128, 255}, "gray": {128, 128, 128, 255},
+	"grey": {128, 128, 128, 255}, "silver": {192, 192, 192, 255}, "maroon": {128, 0, 0, 255},
+	"navy": {0, 0, 128, 255}, "teal": {0, 128, 128, 255}, "olive": {128, 128, 0, 255},
+	"lime": {0, 255, 0, 255}, "aqua": {0, 255, 255, 255}, "cyan": {0, 255, 255, 255},
+	"fuchsia": {255, 0, 255, 255}, "magenta": {255, 0, 255, 255}, "pink": {255, 192, 203, 255},
+	"brown": {165, 42, 42, 255}, "gold": {255, 215, 0, 255}, "indigo": {75, 0, 130, 255},
+	"violet": {238, 130, 238, 255}, "crimson": {220, 20, 60, 255}, "coral": {255, 127, 80, 255},
+	"salmon": {250, 128, 114, 255}, "tomato": {255, 99, 71, 255}, "orchid": {218, 112, 214, 255},
+	"khaki": {240, 230, 140, 255}, "tan": {210, 180, 140, 255}, "beige": {245, 245, 220, 255},
+	"ivory": {255, 255, 240, 255}, "lavender": {230, 230, 250, 255}, "turquoise": {64, 224, 208, 255},
+	"skyblue": {135, 206, 235, 255}, "steelblue": {70, 130, 180, 255}, "royalblue": {65, 105, 225, 255},
+	"darkblue": {0, 0, 139, 255}, "darkgreen": {0, 100, 0, 255}, "darkred": {139, 0, 0, 255},
+	"darkgray": {169, 169, 169, 255}, "darkgrey": {169, 169, 169, 255}, "lightgray": {211, 211, 211, 255},
+	"lightgrey": {211, 211, 211, 255}, "lightblue": {173, 216, 230, 255}, "lightgreen": {144, 238, 144, 255},
+	"dimgray": {105, 105, 105, 255}, "dimgrey": {105, 105, 105, 255}, "whitesmoke": {245, 245, 245, 255},
+	"gainsboro": {220, 220, 220, 255}, "slategray": {112, 128, 144, 255}, "forestgreen": {34, 139, 34, 255},
+	"seagreen": {46, 139, 87, 255}, "limegreen": {50, 205, 50, 255}, "firebrick": {178, 34, 34, 255},
+	"goldenrod": {218, 165, 32, 255}, "chocolate": {210, 105, 30, 255}, "sienna": {160, 82, 45, 255},
+	"transparent": {},
+}
+
+// parseSVGColor parses a hex, rgb(), rgba() or named color. "none" and
+// anything unknown report false.
+func parseSVGColor(s string) (color.NRGBA, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := svgColors[s]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(s, "#") {
+		c, err := parseHexColor(s)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBAModel.Convert(c).(color.NRGBA), true
+	}
+	inner, ok := strings.CutPrefix(s, "rgba(")
+	if !ok {
+		inner, ok = strings.CutPrefix(s, "rgb(")
+	}
+	if !ok || !strings.HasSuffix(inner, ")") {
+		return color.NRGBA{}, false
+	}
+	parts := strings.FieldsFunc(strings.TrimSuffix(inner, ")"), func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+	if len(parts) < 3 {
+		return color.NRGBA{}, false
+	}
+	var v [3]uint8
+	for i := range v {
+		p := parts[i]
+		f, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		if strings.HasSuffix(p, "%") {
+			f *= 2.55
+		}
+		v[i] = uint8(math.Round(math.Max(0, math.Min(f, 255))))
+	}
+	c := color.NRGBA{v[0], v[1], v[2], 0xFF}
+	if len(parts) > 3 {
+		c.A = uint8(math.Round(svgOpacity(parts[3]) * 0xFF))
+	}
+	return c, true
+}
@@ -0,0 +1,192 @@
+package md2png
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rasterizeSVG parses src and rasterizes it at width x height.
+func rasterizeSVG(t *testing.T, src string, width, height int) *image.RGBA {
+	t.Helper()
+	fonts, err := LoadFonts(FontConfig{})
+	if err != nil {
+		t.Fatalf("load fonts: %v", err)
+	}
+	img, err := parseSVG([]byte(src), fonts)
+	if err != nil {
+		t.Fatalf("parse svg: %v", err)
+	}
+	return img.rasterize(width, height)
+}
+
+// near reports whether c is within 8 of want in every channel.
+func near(c color.RGBA, want color.RGBA) bool {
+	d := func(a, b uint8) bool { return int(a)-int(b) <= 8 && int(b)-int(a) <= 8 }
+	return d(c.R, want.R) && d(c.G, want.G) && d(c.B, want.B) && d(c.A, want.A)
+}
+
+func TestRasterizeSVGShapes(t *testing.T) {
+	src := `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10" width="20" height="20">
+  <rect width="5" height="10" fill="#f00"/>
+  <g transform="translate(5 0)" opacity="0.5"><rect width="5" height="5" style="fill: rgb(0, 0, 255)"/></g>
+  <path d="M5,5h5v5H5z" fill="none" stroke="lime" stroke-width="2"/>
+</svg>`
+	img := rasterizeSVG(t, src, 40, 40)
+	cases := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 30, color.RGBA{0xFF, 0, 0, 0xFF}},
+		{30, 10, color.RGBA{0, 0, 0x80, 0x80}},
+		{30, 38, color.RGBA{0, 0xFF, 0, 0xFF}},
+	}
+	for _, c := range cases {
+		if got := img.RGBAAt(c.x, c.y); !near(got, c.want) {
+			t.Fatalf("pixel (%d,%d): expected %v, got %v", c.x, c.y, c.want, got)
+		}
+	}
+}
+
+func TestRasterizeSVGArcsAndGradients(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="50">
+  <defs><linearGradient id="g"><stop offset="0" stop-color="black"/><stop offset="1" stop-color="white"/></linearGradient></defs>
+  <rect width="100" height="20" fill="url(#g)"/>
+  <path d="M10 50 a15 15 0 0 1 30 0z" fill="blue"/>
+  <clipPath id="c"><circle cx="75" cy="40" r="5"/></clipPath>
+  <rect x="60" y="25" width="30" height="25" fill="red" clip-path="url(#c)"/>
+</svg>`
+	img := rasterizeSVG(t, src, 100, 50)
+	left, right := img.RGBAAt(5, 10), img.RGBAAt(95, 10)
+	if left.R > 0x20 || right.R < 0xE0 || left.A != 0xFF {
+		t.Fatalf("expected a black to white gradient, got %v to %v", left, right)
+	}
+	if got := img.RGBAAt(25, 40); !near(got, color.RGBA{0, 0, 0xFF, 0xFF}) {
+		t.Fatalf("expected the arc's half disc filled, got %v", got)
+	}
+	if got := img.RGBAAt(12, 38); got.A != 0 {
+		t.Fatalf("expected outside the arc blank, got %v", got)
+	}
+	if got, outside := img.RGBAAt(75, 40), img.RGBAAt(62, 27); got.R != 0xFF || outside.A != 0 {
+		t.Fatalf("expected the rect clipped to the circle, got %v inside and %v outside", got, outside)
+	}
+}
+
+func TestRasterizeSVGText(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 20">
+  <text x="50" y="15" font-size="14" text-anchor="middle" fill="#000">Hello <tspan font-weight="bold">SVG</tspan></text>
+</svg>`
+	img := rasterizeSVG(t, src, 200, 40)
+	minX, maxX := img.Bounds().Dx(), -1
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.RGBAAt(x, y).A > 0x80 {
+				minX, maxX = min(minX, x), max(maxX, x)
+			}
+		}
+	}
+	if maxX < 0 {
+		t.Fatalf("expected text drawn")
+	}
+	if mid := (minX + maxX) / 2; mid < 95 || mid > 105 {
+		t.Fatalf("expected the text centered on x=100, spanning %d-%d", minX, maxX)
+	}
+}
+
+func TestSVGImagesInDocuments(t *testing.T) {
+	dir := t.TempDir()
+	badge := `<svg xmlns="http://www.w3.org/2000/svg" width="90" height="20"><rect width="90" height="20" rx="3" fill="#4c1"/></svg>`
+	diagram := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 40 20"><rect width="40" height="20" fill="#00f"/></svg>`
+	for name, src := range map[string]string{"badge.svg": badge, "diagram.svg": diagram} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	markdown := "Build ![build](badge.svg) passing.\n\n![diagram](diagram.svg =200x)\n"
+	images, parents := imageBoxes(t, markdown, RenderOptions{Width: 600, BaseDir: dir})
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+	if parents[0] != LineBox || images[0].Rect.Size() != (image.Point{90, 20}) {
+		t.Fatalf("expected the badge inline at its own size, got %v in a %s", images[0].Rect, parents[0])
+	}
+	if got := images[1].Image.Bounds().Size(); got != (image.Point{200, 100}) {
+		t.Fatalf("expected the diagram rasterized at 200x100, got %v", got)
+	}
+	if got := color.RGBAModel.Convert(images[1].Image.At(199, 99)).(color.RGBA); got != (color.RGBA{0, 0, 0xFF, 0xFF}) {
+		t.Fatalf("expected the diagram filled to its corner, got %v", got)
+	}
+
+	images, _ = imageBoxes(t, "![a](badge.svg) ![b](badge.svg)\n", RenderOptions{Width: 600, BaseDir: dir})
+	if len(images) != 2 || images[0].Image != images[1].Image {
+		t.Fatalf("expected a repeated badge to share one rasterization")
+	}
+}
+
+func TestSVGUseCycles(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10">
+  <g id="a"><rect width="10" height="10" fill="red" fill-opacity="0.5"/><use href="#a"/></g>
+</svg>`
+	if got := rasterizeSVG(t, src, 10, 10).RGBAAt(5, 5); !near(got, color.RGBA{0x80, 0, 0, 0x80}) {
+		t.Fatalf("expected the group drawn once, got %v", got)
+	}
+
+	bomb := `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><defs>
+  <g id="a0"><rect width="1" height="1"/></g>`
+	for i := 1; i <= 16; i++ {
+		id, prev := fmt.Sprintf("a%d", i), fmt.Sprintf("#a%d", i-1)
+		bomb += fmt.Sprintf(`<g id="%s"><use href="%s"/><use href="%s"/><use href="%s"/><use href="%s"/></g>`, id, prev, prev, prev, prev)
+	}
+	bomb += `</defs><use href="#a16"/></svg>`
+	done := make(chan struct{})
+	go func() {
+		rasterizeSVG(t, bomb, 10, 10)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the node budget to stop 4^16 nested uses")
+	}
+}
+
+func TestRasterizeHostileSVGs(t *testing.T) {
+	huge := `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100"><path d="M0 0 L 1e38 5 L 5 90 Z"/><path d="M0 0 L 1e308 1e308 L -1e308 90 Z" stroke="red" stroke-width="1e300"/></svg>`
+	rasterizeSVG(t, huge, 100, 100)
+
+	fonts, err := LoadFonts(FontConfig{})
+	if err != nil {
+		t.Fatalf("load fonts: %v", err)
+	}
+	for _, size := range []string{`width="1e9" height="1e9"`, `width="10" height="1e8"`, `width="NaN" height="Inf"`} {
+		img, err := parseSVG([]byte(`<svg xmlns="http://www.w3.org/2000/svg" `+size+`><rect width="10" height="10"/></svg>`), fonts)
+		if err != nil {
+			t.Fatalf("parse svg: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() > svgMaxSize || b.Dy() > svgMaxSize {
+			t.Fatalf("%s: expected the intrinsic size capped, got %v", size, b)
+		}
+		if b := drawnImage(img, 100000, 100000).Bounds(); b.Dx() > svgMaxSize || b.Dy() > svgMaxSize {
+			t.Fatalf("%s: expected the rasterization capped, got %v", size, b)
+		}
+	}
+}
+
+func TestRasterizeSVGSymbols(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="40" height="20">
+  <symbol id="dot" viewBox="0 0 2 2"><rect width="2" height="2" fill="blue"/></symbol>
+  <use xlink:href="#dot" x="20" width="20" height="20"/>
+</svg>`
+	img := rasterizeSVG(t, src, 40, 20)
+	if got := img.RGBAAt(30, 10); got != (color.RGBA{0, 0, 0xFF, 0xFF}) {
+		t.Fatalf("expected the symbol scaled into its viewport, got %v", got)
+	}
+	if got := img.RGBAAt(10, 10); got.A != 0 {
+		t.Fatalf("expected the symbol itself not drawn, got %v", got)
+	}
+}
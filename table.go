@@ -0,0 +1,594 @@
+package md2png
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	extensionAST "github.com/yuin/goldmark/extension/ast"
+)
+
+// ---- Tables ----
+
+// Tables are laid out the way browsers lay out tables with automatic widths:
+// every column is measured for its narrowest possible width (its longest
+// word) and its preferred width (its longest unwrapped line). Columns get
+// their preferred widths when those fit, and otherwise share the space left
+// over their narrowest widths in proportion to how much they would grow. A
+// short ID column next to long descriptions therefore stays narrow.
+//
+// A table whose narrowest widths still do not fit is handled as the
+// TableOverflow option asks. Any text left running out of its cell is
+// reported as a Diagnostic.
+
+// TableOverflow selects how a table too wide for the page is fitted.
+type TableOverflow string
+
+const (
+	// TableOverflowWrap squeezes the columns anyway, letting words that do
+	// not fit run out of their cells. It is the default.
+	TableOverflowWrap TableOverflow = "wrap"
+	// TableOverflowShrink draws the table in a smaller font, down to half
+	// the base size.
+	TableOverflowShrink TableOverflow = "shrink"
+	// TableOverflowCards draws each row as a card of header and value pairs.
+	TableOverflowCards TableOverflow = "cards"
+	// TableOverflowWiden widens the image to fit the table.
+	TableOverflowWiden TableOverflow = "widen"
+	// TableOverflowSplit splits the columns into groups drawn as separate
+	// tables, each repeating the first column.
+	TableOverflowSplit TableOverflow = "split"
+)
+
+// TableOverflowByName returns the table overflow strategy called name.
+func TableOverflowByName(name string) (TableOverflow, error) {
+	switch o := TableOverflow(strings.ToLower(name)); o {
+	case "":
+		return TableOverflowWrap, nil
+	case TableOverflowWrap, TableOverflowShrink, TableOverflowCards, TableOverflowWiden, TableOverflowSplit:
+		return o, nil
+	default:
+		return "", errors.New("unknown table overflow: " + name)
+	}
+}
+
+// minTableScale is the smallest font, relative to the base size, that
+// TableOverflowShrink uses.
+const minTableScale = 0.5
+
+// TableTheme styles tables. Nil fills are not drawn; a nil border color uses
+// the theme's rule color.
+type TableTheme struct {
+	HeaderBG    color.Color // header row fill
+	StripeBG    color.Color // fill of every other body row, from the second
+	Border      color.Color
+	BorderWidth int          // pixels; 0 means 1
+	Borders     TableBorders // which border lines are drawn
+	Radius      int          // outer corner radius in pixels; 0 for square corners
+}
+
+// TableBorders selects the border lines a table is drawn with.
+type TableBorders string
+
+const (
+	// TableBordersGrid outlines the table and every cell. It is the default.
+	TableBordersGrid TableBorders = "grid"
+	// TableBordersRows draws only horizontal lines: above and below the
+	// table and between its rows.
+	TableBordersRows TableBorders = "rows"
+	// TableBordersNone draws no lines, leaving the fills to set rows apart.
+	TableBordersNone TableBorders = "none"
+)
+
+// TableBordersByName returns the border style called name.
+func TableBordersByName(name string) (TableBorders, error) {
+	switch b := TableBorders(strings.ToLower(name)); b {
+	case "":
+		return TableBordersGrid, nil
+	case TableBordersGrid, TableBordersRows, TableBordersNone:
+		return b, nil
+	default:
+		return "", errors.New("unknown table borders: " + name)
+	}
+}
+
+var (
+	lightTables = TableTheme{
+		HeaderBG: color.RGBA{0xF3, 0xF4, 0xF6, 0xFF},
+		StripeBG: color.RGBA{0xFA, 0xFA, 0xFB, 0xFF},
+		Border:   color.RGBA{0xD8, 0xDB, 0xE0, 0xFF},
+		Radius:   6,
+	}
+	darkTables = TableTheme{
+		HeaderBG: color.RGBA{0x22, 0x22, 0x27, 0xFF},
+		StripeBG: color.RGBA{0x18, 0x18, 0x1B, 0xFF},
+		Border:   color.RGBA{0x3A, 0x3A, 0x40, 0xFF},
+		Radius:   6,
+	}
+)
+
+// borderWidth returns the width of border lines, which is also the gap
+// left between cells whatever lines are drawn.
+func (t TableTheme) borderWidth() int {
+	if t.BorderWidth <= 0 {
+		return 1
+	}
+	return t.BorderWidth
+}
+
+// tableCell is the content of one cell and its column's alignment.
+type tableCell struct {
+	tokens []textToken
+	align  extensionAST.Alignment
+}
+
+// collectTableRow collects the cells of a table row or header, whose children
+// are both TableCells. Header cells are bold.
+func (r *renderer) collectTableRow(row ast.Node, md []byte, size float64, isHeader bool) []tableCell {
+	font := r.c.fonts.Regular
+	if isHeader && r.c.fonts.Bold != nil {
+		font = r.c.fonts.Bold
+	}
+	var cells []tableCell
+	for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+		if tc, ok := cell.(*extensionAST.TableCell); ok {
+			var tokens []textToken
+			r.collectInlineTokens(tc, md, font, size, r.c.th.FG, &tokens)
+			cells = append(cells, tableCell{tokens: tokens, align: tc.Alignment})
+		}
+	}
+	return cells
+}
+
+// measureTokens returns the narrowest width drawTokens can wrap tokens to,
+// that of their widest word, image or formula, and their width laid out
+// without wrapping. Like drawTokens, it lets lines break between tokens.
+func (c *canvas) measureTokens(tokens []textToken) (minWidth, maxWidth int) {
+	var line float64
+	endLine := func() {
+		maxWidth = max(maxWidth, int(math.Ceil(line)))
+		line = 0
+	}
+	for _, tok := range tokens {
+		switch {
+		case tok.newline:
+			endLine()
+		case tok.image != nil && tok.inline:
+			w, _ := c.imageSize(tok, 0)
+			minWidth = max(minWidth, w)
+			line += float64(w)
+		case tok.image != nil:
+			endLine()
+			w, _ := c.imageSize(tok, 0)
+			minWidth, maxWidth = max(minWidth, w), max(maxWidth, w)
+		case tok.formula != nil:
+			minWidth = max(minWidth, int(math.Ceil(tok.formula.width)))
+			line += tok.formula.width
+		default:
+			font := tok.font
+			if font == nil {
+				font = c.fonts.Regular
+			}
+			for _, seg := range splitTextPreserveSpaces(tok.text) {
+				w := measureWidth(font, tok.size, seg)
+				if seg != "" && !unicode.IsSpace([]rune(seg)[0]) {
+					minWidth = max(minWidth, int(math.Ceil(w)))
+				}
+				line += w
+			}
+		}
+	}
+	endLine()
+	return minWidth, maxWidth
+}
+
+// columnWidths shares available pixels between columns with the given
+// narrowest and preferred widths. When even the narrowest widths do not fit,
+// each column gets a share of available in proportion to its narrowest width.
+func columnWidths(minWidths, maxWidths []int, available int) []int {
+	var sumMin, sumMax int
+	for i := range minWidths {
+		sumMin += minWidths[i]
+		sumMax += maxWidths[i]
+	}
+	widths := make([]int, len(minWidths))
+	switch {
+	case sumMax <= available:
+		copy(widths, maxWidths)
+	case sumMin < available:
+		extra := float64(available-sumMin) / float64(sumMax-sumMin)
+		for i := range widths {
+			widths[i] = minWidths[i] + int(float64(maxWidths[i]-minWidths[i])*extra)
+		}
+	default:
+		for i := range widths {
+			widths[i] = minWidths[i] * available / max(sumMin, 1)
+		}
+	}
+	if sumMax > available && len(widths) > 0 {
+		// Rounding down leaves a few pixels; the last column takes them.
+		for _, w := range widths {
+			available -= w
+		}
+		widths[len(widths)-1] += max(available, 0)
+	}
+	return widths
+}
+
+// alignCell moves the lines drawn in cell to the right of, or centered
+// between, left and right.
+func alignCell(cell *Box, align extensionAST.Alignment, left, right int) {
+	if align != extensionAST.AlignRight && align != extensionAST.AlignCenter {
+		return
+	}
+	for _, line := range cell.Children {
+		if line.Kind != LineBox && line.Kind != ImageBox {
+			continue
+		}
+		dx := right - line.Rect.Max.X
+		if align == extensionAST.AlignCenter {
+			dx = (right - left - line.Rect.Dx()) / 2
+			dx -= line.Rect.Min.X - left
+		}
+		if dx > 0 {
+			shiftBox(line, image.Pt(dx, 0))
+		}
+	}
+}
+
+// renderTable draws a table between left and right, as narrow as its content
+// allows. A table whose content cannot fit is fitted by r.tableOverflow.
+func (r *renderer) renderTable(tbl *extensionAST.Table, md []byte, left, right int) {
+	size := r.baseSize
+	rows := r.collectTable(tbl, md, size)
+	if tableColumns(rows) == 0 {
+		return
+	}
+	if need := r.tableWidth(rows, size); need > right-left {
+		switch r.tableOverflow {
+		case TableOverflowShrink:
+			for need > right-left && size*0.9 >= r.baseSize*minTableScale {
+				size *= 0.9
+				rows = r.collectTable(tbl, md, size)
+				need = r.tableWidth(rows, size)
+			}
+		case TableOverflowWiden:
+			// right is measured on the requested width; keep the margin
+			// it leaves, and any width an earlier table already added.
+			r.c.w = max(r.c.w, left+need+r.c.pageW-right)
+			right = left + need
+		case TableOverflowCards:
+			r.drawTableCards(tbl, md, rows, size, left, right)
+			return
+		case TableOverflowSplit:
+			r.drawTableGroups(tbl, md, rows, size, left, right)
+			return
+		}
+	}
+	r.drawTable(tbl, md, rows, size, true, left, right)
+}
+
+// collectTable collects the header and body rows of tbl at the given size.
+func (r *renderer) collectTable(tbl *extensionAST.Table, md []byte, size float64) [][]tableCell {
+	var rows [][]tableCell
+	for node := tbl.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *extensionAST.TableHeader:
+			rows = append(rows, r.collectTableRow(n, md, size, true))
+		case *extensionAST.TableRow:
+			rows = append(rows, r.collectTableRow(n, md, size, false))
+		}
+	}
+	return rows
+}
+
+// tableColumns returns the number of columns of the widest row.
+func tableColumns(rows [][]tableCell) int {
+	colCount := 0
+	for _, row := range rows {
+		colCount = max(colCount, len(row))
+	}
+	return colCount
+}
+
+// cellAt returns the cell of row in column col, which is empty when the row
+// is short.
+func cellAt(row []tableCell, col int) tableCell {
+	if col < len(row) {
+		return row[col]
+	}
+	return tableCell{}
+}
+
+// cellPadding returns the padding of cells whose text is of the given size.
+// It is in ems of that size, so shrunken tables are padded less.
+func (r *renderer) cellPadding(size float64) int {
+	return int(r.c.th.Style.Table.CellPadding * size)
+}
+
+// measureColumns returns each column's narrowest and preferred widths,
+// cell padding included.
+func (r *renderer) measureColumns(rows [][]tableCell, size float64) (minWidths, maxWidths []int) {
+	colCount := tableColumns(rows)
+	pad := 2 * r.cellPadding(size)
+	minWidths, maxWidths = make([]int, colCount), make([]int, colCount)
+	for _, row := range rows {
+		for col, cell := range row {
+			lo, hi := r.c.measureTokens(cell.tokens)
+			minWidths[col] = max(minWidths[col], lo+pad)
+			maxWidths[col] = max(maxWidths[col], hi+pad)
+		}
+	}
+	return minWidths, maxWidths
+}
+
+// tableWidth returns the narrowest width rows can be drawn at without text
+// running out of its cells.
+func (r *renderer) tableWidth(rows [][]tableCell, size float64) int {
+	minWidths, _ := r.measureColumns(rows, size)
+	border := r.c.th.Tables.borderWidth()
+	width := border
+	for _, w := range minWidths {
+		width += w + border
+	}
+	return width
+}
+
+// drawTableCards draws each body row as a card of its own: a two-column
+// table pairing the header's cells with the row's. A table without body rows
+// has nothing to pair the header with and is drawn as it is.
+func (r *renderer) drawTableCards(tbl *extensionAST.Table, md []byte, rows [][]tableCell, size float64, left, right int) {
+	if len(rows) < 2 {
+		r.drawTable(tbl, md, rows, size, true, left, right)
+		return
+	}
+	colCount := tableColumns(rows)
+	header := rows[0]
+	for _, row := range rows[1:] {
+		card := make([][]tableCell, colCount)
+		for col := range card {
+			key, value := cellAt(header, col), cellAt(row, col)
+			key.align, value.align = extensionAST.AlignNone, extensionAST.AlignNone
+			card[col] = []tableCell{key, value}
+		}
+		r.drawTable(tbl, md, card, size, false, left, right)
+	}
+}
+
+// drawTableGroups draws the table as several narrower tables, each holding
+// as many columns as fit. The first column is repeated in every group so
+// that rows can be matched up.
+func (r *renderer) drawTableGroups(tbl *extensionAST.Table, md []byte, rows [][]tableCell, size float64, left, right int) {
+	minWidths, _ := r.measureColumns(rows, size)
+	colCount := len(minWidths)
+	border := r.c.th.Tables.borderWidth()
+	if colCount == 1 {
+		r.drawTable(tbl, md, rows, size, true, left, right)
+		return
+	}
+	for start := 1; start < colCount; {
+		end := start + 1
+		width := minWidths[0] + minWidths[start] + 3*border
+		for end < colCount && width+minWidths[end]+border <= right-left {
+			width += minWidths[end] + border
+			end++
+		}
+		group := make([][]tableCell, len(rows))
+		for i, row := range rows {
+			group[i] = append(group[i], cellAt(row, 0))
+			for col := start; col < end; col++ {
+				group[i] = append(group[i], cellAt(row, col))
+			}
+		}
+		r.drawTable(tbl, md, group, size, true, left, right)
+		start = end
+	}
+}
+
+// drawTable draws rows of cells collected at size as a table between left
+// and right, styled by the theme's Tables. When header is set, the first row
+// is the header. Columns whose widest word does not fit are reported.
+func (r *renderer) drawTable(tbl *extensionAST.Table, md []byte, rows [][]tableCell, size float64, header bool, left, right int) {
+	colCount := tableColumns(rows)
+	st := r.c.th.Style.Table
+	tt := r.c.th.Tables
+	border := tt.borderWidth()
+	cellPadding := r.cellPadding(size)
+	needWidths, maxWidths := r.measureColumns(rows, size)
+	minWidths := make([]int, colCount)
+	for col := range minWidths {
+		minWidths[col] = max(needWidths[col], st.MinColumnWidth)
+		maxWidths[col] = max(maxWidths[col], minWidths[col])
+	}
+	colWidths := columnWidths(minWidths, maxWidths, right-left-border*(colCount+1))
+	var overrun []string
+	for col, w := range colWidths {
+		if w < needWidths[col] {
+			overrun = append(overrun, strconv.Itoa(col+1))
+		}
+	}
+	if len(overrun) > 0 {
+		columns := "column "
+		if len(overrun) > 1 {
+			columns = "columns "
+		}
+		r.diagnose(tbl, md, "table needs %dpx but has %dpx; text overruns %s%s", r.tableWidth(rows, size), right-left, columns, strings.Join(overrun, ", "))
+	}
+	tableLeft := left
+	tableRight := tableLeft + border
+	colLefts := make([]int, colCount)
+	for col, w := range colWidths {
+		colLefts[col] = tableRight
+		tableRight += w + border
+	}
+
+	r.c.addVSpace(r.c.em(st.SpaceBefore))
+	tableTop := r.c.cursorY
+	table := r.c.beginBlock(RoleTable, tableLeft, tableRight)
+	y := tableTop + border
+
+	var rowBoxes []*Box
+	for _, row := range rows {
+		rowTop := y
+		r.c.cursorY = rowTop
+		rowBox := r.c.beginBlock(RoleTableRow, tableLeft, tableRight)
+		rowBoxes = append(rowBoxes, rowBox)
+		maxCellHeight := 0
+		var cells []*Box
+		for col := 0; col < colCount; col++ {
+			cellLeft := colLefts[col]
+			cellRight := cellLeft + colWidths[col]
+			contentLeft := cellLeft + cellPadding
+			contentRight := cellRight - cellPadding
+			if contentRight <= contentLeft {
+				contentRight = cellRight - 2
+			}
+			r.c.cursorY = rowTop
+			cell := r.c.beginBlock(RoleTableCell, cellLeft, cellRight)
+			cells = append(cells, cell)
+			start := rowTop + cellPadding
+			r.c.cursorY = start
+			content := cellAt(row, col)
+			metrics := r.c.drawTokens(content.tokens, contentLeft, contentRight)
+			alignCell(cell, content.align, contentLeft, contentRight)
+			height := r.c.cursorY - start
+			if len(metrics) == 0 && len(content.tokens) == 0 {
+				height = int(size * 1.1)
+			}
+			if height > maxCellHeight {
+				maxCellHeight = height
+			}
+			r.c.endBlock(cell)
+		}
+		if maxCellHeight < int(size*1.1) {
+			maxCellHeight = int(size * 1.1)
+		}
+		rowBottom := rowTop + maxCellHeight + 2*cellPadding
+		for _, cell := range cells {
+			cell.Rect.Max.Y = rowBottom
+		}
+		r.c.cursorY = rowBottom
+		r.c.endBlock(rowBox)
+		rowBox.Rect.Max.Y = rowBottom
+		y = rowBottom + border
+	}
+	tableBottom := y
+
+	r.fillTableRows(rowBoxes, header)
+	r.drawTableBorders(rowBoxes, colLefts, tableTop, tableBottom)
+	r.c.cursorY = tableBottom
+	r.c.endBlock(table)
+	r.c.cursorY = tableBottom - border + r.c.em(st.SpaceAfter)
+}
+
+// tableRadius returns the radius of the table's outer corners. Tables drawn
+// with only row lines keep square corners, as their lines run off the ends.
+func (t TableTheme) tableRadius() float64 {
+	if t.Borders == TableBordersRows {
+		return 0
+	}
+	return float64(max(t.Radius, 0))
+}
+
+// fillTableRows fills the header row and every other body row behind their
+// cells. The first and last rows are rounded to sit inside the table's
+// corners.
+func (r *renderer) fillTableRows(rowBoxes []*Box, header bool) {
+	tt := r.c.th.Tables
+	radius := tt.tableRadius()
+	if tt.Borders != TableBordersNone {
+		radius = max(radius-float64(tt.borderWidth()), 0)
+	}
+	for i, row := range rowBoxes {
+		fill := tt.StripeBG
+		switch {
+		case header && i == 0:
+			fill = tt.HeaderBG
+		case header && i%2 == 1, !header && i%2 == 0:
+			fill = nil
+		}
+		if fill == nil {
+			continue
+		}
+		var top, bottom float64
+		if i == 0 {
+			top = radius
+		}
+		if i == len(rowBoxes)-1 {
+			bottom = radius
+		}
+		box := &Box{Kind: RuleBox, Rect: row.Rect, Fill: fill}
+		if top > 0 || bottom > 0 {
+			box.Kind = PathBox
+			box.Path = Path{roundedCornersPolygon(row.Rect, top, bottom)}
+		}
+		// Fills go first so that the cells paint over them.
+		row.Children = append([]*Box{box}, row.Children...)
+	}
+}
+
+// drawTableBorders draws the lines the theme's Tables ask for around and
+// between the rows and columns.
+func (r *renderer) drawTableBorders(rowBoxes []*Box, colLefts []int, tableTop, tableBottom int) {
+	tt := r.c.th.Tables
+	if tt.Borders == TableBordersNone || len(rowBoxes) == 0 {
+		return
+	}
+	border := tt.borderWidth()
+	col := tt.Border
+	if col == nil {
+		col = r.c.th.HRule
+	}
+	outer := image.Rect(rowBoxes[0].Rect.Min.X, tableTop, rowBoxes[0].Rect.Max.X, tableBottom)
+	for _, row := range rowBoxes[:len(rowBoxes)-1] {
+		r.c.fillRect(image.Rect(outer.Min.X, row.Rect.Max.Y, outer.Max.X, row.Rect.Max.Y+border), col)
+	}
+	if tt.Borders == TableBordersRows {
+		r.c.fillRect(image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, outer.Min.Y+border), col)
+		r.c.fillRect(image.Rect(outer.Min.X, outer.Max.Y-border, outer.Max.X, outer.Max.Y), col)
+		return
+	}
+	for _, x := range colLefts[1:] {
+		r.c.fillRect(image.Rect(x-border, outer.Min.Y, x, outer.Max.Y), col)
+	}
+	r.outlineTable(outer, border, tt.tableRadius(), col)
+}
+
+// outlineTable draws a border of the given width just inside outer. Rounded
+// corners are drawn as caps across the top and bottom joined by straight
+// sides, so that the outline does not stop pages breaking between rows.
+func (r *renderer) outlineTable(outer image.Rectangle, border int, radius float64, col color.Color) {
+	if radius <= 0 {
+		inner := outer.Inset(border)
+		r.c.fillRect(image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, inner.Min.Y), col)
+		r.c.fillRect(image.Rect(outer.Min.X, inner.Max.Y, outer.Max.X, outer.Max.Y), col)
+		r.c.fillRect(image.Rect(outer.Min.X, inner.Min.Y, inner.Min.X, inner.Max.Y), col)
+		r.c.fillRect(image.Rect(inner.Max.X, inner.Min.Y, outer.Max.X, inner.Max.Y), col)
+		return
+	}
+	capHeight := max(int(math.Ceil(2*radius)), border)
+	if outer.Dy() < 2*capHeight {
+		outline := roundedRectPolygon(outer, radius)
+		hole := reversePolygon(roundedRectPolygon(outer.Inset(border), max(radius-float64(border), 0)))
+		r.c.add(&Box{Kind: PathBox, Rect: outer, Fill: col, Path: Path{outline, hole}})
+		return
+	}
+	inner := max(radius-float64(border), 0)
+	top := image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, outer.Min.Y+capHeight)
+	topHole := image.Rect(top.Min.X+border, top.Min.Y+border, top.Max.X-border, top.Max.Y)
+	r.c.add(&Box{Kind: PathBox, Rect: top, Fill: col, Path: Path{
+		roundedCornersPolygon(top, radius, 0), reversePolygon(roundedCornersPolygon(topHole, inner, 0)),
+	}})
+	bottom := image.Rect(outer.Min.X, outer.Max.Y-capHeight, outer.Max.X, outer.Max.Y)
+	bottomHole := image.Rect(bottom.Min.X+border, bottom.Min.Y, bottom.Max.X-border, bottom.Max.Y-border)
+	r.c.add(&Box{Kind: PathBox, Rect: bottom, Fill: col, Path: Path{
+		roundedCornersPolygon(bottom, 0, radius), reversePolygon(roundedCornersPolygon(bottomHole, 0, inner)),
+	}})
+	r.c.fillRect(image.Rect(outer.Min.X, top.Max.Y, outer.Min.X+border, bottom.Min.Y), col)
+	r.c.fillRect(image.Rect(outer.Max.X-border, top.Max.Y, outer.Max.X, bottom.Min.Y), col)
+}
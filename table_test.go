@@ -0,0 +1,235 @@
+package md2png
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnWidths(t *testing.T) {
+	cases := []struct {
+		min, max  []int
+		available int
+		want      []int
+	}{
+		{[]int{20, 40}, []int{30, 100}, 500, []int{30, 100}},
+		{[]int{20, 40}, []int{30, 240}, 160, []int{24, 136}},
+		{[]int{100, 300}, []int{200, 600}, 200, []int{50, 150}},
+	}
+	for _, tc := range cases {
+		if got := columnWidths(tc.min, tc.max, tc.available); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("columnWidths(%v, %v, %d) = %v, want %v", tc.min, tc.max, tc.available, got, tc.want)
+		}
+	}
+}
+
+func TestRenderTableWidthsAndAlignment(t *testing.T) {
+	long := strings.Repeat("a long description ", 8)
+	markdown := "| ID | Description | Price |\n|:-:|---|--:|\n| 1 | " + long + "| 3.50 |\n| 22 | Short | 120.00 |\n"
+	l, err := LayoutDocument([]byte(markdown), RenderOptions{Width: 640})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var table *Box
+	var cells []*Box
+	runs := map[string]*Box{}
+	l.Walk(func(b *Box) bool {
+		switch {
+		case b.Role == RoleTable:
+			table = b
+		case b.Role == RoleTableCell:
+			cells = append(cells, b)
+		case b.Kind == GlyphRunBox:
+			runs[strings.TrimSpace(b.Run.Text)] = b
+		}
+		return true
+	})
+	if table == nil || len(cells) != 9 {
+		t.Fatalf("expected a 3x3 table, got %d cells", len(cells))
+	}
+	if table.Rect.Max.X > 640-48 {
+		t.Fatalf("expected the table within the margins, got %v", table.Rect)
+	}
+	id, desc := cells[0].Rect.Dx(), cells[1].Rect.Dx()
+	if id*4 > desc {
+		t.Fatalf("expected a narrow ID column beside the description, got %d and %d", id, desc)
+	}
+	if price := runs["120.00"]; price == nil || cells[8].Rect.Max.X-price.Rect.Max.X > 16 {
+		t.Fatalf("expected prices aligned right")
+	}
+	one, head := runs["1"], runs["ID"]
+	if one == nil || head == nil {
+		t.Fatalf("expected the ID column text")
+	}
+	if mid := (cells[3].Rect.Min.X + cells[3].Rect.Max.X) / 2; (one.Rect.Min.X+one.Rect.Max.X)/2-mid > 2 || mid-(one.Rect.Min.X+one.Rect.Max.X)/2 > 2 {
+		t.Fatalf("expected the ID centered in its cell")
+	}
+}
+
+func TestTableOverflowByName(t *testing.T) {
+	if o, err := TableOverflowByName("Cards"); err != nil || o != TableOverflowCards {
+		t.Fatalf("expected cards, got %q (%v)", o, err)
+	}
+	if o, err := TableOverflowByName(""); err != nil || o != TableOverflowWrap {
+		t.Fatalf("expected wrap by default, got %q (%v)", o, err)
+	}
+	if _, err := TableOverflowByName("scroll"); err == nil {
+		t.Fatalf("expected an unknown strategy to fail")
+	}
+}
+
+func TestRenderWideTables(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("Intro.\n\n|")
+	for i := 0; i < 6; i++ {
+		sb.WriteString(" Heading |")
+	}
+	sb.WriteString("\n|" + strings.Repeat("---|", 6) + "\n|")
+	for i := 0; i < 6; i++ {
+		sb.WriteString(" identifier_value |")
+	}
+	markdown := []byte(sb.String() + "\n")
+
+	layout := func(overflow TableOverflow) (*Layout, []*Box, []Diagnostic) {
+		var reported []Diagnostic
+		l, err := LayoutDocument(markdown, RenderOptions{Width: 640, TableOverflow: overflow, Diagnostics: func(d Diagnostic) {
+			reported = append(reported, d)
+		}})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		if len(reported) != len(l.Diagnostics) {
+			t.Fatalf("expected every diagnostic passed to the callback")
+		}
+		var tables []*Box
+		l.Walk(func(b *Box) bool {
+			if b.Role == RoleTable {
+				tables = append(tables, b)
+			}
+			return true
+		})
+		return l, tables, reported
+	}
+
+	if _, _, diags := layout(TableOverflowWrap); len(diags) != 1 || diags[0].Line != 3 || !strings.Contains(diags[0].String(), "line 3: table needs") {
+		t.Fatalf("expected the overrun reported against the table's line, got %v", diags)
+	}
+	for _, overflow := range []TableOverflow{TableOverflowShrink, TableOverflowCards, TableOverflowSplit} {
+		_, tables, diags := layout(overflow)
+		if len(diags) != 0 {
+			t.Fatalf("%s: expected the table to fit, got %v", overflow, diags)
+		}
+		for _, tbl := range tables {
+			if tbl.Rect.Max.X > 640-48 {
+				t.Fatalf("%s: table %v past the margin", overflow, tbl.Rect)
+			}
+		}
+		if overflow == TableOverflowCards && len(tables) != 1 || overflow == TableOverflowSplit && len(tables) < 2 {
+			t.Fatalf("%s: unexpected number of tables: %d", overflow, len(tables))
+		}
+	}
+	l, tables, diags := layout(TableOverflowWiden)
+	if len(diags) != 0 || l.Width <= 640 || tables[0].Rect.Max.X > l.Width-48 {
+		t.Fatalf("expected the image widened to hold the table, got width %d", l.Width)
+	}
+
+	headerOnly := "| " + strings.Repeat("identifier_value | ", 6) + "\n|" + strings.Repeat("---|", 6) + "\n"
+	cards, err := LayoutDocument([]byte(headerOnly), RenderOptions{Width: 640, TableOverflow: TableOverflowCards})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	runs := 0
+	cards.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox && strings.Contains(b.Run.Text, "identifier") {
+			runs++
+		}
+		return true
+	})
+	if runs == 0 {
+		t.Fatalf("expected a header-only table drawn rather than dropped as cards")
+	}
+
+	twice, err := LayoutDocument([]byte(sb.String()+"\n"+sb.String()+"\n"), RenderOptions{Width: 640, TableOverflow: TableOverflowWiden})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	if twice.Width != l.Width {
+		t.Fatalf("expected two wide tables to widen the image as much as one, got %d and %d", twice.Width, l.Width)
+	}
+
+	noted, err := LayoutDocument([]byte("Noted[^1].\n\n"+sb.String()+"\n\n[^1]: "+strings.Repeat("A long footnote that wraps. ", 12)+"\n"), RenderOptions{Width: 640, TableOverflow: TableOverflowWiden})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var notes *Box
+	noted.Walk(func(b *Box) bool {
+		if b.Role == RoleFootnotes {
+			notes = b
+		}
+		return notes == nil
+	})
+	if noted.Width <= 640 || notes == nil || notes.Rect.Max.X > 640-48 {
+		t.Fatalf("expected footnotes wrapped to the page width, not the widened image")
+	}
+	walkBoxes(notes, func(b *Box) bool {
+		if b.Rect.Max.X > 640-48 {
+			t.Fatalf("footnote part %v past the page margin", b.Rect)
+		}
+		return true
+	})
+}
+
+func TestRenderTableTheme(t *testing.T) {
+	markdown := []byte("| A | B |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |\n| 5 | 6 |\n")
+	layout := func(tables TableTheme) (fills, rules, paths []*Box) {
+		th := LightTheme
+		th.Tables = tables
+		l, err := LayoutDocument(markdown, RenderOptions{Width: 400, Theme: th})
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		l.Walk(func(b *Box) bool {
+			switch {
+			case b.Fill == tables.HeaderBG || b.Fill == tables.StripeBG:
+				fills = append(fills, b)
+			case b.Kind == RuleBox:
+				rules = append(rules, b)
+			case b.Kind == PathBox:
+				paths = append(paths, b)
+			}
+			return true
+		})
+		return fills, rules, paths
+	}
+
+	fills, _, paths := layout(LightTheme.Tables)
+	if len(fills) != 2 || fills[0].Fill != LightTheme.Tables.HeaderBG || fills[0].Kind != PathBox {
+		t.Fatalf("expected a rounded header fill and one stripe, got %d fills", len(fills))
+	}
+	if fills[1].Fill != LightTheme.Tables.StripeBG || fills[1].Rect.Min.Y <= fills[0].Rect.Max.Y {
+		t.Fatalf("expected the second body row striped")
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected rounded outline corners, got %d paths", len(paths))
+	}
+
+	rows := LightTheme.Tables
+	rows.Borders, rows.BorderWidth = TableBordersRows, 2
+	_, rules, _ := layout(rows)
+	if len(rules) != 5 {
+		t.Fatalf("expected a line above, below and between each of 4 rows, got %d", len(rules))
+	}
+	for _, rule := range rules {
+		if rule.Rect.Dy() != 2 || rule.Fill != rows.Border {
+			t.Fatalf("expected 2px horizontal lines in the border color, got %v", rule.Rect)
+		}
+	}
+	none := LightTheme.Tables
+	none.Borders = TableBordersNone
+	if _, rules, _ = layout(none); len(rules) != 0 {
+		t.Fatalf("expected no border lines, got %d", len(rules))
+	}
+	if _, rules, paths = layout(TableTheme{}); len(rules) != 3+1+4 || len(paths) != 0 {
+		t.Fatalf("expected a square 1px grid for a zero table theme, got %d rules", len(rules))
+	}
+}
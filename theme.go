@@ -0,0 +1,304 @@
+package md2png
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---- Theme files ----
+
+// LoadTheme reads a theme from JSON or YAML. Colors are hex strings such as
+// "#1f6feb", "#fff" or "#00000080". An optional "base" key names the built-in
+// theme ("light" or "dark") whose colors fill in anything the file leaves
+// out; the default is light. For example:
+//
+//	base: dark
+//	bg: "#0d1117"
+//	link: "#58a6ff"
+//	syntax:
+//	  keyword: "#ff7b72"
+//	  comment: "#8b949e"
+//
+// Keys are matched without regard to case, dashes or underscores, so
+// "code_bg", "codeBG" and "code-bg" are the same. Only a small subset of
+// YAML is understood: nested maps of scalar values, comments and quoting.
+func LoadTheme(r io.Reader) (Theme, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Theme{}, err
+	}
+	var values map[string]any
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &values); err != nil {
+			return Theme{}, fmt.Errorf("md2png: theme: %w", err)
+		}
+	} else if values, err = parseYAMLMap(data); err != nil {
+		return Theme{}, err
+	}
+
+	th := lightTheme
+	if base, ok := lookupKey(values, "base"); ok {
+		name, ok := base.(string)
+		if !ok {
+			return Theme{}, errors.New("md2png: theme: base must be a theme name")
+		}
+		if th, err = ThemeByName(name); err != nil {
+			return Theme{}, fmt.Errorf("md2png: theme: %w", err)
+		}
+	}
+	if err := applyThemeColors(themeColorFields(&th), themeSettingFields(&th), values, ""); err != nil {
+		return Theme{}, err
+	}
+	return th, nil
+}
+
+// themeColorFields maps normalized theme keys to the colors they set. Nested
+// keys are joined with a dot.
+func themeColorFields(th *Theme) map[string]*color.Color {
+	return map[string]*color.Color{
+		"bg":               &th.BG,
+		"fg":               &th.FG,
+		"codebg":           &th.CodeBG,
+		"quotebar":         &th.QuoteBar,
+		"hrule":            &th.HRule,
+		"link":             &th.Link,
+		"warning":          &th.Warning,
+		"syntax.keyword":   &th.Syntax.Keyword,
+		"syntax.string":    &th.Syntax.String,
+		"syntax.number":    &th.Syntax.Number,
+		"syntax.comment":   &th.Syntax.Comment,
+		"syntax.type":      &th.Syntax.Type,
+		"syntax.literal":   &th.Syntax.Literal,
+		"syntax.key":       &th.Syntax.Key,
+		"syntax.inserted":  &th.Syntax.Inserted,
+		"syntax.deleted":   &th.Syntax.Deleted,
+		"syntax.meta":      &th.Syntax.Meta,
+		"alerts.note":      &th.Alerts.Note,
+		"alerts.tip":       &th.Alerts.Tip,
+		"alerts.important": &th.Alerts.Important,
+		"alerts.warning":   &th.Alerts.Warning,
+		"alerts.caution":   &th.Alerts.Caution,
+		"tables.headerbg":  &th.Tables.HeaderBG,
+		"tables.stripebg":  &th.Tables.StripeBG,
+		"tables.border":    &th.Tables.Border,
+	}
+}
+
+// themeSettingFields maps normalized theme keys that are not colors to
+// functions parsing and setting their values.
+func themeSettingFields(th *Theme) map[string]func(string) error {
+	pixels := func(field *int) func(string) error {
+		return func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid pixel count %q", v)
+			}
+			*field = n
+			return nil
+		}
+	}
+	return map[string]func(string) error{
+		"tables.borderwidth": pixels(&th.Tables.BorderWidth),
+		"tables.radius":      pixels(&th.Tables.Radius),
+		"tables.borders": func(v string) error {
+			borders, err := TableBordersByName(v)
+			th.Tables.Borders = borders
+			return err
+		},
+	}
+}
+
+func applyThemeColors(fields map[string]*color.Color, settings map[string]func(string) error, values map[string]any, prefix string) error {
+	// Sort keys so the first error reported is stable.
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := prefix + normalizeThemeKey(k)
+		if name == "base" {
+			continue
+		}
+		switch v := values[k].(type) {
+		case map[string]any:
+			if err := applyThemeColors(fields, settings, v, name+"."); err != nil {
+				return err
+			}
+		case float64:
+			// JSON numbers; only settings take them.
+			set, ok := settings[name]
+			if !ok {
+				return fmt.Errorf("md2png: theme: %s: expected a color string", prefix+k)
+			}
+			if err := set(strconv.FormatFloat(v, 'f', -1, 64)); err != nil {
+				return fmt.Errorf("md2png: theme: %s: %w", prefix+k, err)
+			}
+		case string:
+			if set, ok := settings[name]; ok {
+				if err := set(v); err != nil {
+					return fmt.Errorf("md2png: theme: %s: %w", prefix+k, err)
+				}
+				continue
+			}
+			field, ok := fields[name]
+			if !ok {
+				return fmt.Errorf("md2png: theme: unknown key %q", prefix+k)
+			}
+			c, err := parseHexColor(v)
+			if err != nil {
+				return fmt.Errorf("md2png: theme: %s: %w", prefix+k, err)
+			}
+			*field = c
+		default:
+			return fmt.Errorf("md2png: theme: %s: expected a color string", prefix+k)
+		}
+	}
+	return nil
+}
+
+func normalizeThemeKey(k string) string {
+	k = strings.ToLower(k)
+	k = strings.ReplaceAll(k, "_", "")
+	return strings.ReplaceAll(k, "-", "")
+}
+
+func lookupKey(values map[string]any, key string) (any, bool) {
+	for k, v := range values {
+		if normalizeThemeKey(k) == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseHexColor parses #RGB, #RGBA, #RRGGBB or #RRGGBBAA.
+func parseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var b strings.Builder
+		for _, r := range hex {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+		hex = b.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	c := color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	if c.A == 0xFF {
+		return color.RGBA(c), nil
+	}
+	return c, nil
+}
+
+// parseYAMLMap parses the YAML subset used by theme files: nested mappings
+// whose leaves are scalars, with # comments and quoted strings.
+func parseYAMLMap(data []byte) (map[string]any, error) {
+	type level struct {
+		indent int
+		values map[string]any
+	}
+	root := map[string]any{}
+	stack := []level{{0, root}}
+	var pending string // key waiting for a nested mapping
+	pendingIndent := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		body := strings.TrimLeft(raw, " ")
+		if body == "" || body[0] == '#' || body == "---" {
+			continue
+		}
+		indent := len(raw) - len(body)
+		if strings.HasPrefix(body, "\t") {
+			return nil, fmt.Errorf("md2png: theme: line %d: tabs are not allowed for indentation", lineNo)
+		}
+		if pending != "" {
+			if indent > pendingIndent {
+				child := map[string]any{}
+				stack[len(stack)-1].values[pending] = child
+				stack = append(stack, level{indent, child})
+			} else {
+				stack[len(stack)-1].values[pending] = ""
+			}
+			pending = ""
+		}
+		for len(stack) > 1 && indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		if indent != stack[len(stack)-1].indent {
+			return nil, fmt.Errorf("md2png: theme: line %d: inconsistent indentation", lineNo)
+		}
+
+		colon := strings.Index(body, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("md2png: theme: line %d: expected \"key: value\"", lineNo)
+		}
+		key := strings.Trim(strings.TrimSpace(body[:colon]), `"'`)
+		value, err := yamlScalar(body[colon+1:])
+		if err != nil {
+			return nil, fmt.Errorf("md2png: theme: line %d: %w", lineNo, err)
+		}
+		if value == "" {
+			pending, pendingIndent = key, indent
+			continue
+		}
+		stack[len(stack)-1].values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pending != "" {
+		stack[len(stack)-1].values[pending] = ""
+	}
+	return root, nil
+}
+
+// yamlScalar unquotes a scalar value and strips a trailing comment. A bare
+// value such as #1f6feb is read as a color rather than a comment, since that
+// is almost always what a theme author means.
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	switch s[0] {
+	case '"', '\'':
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		value := s[1 : end+1]
+		if s[0] == '"' {
+			if unquoted, err := strconv.Unquote(s[:end+2]); err == nil {
+				value = unquoted
+			}
+		}
+		return value, nil
+	case '#':
+		word, _, _ := strings.Cut(s, " ")
+		if _, err := parseHexColor(word); err == nil {
+			return word, nil
+		}
+		return "", nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
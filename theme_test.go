@@ -0,0 +1,89 @@
+package md2png
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestLoadThemeYAMLAndJSON(t *testing.T) {
+	brand := color.RGBA{0xE2, 0x00, 0x74, 0xFF}
+	yaml := `# Brand theme
+base: dark
+bg: "#0d1117"
+link: #e20074   # bare colors are allowed
+code-bg: '#161b22'
+syntax:
+  keyword: "#e20074"
+  comment: "#80808080"
+quote_bar: "#fff"
+`
+	th, err := LoadTheme(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("load yaml: %v", err)
+	}
+	if th.BG != (color.RGBA{0x0D, 0x11, 0x17, 0xFF}) || th.Link != brand || th.CodeBG != (color.RGBA{0x16, 0x1B, 0x22, 0xFF}) {
+		t.Fatalf("unexpected colors: bg %v link %v code %v", th.BG, th.Link, th.CodeBG)
+	}
+	if th.Syntax.Keyword != brand || th.Syntax.Comment != (color.NRGBA{0x80, 0x80, 0x80, 0x80}) {
+		t.Fatalf("unexpected syntax colors: %v %v", th.Syntax.Keyword, th.Syntax.Comment)
+	}
+	if th.QuoteBar != (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Fatalf("unexpected quote bar %v", th.QuoteBar)
+	}
+	if th.FG != DarkTheme.FG || th.Syntax.String != DarkTheme.Syntax.String {
+		t.Fatalf("expected unset colors to come from the dark base theme")
+	}
+
+	th, err = LoadTheme(strings.NewReader("tables:\n  header-bg: \"#e20074\"\n  borders: rows\n  radius: 0\n"))
+	if err != nil {
+		t.Fatalf("load table keys: %v", err)
+	}
+	if th.Tables.HeaderBG != brand || th.Tables.Borders != TableBordersRows || th.Tables.Radius != 0 || th.Tables.StripeBG != LightTheme.Tables.StripeBG {
+		t.Fatalf("unexpected table theme: %+v", th.Tables)
+	}
+
+	th, err = LoadTheme(strings.NewReader(`{"warning": "#e20074", "syntax": {"Keyword": "#e20074"}, "tables": {"borderWidth": 2}}`))
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	if th.Warning != brand || th.Syntax.Keyword != brand || th.BG != LightTheme.BG || th.Tables.BorderWidth != 2 {
+		t.Fatalf("unexpected json theme: %+v", th)
+	}
+}
+
+func TestLoadThemeErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"unknown key":   "bgcolor: \"#fff\"\n",
+		"bad color":     "fg: red\n",
+		"bad base":      "base: sepia\n",
+		"non-string":    `{"fg": 3}`,
+		"indentation":   "syntax:\n    keyword: \"#fff\"\n  comment: \"#000\"\n",
+		"missing colon": "fg \"#fff\"\n",
+		"bad borders":   "tables:\n  borders: dotted\n",
+		"bad radius":    `{"tables": {"radius": -1}}`,
+	} {
+		if _, err := LoadTheme(strings.NewReader(input)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRenderUsesThemeLinkColor(t *testing.T) {
+	th := LightTheme
+	th.Link = color.RGBA{0xE2, 0x00, 0x74, 0xFF}
+	l, err := LayoutDocument([]byte("See [docs](https://example.com).\n"), RenderOptions{Theme: th})
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	found := false
+	l.Walk(func(b *Box) bool {
+		if b.Kind == GlyphRunBox && b.Run.Color == th.Link {
+			found = true
+		}
+		return true
+	})
+	if !found {
+		t.Fatalf("expected the link to use the theme's link color")
+	}
+}